@@ -16,6 +16,8 @@ const (
 	IconIM           = "●"
 	IconMpIM         = "☰"
 	IconNotification = "*"
+	IconDraft        = "✎"
+	IconFailed       = "✗"
 
 	PresenceAway   = "away"
 	PresenceActive = "active"
@@ -34,6 +36,7 @@ type ChannelItem struct {
 	UserID       string
 	Presence     string
 	Notification bool
+	Draft        bool
 
 	StylePrefix string
 	StyleIcon   string
@@ -47,6 +50,8 @@ func (c ChannelItem) ToString() string {
 	var prefix string
 	if c.Notification {
 		prefix = IconNotification
+	} else if c.Draft {
+		prefix = IconDraft
 	} else {
 		prefix = " "
 	}
@@ -205,6 +210,35 @@ func (c *Channels) SetChannels(channels []ChannelItem) {
 	c.ChannelItems = channels
 }
 
+// ReplaceChannels will replace the channels, when they've been refreshed.
+// The channel that is selected stays selected, when it's still there, and
+// the presence, notifications and drafts of the channels are kept.
+func (c *Channels) ReplaceChannels(channels []ChannelItem) {
+	var selected string
+	old := make(map[string]ChannelItem, len(c.ChannelItems))
+	for i, channel := range c.ChannelItems {
+		old[channel.ID] = channel
+		if i == c.SelectedChannel {
+			selected = channel.ID
+		}
+	}
+
+	for i := range channels {
+		if channel, ok := old[channels[i].ID]; ok {
+			if channel.Presence != "" {
+				channels[i].Presence = channel.Presence
+			}
+			channels[i].Notification = channels[i].Notification || channel.Notification
+			channels[i].Draft = channel.Draft
+		}
+	}
+
+	c.ChannelItems = channels
+	c.Offset = 0
+	c.CursorPosition = c.List.InnerBounds().Min.Y
+	c.GotoPosition(c.FindChannel(selected))
+}
+
 func (c *Channels) MarkAsRead(channelID int) {
 	c.ChannelItems[channelID].Notification = false
 }
@@ -214,6 +248,14 @@ func (c *Channels) MarkAsUnread(channelID string) {
 	c.ChannelItems[index].Notification = true
 }
 
+// MarkDrafts will mark the channels for which hasDraft returns true, they
+// get an icon in front of their name
+func (c *Channels) MarkDrafts(hasDraft func(channelID string) bool) {
+	for i := range c.ChannelItems {
+		c.ChannelItems[i].Draft = hasDraft(c.ChannelItems[i].ID)
+	}
+}
+
 func (c *Channels) SetPresence(channelID string, presence string) {
 	index := c.FindChannel(channelID)
 	c.ChannelItems[index].Presence = presence
@@ -0,0 +1,36 @@
+package components
+
+import "testing"
+
+func TestChannelsReplaceChannels(t *testing.T) {
+	channels := CreateChannelsComponent(10)
+	channels.SetChannels([]ChannelItem{
+		{ID: "C1", Name: "general"},
+		{ID: "C2", Name: "random", Notification: true},
+		{ID: "D1", Name: "bob", Presence: "active"},
+	})
+	channels.GotoPosition(1)
+
+	channels.ReplaceChannels([]ChannelItem{
+		{ID: "C0", Name: "announcements"},
+		{ID: "C1", Name: "general"},
+		{ID: "C2", Name: "random"},
+		{ID: "D1", Name: "bob", Presence: "away"},
+	})
+
+	if got := channels.GetSelectedChannel().ID; got != "C2" {
+		t.Errorf("got %s selected, want C2", got)
+	}
+	if !channels.ChannelItems[2].Notification {
+		t.Error("the notification of C2 isn't kept")
+	}
+	if got := channels.ChannelItems[3].Presence; got != "active" {
+		t.Errorf("got presence %q, want the presence that was shown", got)
+	}
+
+	// When the selected channel is gone, the first one is selected
+	channels.ReplaceChannels([]ChannelItem{{ID: "C1", Name: "general"}})
+	if got := channels.GetSelectedChannel().ID; got != "C1" {
+		t.Errorf("got %s selected, want C1", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/erroneousboat/termui"
@@ -17,6 +18,33 @@ type Chat struct {
 	List     *termui.List
 	Messages map[string]Message
 	Offset   int
+
+	// Selected is the ID of the message that is highlighted
+	Selected string
+
+	// Messages, Offset and Selected are changed while the Chat is
+	// rendered in the render loop of termui, hence the lock
+	mu sync.Mutex
+
+	// scrollToSelected is set when the selected message should be
+	// scrolled into view on the next render, selectedStart and
+	// selectedEnd are the cells of the selected message in that render
+	scrollToSelected bool
+	selectedStart    int
+	selectedEnd      int
+
+	// Emoji is set when the reactions should be shown as emoji instead
+	// of their shortcodes
+	Emoji bool
+
+	// Mrkdwn are the styles of the formatting of messages
+	Mrkdwn MrkdwnStyle
+
+	// Previews are the previews of images by the id of their file, they
+	// are kept when switching channels. Previews are loaded in the
+	// background, hence the lock.
+	Previews   map[string]*Preview
+	previewsMu sync.RWMutex
 }
 
 // CreateChatComponent is the constructor for the Chat struct
@@ -25,6 +53,7 @@ func CreateChatComponent(inputHeight int) *Chat {
 		List:     termui.NewList(),
 		Messages: make(map[string]Message),
 		Offset:   0,
+		Previews: make(map[string]*Preview),
 	}
 
 	chat.List.Height = termui.TermHeight() - inputHeight
@@ -35,6 +64,9 @@ func CreateChatComponent(inputHeight int) *Chat {
 
 // Buffer implements interface termui.Bufferer
 func (c *Chat) Buffer() termui.Buffer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Convert Messages into termui.Cell
 	cells := c.MessagesToCells(c.Messages)
 
@@ -51,8 +83,12 @@ func (c *Chat) Buffer() termui.Buffer {
 
 	// When we encounter a newline or, are at the bounds of the chat view we
 	// stop iterating over the cells and add the line to the line array
+	//
+	// We keep track of the first and the last line of the selected
+	// message, so it can be scrolled into view
 	x := 0
-	for _, cell := range cells {
+	selectedFirst, selectedLast := -1, -1
+	for i, cell := range cells {
 
 		// When we encounter a newline we add the line to the array
 		if cell.Ch == '\n' {
@@ -72,6 +108,13 @@ func (c *Chat) Buffer() termui.Buffer {
 			x = 0
 		}
 
+		if i >= c.selectedStart && i < c.selectedEnd {
+			if selectedFirst < 0 {
+				selectedFirst = len(lines)
+			}
+			selectedLast = len(lines)
+		}
+
 		line.cells = append(line.cells, cell)
 		x += cell.Width()
 	}
@@ -80,6 +123,26 @@ func (c *Chat) Buffer() termui.Buffer {
 	// newlines or were at the bounds of the chat view
 	lines = append(lines, line)
 
+	// Change the offset, so the selected message is in view. When it
+	// doesn't fit in the pane its first line is shown.
+	if c.scrollToSelected && selectedFirst >= 0 {
+		c.scrollToSelected = false
+
+		height := c.GetMaxItems()
+		bottom := len(lines) - 1 - c.Offset
+		if selectedLast > bottom {
+			bottom = selectedLast
+		}
+		if selectedFirst < bottom-height+1 {
+			bottom = selectedFirst + height - 1
+		}
+
+		c.Offset = len(lines) - 1 - bottom
+		if c.Offset < 0 {
+			c.Offset = 0
+		}
+	}
+
 	// We will print lines bottom up, it will loop over the lines
 	// backwards and for every line it'll set the cell in that line.
 	// Offset is the number which allows us to begin printing the
@@ -169,6 +232,9 @@ func (c *Chat) GetMaxItems() int {
 // SetMessages will put the provided messages into the Messages field of the
 // Chat view
 func (c *Chat) SetMessages(messages []Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Reset offset first, when scrolling in view and changing channels we
 	// want the offset to be 0 when loading new messages
 	c.Offset = 0
@@ -179,25 +245,476 @@ func (c *Chat) SetMessages(messages []Message) {
 
 // AddMessage adds a single message to Messages
 func (c *Chat) AddMessage(message Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.Messages[message.ID] = message
 }
 
 // AddReply adds a single reply to a parent thread, it also sets
 // the thread separator
 func (c *Chat) AddReply(parentID string, message Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// It is possible that a message is received but the parent is not
 	// present in the chat view
 	if _, ok := c.Messages[parentID]; ok {
 		message.Thread = "  "
 		c.Messages[parentID].Messages[message.ID] = message
 	} else {
-		c.AddMessage(message)
+		c.Messages[message.ID] = message
+	}
+}
+
+// UpdateMessage will replace a message, or a reply, that is already present
+// in Messages. The replies and the thread prefix of the message it replaces
+// are kept. It returns false when the message isn't present.
+func (c *Chat) UpdateMessage(message Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.Messages[message.ID]; ok {
+		c.Messages[message.ID] = mergeMessage(old, message)
+		return true
+	}
+
+	for _, parent := range c.Messages {
+		if old, ok := parent.Messages[message.ID]; ok {
+			parent.Messages[message.ID] = mergeMessage(old, message)
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeleteMessage will remove a message, or a reply, from Messages. When the
+// message has replies it is replaced by a tombstone, so the thread can still
+// be read. It returns false when the message isn't present.
+func (c *Chat) DeleteMessage(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Selected == id {
+		c.Selected = ""
+	}
+
+	if msg, ok := c.Messages[id]; ok {
+		replies := make(map[string]Message)
+		for replyID, reply := range msg.Messages {
+			if reply.UserID != "" {
+				replies[replyID] = reply
+			}
+		}
+
+		if len(replies) == 0 {
+			delete(c.Messages, id)
+			return true
+		}
+
+		msg.Content = "This message was deleted."
+		msg.Messages = replies
+		c.Messages[id] = msg
+		return true
+	}
+
+	for _, parent := range c.Messages {
+		if _, ok := parent.Messages[id]; ok {
+			delete(parent.Messages, id)
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddReaction will add the reaction of userID to a message, or a reply. It
+// returns false when the message isn't present.
+func (c *Chat) AddReaction(id string, name string, userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.modifyMessage(id, func(msg Message) Message {
+		reactions := make([]Reaction, 0, len(msg.Reactions)+1)
+		found := false
+		for _, r := range msg.Reactions {
+			if r.Name == name {
+				found = true
+				if !r.HasUser(userID) {
+					r.Users = append(append([]string{}, r.Users...), userID)
+					r.Count++
+				}
+			}
+			reactions = append(reactions, r)
+		}
+
+		if !found {
+			reactions = append(reactions, Reaction{
+				Name:  name,
+				Count: 1,
+				Users: []string{userID},
+			})
+		}
+
+		msg.Reactions = reactions
+		return msg
+	})
+}
+
+// RemoveReaction will remove the reaction of userID from a message, or a
+// reply. It returns false when the message isn't present.
+func (c *Chat) RemoveReaction(id string, name string, userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.modifyMessage(id, func(msg Message) Message {
+		reactions := make([]Reaction, 0, len(msg.Reactions))
+		for _, r := range msg.Reactions {
+			if r.Name == name && r.HasUser(userID) {
+				users := make([]string, 0, len(r.Users))
+				for _, user := range r.Users {
+					if user != userID {
+						users = append(users, user)
+					}
+				}
+				r.Users = users
+				r.Count--
+			}
+
+			if r.Count > 0 {
+				reactions = append(reactions, r)
+			}
+		}
+
+		msg.Reactions = reactions
+		return msg
+	})
+}
+
+// GetSelectedMessage returns the message that is selected, when nothing is
+// selected the last message is returned
+func (c *Chat) GetSelectedMessage() (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Selected == "" {
+		msgs := SortMessages(c.Messages)
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if msgs[i].UserID != "" {
+				return msgs[i], true
+			}
+		}
+		return Message{}, false
+	}
+
+	var selected Message
+	ok := c.modifyMessage(c.Selected, func(msg Message) Message {
+		selected = msg
+		return msg
+	})
+
+	return selected, ok
+}
+
+// FindLastMessage returns the newest message, or reply, for which fn
+// returns true
+func (c *Chat) FindLastMessage(fn func(Message) bool) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var found Message
+	var ok bool
+	for _, msg := range c.Messages {
+		candidates := append([]Message{msg}, SortMessages(msg.Messages)...)
+		for _, m := range candidates {
+			if m.UserID != "" && fn(m) && m.ID > found.ID {
+				found = m
+				ok = true
+			}
+		}
 	}
+
+	return found, ok
+}
+
+// modifyMessage will replace the message, or reply, with the id by the
+// result of fn. It returns false when the message isn't present.
+func (c *Chat) modifyMessage(id string, fn func(Message) Message) bool {
+	if msg, ok := c.Messages[id]; ok {
+		c.Messages[id] = fn(msg)
+		return true
+	}
+
+	for _, parent := range c.Messages {
+		if msg, ok := parent.Messages[id]; ok {
+			parent.Messages[id] = fn(msg)
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeMessage returns message with the thread prefix and the replies of
+// old, these aren't part of an edited message
+func mergeMessage(old Message, message Message) Message {
+	if message.Thread == "" {
+		message.Thread = old.Thread
+	}
+
+	if message.Messages == nil {
+		message.Messages = make(map[string]Message)
+	}
+	for id, reply := range old.Messages {
+		if _, ok := message.Messages[id]; !ok {
+			message.Messages[id] = reply
+		}
+	}
+
+	return message
+}
+
+// SelectPrevious will select the message of userID that was posted before
+// the one that is selected now, when nothing is selected the last message
+// of userID is selected. It returns false when there is no such message.
+func (c *Chat) SelectPrevious(userID string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msgs := c.userMessages(userID)
+
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if c.Selected == "" || msgs[i].ID < c.Selected {
+			c.Selected = msgs[i].ID
+			return msgs[i], true
+		}
+	}
+
+	return Message{}, false
+}
+
+// SelectNext will select the message of userID that was posted after the
+// one that is selected now. When there is none the selection is cleared and
+// false is returned.
+func (c *Chat) SelectNext(userID string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Selected == "" {
+		return Message{}, false
+	}
+
+	for _, msg := range c.userMessages(userID) {
+		if msg.ID > c.Selected {
+			c.Selected = msg.ID
+			return msg, true
+		}
+	}
+
+	c.Selected = ""
+	return Message{}, false
+}
+
+// Select will select the message, or reply, with the id, it returns false
+// when the message isn't present
+func (c *Chat) Select(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.Messages[id]; ok {
+		c.Selected = id
+		return true
+	}
+
+	for _, parent := range c.Messages {
+		if _, ok := parent.Messages[id]; ok {
+			c.Selected = id
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetSelectedID returns the ID of the selected message, it is empty when
+// nothing is selected
+func (c *Chat) GetSelectedID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.Selected
+}
+
+// ClearSelection will remove the highlight of the selected message
+func (c *Chat) ClearSelection() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Selected = ""
+}
+
+// SelectUp will select the message, or reply, that is shown above the one
+// that is selected now, when nothing is selected the last message is
+// selected. It returns false when there is no such message.
+func (c *Chat) SelectUp() (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msgs := c.selectableMessages()
+
+	i := len(msgs)
+	for j, msg := range msgs {
+		if msg.ID == c.Selected {
+			i = j
+		}
+	}
+
+	if i == 0 || len(msgs) == 0 {
+		return Message{}, false
+	}
+
+	c.Selected = msgs[i-1].ID
+	c.scrollToSelected = true
+	return msgs[i-1], true
+}
+
+// SelectDown will select the message, or reply, that is shown under the
+// one that is selected now. It returns false when there is no such message.
+func (c *Chat) SelectDown() (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msgs := c.selectableMessages()
+
+	for i := 0; i < len(msgs)-1; i++ {
+		if msgs[i].ID == c.Selected {
+			c.Selected = msgs[i+1].ID
+			c.scrollToSelected = true
+			return msgs[i+1], true
+		}
+	}
+
+	return Message{}, false
+}
+
+// ScrollToSelected will scroll the selected message into view on the next
+// render of the Chat
+func (c *Chat) ScrollToSelected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.scrollToSelected = true
+}
+
+// GetParent returns the message of which the message, or reply, with the id
+// is a reply. It returns false when it isn't a reply.
+func (c *Chat) GetParent(id string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, parent := range c.Messages {
+		if _, ok := parent.Messages[id]; ok {
+			return parent, true
+		}
+	}
+
+	return Message{}, false
+}
+
+// selectableMessages returns the messages, and replies, that can be
+// selected in the order they're shown. Attachments and the lines of the
+// help aren't messages of a user, they can't be selected.
+func (c *Chat) selectableMessages() []Message {
+	var msgs []Message
+	for _, msg := range SortMessages(c.Messages) {
+		if msg.ID != "" && msg.Name != "" {
+			msgs = append(msgs, msg)
+		}
+		for _, reply := range SortMessages(msg.Messages) {
+			if reply.ID != "" && reply.Name != "" {
+				msgs = append(msgs, reply)
+			}
+		}
+	}
+
+	return msgs
+}
+
+// userMessages returns the messages, and replies, of userID sorted from old
+// to new
+func (c *Chat) userMessages(userID string) []Message {
+	var msgs []Message
+	for _, msg := range SortMessages(c.Messages) {
+		if msg.UserID == userID {
+			msgs = append(msgs, msg)
+		}
+		for _, reply := range SortMessages(msg.Messages) {
+			if reply.UserID == userID {
+				msgs = append(msgs, reply)
+			}
+		}
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].ID < msgs[j].ID
+	})
+
+	return msgs
+}
+
+// SetPreview will set the preview of the image with the file id, when the
+// preview couldn't be loaded preview is nil
+func (c *Chat) SetPreview(id string, preview *Preview) {
+	c.previewsMu.Lock()
+	defer c.previewsMu.Unlock()
+
+	c.Previews[id] = preview
+}
+
+// GetPreview returns the preview of the image with the file id
+func (c *Chat) GetPreview(id string) (*Preview, bool) {
+	c.previewsMu.RLock()
+	defer c.previewsMu.RUnlock()
+
+	preview, ok := c.Previews[id]
+	return preview, ok && preview != nil
+}
+
+// MissingPreviews returns the images of the messages, and replies, of which
+// the preview hasn't been loaded yet. They're marked as loading, so they
+// will only be returned once.
+func (c *Chat) MissingPreviews() []File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.previewsMu.Lock()
+	defer c.previewsMu.Unlock()
+
+	var files []File
+	var find func(msgs map[string]Message)
+	find = func(msgs map[string]Message) {
+		for _, msg := range SortMessages(msgs) {
+			if msg.Image != nil {
+				if _, ok := c.Previews[msg.Image.ID]; !ok {
+					c.Previews[msg.Image.ID] = nil
+					files = append(files, *msg.Image)
+				}
+			}
+			find(msg.Messages)
+		}
+	}
+	find(c.Messages)
+
+	return files
 }
 
 // IsNewThread check whether a message that is going to be added as
 // a child to a parent message, is the first one or not
 func (c *Chat) IsNewThread(parentID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if parent, ok := c.Messages[parentID]; ok {
 		if len(parent.Messages) > 0 {
 			return true
@@ -208,7 +725,11 @@ func (c *Chat) IsNewThread(parentID string) bool {
 
 // ClearMessages clear the c.Messages
 func (c *Chat) ClearMessages() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.Messages = make(map[string]Message)
+	c.Selected = ""
 }
 
 // ScrollUp will render the chat messages based on the Offset of the Chat
@@ -219,6 +740,9 @@ func (c *Chat) ClearMessages() {
 // pane). Increasing the Offset will thus result in substracting the offset
 // from the len(Chat.Messages).
 func (c *Chat) ScrollUp() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.Offset = c.Offset + 10
 
 	// Protect overscrolling
@@ -235,6 +759,9 @@ func (c *Chat) ScrollUp() {
 // pane). Increasing the Offset will thus result in substracting the offset
 // from the len(Chat.Messages).
 func (c *Chat) ScrollDown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.Offset = c.Offset - 10
 
 	// Protect overscrolling
@@ -249,17 +776,50 @@ func (c *Chat) SetBorderLabel(channelName string) {
 }
 
 // MessagesToCells is a wrapper around MessageToCells to use for a slice of
-// of type Message
+// of type Message, the lock is held by Buffer while it is called
 func (c *Chat) MessagesToCells(msgs map[string]Message) []termui.Cell {
-	cells := make([]termui.Cell, 0)
+	c.selectedStart, c.selectedEnd = -1, -1
+	return c.appendMessagesCells(make([]termui.Cell, 0), msgs)
+}
+
+// appendMessagesCells will append the cells of msgs, and their replies, to
+// cells. The cells of the selected message are remembered in selectedStart
+// and selectedEnd.
+func (c *Chat) appendMessagesCells(cells []termui.Cell, msgs map[string]Message) []termui.Cell {
 	sortedMessages := SortMessages(msgs)
 
 	for i, msg := range sortedMessages {
-		cells = append(cells, c.MessageToCells(msg)...)
+		msgCells := c.MessageToCells(msg)
+
+		// Highlight the selected message
+		if msg.ID != "" && msg.ID == c.Selected {
+			for j := range msgCells {
+				msgCells[j].Fg |= termui.AttrReverse
+			}
+			c.selectedStart = len(cells)
+			c.selectedEnd = len(cells) + len(msgCells)
+		}
+
+		cells = append(cells, msgCells...)
+
+		// Show the preview of the image under the message, it is
+		// indented like the reactions
+		if msg.Image != nil {
+			if preview, ok := c.GetPreview(msg.Image.ID); ok {
+				cells = append(cells, termui.Cell{Ch: '\n'})
+				cells = append(cells, c.PreviewToCells(preview)...)
+			}
+		}
+
+		// Show the reactions under the message
+		if len(msg.Reactions) > 0 {
+			cells = append(cells, termui.Cell{Ch: '\n'})
+			cells = append(cells, c.ReactionsToCells(msg.Reactions)...)
+		}
 
 		if len(msg.Messages) > 0 {
 			cells = append(cells, termui.Cell{Ch: '\n'})
-			cells = append(cells, c.MessagesToCells(msg.Messages)...)
+			cells = c.appendMessagesCells(cells, msg.Messages)
 		}
 
 		// Add a newline after every message
@@ -300,23 +860,84 @@ func (c *Chat) MessageToCells(msg Message) []termui.Cell {
 		)
 	}
 
-	// Hack, in order to get the correct fg and bg attributes. This is
-	// because the readAttr function in termui is unexported.
-	txCells := termui.DefaultTxBuilder.Build(
-		msg.GetContent(),
-		termui.ColorDefault, termui.ColorDefault,
+	// Attachments get a bar in their color in front of every line
+	var bar []termui.Cell
+	width := c.List.InnerBounds().Dx()
+	if msg.StyleBar != "" {
+		style := NewStyle(msg.StyleBar)
+		for _, r := range "▌ " {
+			bar = append(bar, termui.Cell{Ch: r, Fg: style.Fg, Bg: style.Bg})
+		}
+		width -= len(bar)
+	}
+	cells = append(cells, bar...)
+
+	// Text, formatted with the mrkdwn of slack
+	text := MrkdwnToCells(
+		msg.Content,
+		NewStyle(msg.StyleText),
+		c.Mrkdwn,
+		width,
 	)
+	for _, cell := range text {
+		cells = append(cells, cell)
+		if cell.Ch == '\n' {
+			cells = append(cells, bar...)
+		}
+	}
 
-	// Text
-	for _, r := range msg.Content {
-		cells = append(
-			cells,
-			termui.Cell{
-				Ch: r,
-				Fg: txCells[0].Fg,
-				Bg: txCells[0].Bg,
-			},
-		)
+	return cells
+}
+
+// ReactionsToCells will convert the reactions of a message to termui.Cell,
+// every reaction is shown with the number of users that reacted with it
+//
+//	:+1: 2  :tada: 1
+func (c *Chat) ReactionsToCells(reactions []Reaction) []termui.Cell {
+	var parts []string
+	for _, r := range reactions {
+		emoji := fmt.Sprintf(":%s:", r.Name)
+		if c.Emoji {
+			if code, ok := config.EmojiCodemap[emoji]; ok {
+				emoji = code
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s %d", emoji, r.Count))
+	}
+
+	cells := make([]termui.Cell, 0)
+	for _, r := range "    " + strings.Join(parts, "  ") {
+		cells = append(cells, termui.Cell{
+			Ch: r,
+			Fg: c.List.ItemFgColor,
+			Bg: c.List.ItemBgColor,
+		})
+	}
+
+	return cells
+}
+
+// PreviewToCells will convert the preview of an image to termui.Cell, it is
+// scaled down when it doesn't fit in the Chat pane
+func (c *Chat) PreviewToCells(preview *Preview) []termui.Cell {
+	const indent = 4
+
+	space := termui.Cell{
+		Ch: ' ',
+		Fg: c.List.ItemFgColor,
+		Bg: c.List.ItemBgColor,
+	}
+
+	cells := make([]termui.Cell, 0)
+	newline := true
+	for _, cell := range preview.Cells(c.List.InnerBounds().Dx() - indent) {
+		if newline {
+			for i := 0; i < indent; i++ {
+				cells = append(cells, space)
+			}
+		}
+		cells = append(cells, cell)
+		newline = cell.Ch == '\n'
 	}
 
 	return cells
@@ -324,6 +945,9 @@ func (c *Chat) MessageToCells(msg Message) []termui.Cell {
 
 // Help shows the usage and key bindings in the chat pane
 func (c *Chat) Help(usage string, cfg *config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	msgUsage := Message{
 		ID:      fmt.Sprintf("%d", time.Now().UnixNano()),
 		Content: usage,
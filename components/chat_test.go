@@ -0,0 +1,106 @@
+package components
+
+import (
+	"testing"
+
+	"github.com/erroneousboat/termui"
+)
+
+// newTestChat returns a Chat with the messages 1 of alice, 2 of bob with the
+// reply 3 of alice and the attachment line 2a, and 4 of alice. It isn't
+// created with CreateChatComponent, which needs the size of the terminal.
+func newTestChat() *Chat {
+	chat := &Chat{
+		List:     termui.NewList(),
+		Messages: make(map[string]Message),
+		Previews: make(map[string]*Preview),
+	}
+	chat.SetMessages([]Message{
+		{ID: "1", UserID: "U1", Name: "alice", Content: "one"},
+		{
+			ID: "2", UserID: "U2", Name: "bob", Content: "two",
+			Messages: map[string]Message{
+				"2a": {ID: "2a", Content: "attachment"},
+				"3":  {ID: "3", UserID: "U1", Name: "alice", Content: "reply"},
+			},
+		},
+		{ID: "4", UserID: "U1", Name: "alice", Content: "four"},
+	})
+	return chat
+}
+
+func TestChatSelectUpDown(t *testing.T) {
+	chat := newTestChat()
+
+	// Attachment lines can't be selected, replies can
+	for _, want := range []string{"4", "3", "2", "1"} {
+		if msg, ok := chat.SelectUp(); !ok || msg.ID != want {
+			t.Errorf("got %s selected, want %s", msg.ID, want)
+		}
+	}
+	if _, ok := chat.SelectUp(); ok || chat.GetSelectedID() != "1" {
+		t.Errorf("selected above the first message, got %s", chat.GetSelectedID())
+	}
+
+	for _, want := range []string{"2", "3", "4"} {
+		if msg, ok := chat.SelectDown(); !ok || msg.ID != want {
+			t.Errorf("got %s selected, want %s", msg.ID, want)
+		}
+	}
+	if _, ok := chat.SelectDown(); ok || chat.GetSelectedID() != "4" {
+		t.Errorf("selected under the last message, got %s", chat.GetSelectedID())
+	}
+}
+
+func TestChatSelectPreviousNext(t *testing.T) {
+	chat := newTestChat()
+
+	// Only the messages of the user are selected
+	for _, want := range []string{"4", "3", "1"} {
+		if msg, ok := chat.SelectPrevious("U1"); !ok || msg.ID != want {
+			t.Errorf("got %s selected, want %s", msg.ID, want)
+		}
+	}
+	if _, ok := chat.SelectPrevious("U1"); ok {
+		t.Error("selected a message before the first one of the user")
+	}
+
+	for _, want := range []string{"3", "4"} {
+		if msg, ok := chat.SelectNext("U1"); !ok || msg.ID != want {
+			t.Errorf("got %s selected, want %s", msg.ID, want)
+		}
+	}
+
+	// After the last message the selection is cleared
+	if _, ok := chat.SelectNext("U1"); ok || chat.GetSelectedID() != "" {
+		t.Errorf("got %s selected, want no selection", chat.GetSelectedID())
+	}
+}
+
+func TestChatGetSelectedMessage(t *testing.T) {
+	chat := newTestChat()
+
+	// Without a selection the last message is returned
+	if msg, ok := chat.GetSelectedMessage(); !ok || msg.ID != "4" {
+		t.Errorf("got %s, want the last message", msg.ID)
+	}
+
+	if !chat.Select("3") {
+		t.Fatal("couldn't select the reply")
+	}
+	if msg, ok := chat.GetSelectedMessage(); !ok || msg.Content != "reply" {
+		t.Errorf("got %q, want the reply", msg.Content)
+	}
+	if parent, ok := chat.GetParent("3"); !ok || parent.ID != "2" {
+		t.Errorf("got parent %s, want 2", parent.ID)
+	}
+
+	if chat.Select("9") {
+		t.Error("selected a message that isn't there")
+	}
+
+	chat.ClearSelection()
+	if id := chat.GetSelectedID(); id != "" {
+		t.Errorf("got %s selected after clearing the selection", id)
+	}
+}
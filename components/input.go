@@ -1,27 +1,81 @@
 package components
 
 import (
+	"strings"
+
 	"github.com/erroneousboat/termui"
 	runewidth "github.com/mattn/go-runewidth"
 )
 
-// Input is the definition of an Input component
+// Input is the definition of an Input component. The text is wrapped to
+// the width of the component, and the component grows with the number of
+// lines of the text up to MaxLines, after that the lines are scrolled.
 type Input struct {
-	Par                  *termui.Par
-	Text                 []rune
-	CursorPositionScreen int
-	CursorPositionText   int
-	Offset               int
+	Par                *termui.Par
+	Text               []rune
+	CursorPositionText int
+	Offset             int
+	MaxLines           int
+
+	// Drafts contains the text that was typed, but not sent, by the key of
+	// the channel or thread it was typed in. DraftKey is the key of the
+	// channel or thread the text of the Input belongs to, its draft isn't
+	// in Drafts while it is shown.
+	Drafts   map[string]Draft
+	DraftKey string
+
+	// History contains the messages that have been sent, by the id of
+	// the channel they were sent to, from old to new
+	History map[string][]string
+
+	// historyKey is the channel of which the History is being browsed,
+	// historyIndex the message that is shown, and historyText the text
+	// that was typed before browsing started
+	historyKey   string
+	historyIndex int
+	historyText  string
+
+	// killRing contains the text that has been killed, from old to new,
+	// yankIndex is the text of killRing that has been yanked last and
+	// yankStart the position it was yanked at
+	killRing  []string
+	yankIndex int
+	yankStart int
+}
+
+// Draft is the text and the position of the cursor of a message that
+// hasn't been sent yet
+type Draft struct {
+	Text   string `json:"text"`
+	Cursor int    `json:"cursor"`
+}
+
+const (
+	// maxHistory is the number of messages of a channel that are kept in
+	// the History
+	maxHistory = 100
+
+	// maxKillRing is the number of killed texts that can be yanked
+	maxKillRing = 10
+)
+
+// inputLine is a line of the Input as it is shown, start and end are the
+// positions of its runes in the text
+type inputLine struct {
+	start int
+	end   int
 }
 
 // CreateInput is the constructor of the Input struct
 func CreateInputComponent() *Input {
 	input := &Input{
-		Par:                  termui.NewPar(""),
-		Text:                 make([]rune, 0),
-		CursorPositionScreen: 0,
-		CursorPositionText:   0,
-		Offset:               0,
+		Par:                termui.NewPar(""),
+		Text:               make([]rune, 0),
+		CursorPositionText: 0,
+		Offset:             0,
+		MaxLines:           10,
+		Drafts:             make(map[string]Draft),
+		History:            make(map[string][]string),
 	}
 
 	input.Par.Height = 3
@@ -31,20 +85,46 @@ func CreateInputComponent() *Input {
 
 // Buffer implements interface termui.Bufferer
 func (i *Input) Buffer() termui.Buffer {
-	buf := i.Par.Buffer()
+	buf := i.Par.Block.Buffer()
+	bounds := i.Par.InnerBounds()
+
+	lines := i.getLines()
+	row, col := i.getCursor(lines)
+
+	// Scroll so the line with the cursor stays in view
+	if row < i.Offset {
+		i.Offset = row
+	}
+	if row >= i.Offset+bounds.Dy() {
+		i.Offset = row - bounds.Dy() + 1
+	}
+
+	for y := 0; y < bounds.Dy() && i.Offset+y < len(lines); y++ {
+		line := lines[i.Offset+y]
+
+		x := bounds.Min.X
+		for _, r := range i.Text[line.start:line.end] {
+			buf.Set(x, bounds.Min.Y+y, termui.Cell{
+				Ch: r,
+				Fg: i.Par.TextFgColor,
+				Bg: i.Par.TextBgColor,
+			})
+			x += runewidth.RuneWidth(r)
+		}
+	}
 
 	// Set visible cursor, get char at screen cursor position
-	char := buf.At(i.Par.InnerX()+i.CursorPositionScreen, i.Par.Block.InnerY())
-
-	buf.Set(
-		i.Par.InnerX()+i.CursorPositionScreen,
-		i.Par.Block.InnerY(),
-		termui.Cell{
-			Ch: char.Ch,
-			Fg: i.Par.TextBgColor,
-			Bg: i.Par.TextFgColor,
-		},
-	)
+	x, y := bounds.Min.X+col, bounds.Min.Y+row-i.Offset
+	char := buf.At(x, y)
+	if char.Ch == 0 {
+		char.Ch = ' '
+	}
+
+	buf.Set(x, y, termui.Cell{
+		Ch: char.Ch,
+		Fg: i.Par.TextBgColor,
+		Bg: i.Par.TextFgColor,
+	})
 
 	return buf
 }
@@ -69,6 +149,60 @@ func (i *Input) SetY(y int) {
 	i.Par.SetY(y)
 }
 
+// GetLineCount returns the number of lines the Input needs to show its
+// text, at most MaxLines
+func (i *Input) GetLineCount() int {
+	count := len(i.getLines())
+	if i.MaxLines > 0 && count > i.MaxLines {
+		count = i.MaxLines
+	}
+	return count
+}
+
+// getLines will split the text in the lines that are shown, on newlines and
+// where the text doesn't fit the width of the Input. One position is kept
+// free at the end of the lines for the cursor.
+func (i *Input) getLines() []inputLine {
+	width := i.GetMaxWidth()
+	if width < 1 {
+		width = 1
+	}
+
+	var lines []inputLine
+	start, w := 0, 0
+	for j, r := range i.Text {
+		if r == '\n' {
+			lines = append(lines, inputLine{start, j})
+			start, w = j+1, 0
+			continue
+		}
+
+		rw := runewidth.RuneWidth(r)
+		if w+rw > width && j > start {
+			lines = append(lines, inputLine{start, j})
+			start, w = j, 0
+		}
+		w += rw
+	}
+
+	return append(lines, inputLine{start, len(i.Text)})
+}
+
+// getCursor returns the line and the column of the CursorPositionText in
+// lines. When the cursor is where a line is wrapped, it is shown at the
+// start of the next line.
+func (i *Input) getCursor(lines []inputLine) (int, int) {
+	row := 0
+	for j, line := range lines {
+		if line.start <= i.CursorPositionText {
+			row = j
+		}
+	}
+
+	line := lines[row]
+	return row, runewidth.StringWidth(string(i.Text[line.start:i.CursorPositionText]))
+}
+
 // Insert will insert a given key at the place of the current CursorPositionText
 func (i *Input) Insert(key rune) {
 	// Append key to the left side
@@ -85,20 +219,8 @@ func (i *Input) Insert(key rune) {
 // Backspace will remove a character in front of the CursorPositionText
 func (i *Input) Backspace() {
 	if i.CursorPositionText > 0 {
-
-		// We want the cursor to stay in the same spot when the text
-		// overflow, revealing the test on the left side when using
-		// backspace. When all the text has been revealed will move
-		// the cursor to the left.
-		if i.Offset > 0 {
-			i.Offset--
-			i.CursorPositionText--
-		} else {
-			i.MoveCursorLeft()
-		}
-
+		i.MoveCursorLeft()
 		i.Text = append(i.Text[0:i.CursorPositionText], i.Text[i.CursorPositionText+1:]...)
-		i.Par.Text = string(i.Text[i.Offset:])
 	}
 }
 
@@ -106,7 +228,6 @@ func (i *Input) Backspace() {
 func (i *Input) Delete() {
 	if i.CursorPositionText < len(i.Text) {
 		i.Text = append(i.Text[0:i.CursorPositionText], i.Text[i.CursorPositionText+1:]...)
-		i.Par.Text = string(i.Text[i.Offset:])
 	}
 }
 
@@ -114,100 +235,412 @@ func (i *Input) Delete() {
 func (i *Input) MoveCursorRight() {
 	if i.CursorPositionText < len(i.Text) {
 		i.CursorPositionText++
-		i.ScrollRight()
 	}
-
-	i.Par.Text = string(i.Text[i.Offset:])
 }
 
 // MoveCursorLeft will decrease the current CursorPositionText with 1
 func (i *Input) MoveCursorLeft() {
 	if i.CursorPositionText > 0 {
 		i.CursorPositionText--
-		i.ScrollLeft()
 	}
+}
 
-	i.Par.Text = string(i.Text[i.Offset:])
+// MoveCursorUp will move the cursor to the line above, as close as possible
+// to the column it is in. It returns false when the cursor is on the first
+// line already.
+func (i *Input) MoveCursorUp() bool {
+	lines := i.getLines()
+	row, col := i.getCursor(lines)
+	if row == 0 {
+		return false
+	}
+
+	i.CursorPositionText = i.getPosition(lines[row-1], col)
+	return true
 }
 
-func (i *Input) ScrollLeft() {
-	// Is the cursor at the far left of the Input component?
-	if i.CursorPositionScreen == 0 {
+// MoveCursorDown will move the cursor to the line below, as close as
+// possible to the column it is in. It returns false when the cursor is on
+// the last line already.
+func (i *Input) MoveCursorDown() bool {
+	lines := i.getLines()
+	row, col := i.getCursor(lines)
+	if row == len(lines)-1 {
+		return false
+	}
+
+	i.CursorPositionText = i.getPosition(lines[row+1], col)
+	return true
+}
 
-		// Decrease offset to show what is on the left side
-		if i.Offset > 0 {
-			i.Offset--
+// getPosition returns the position in the text of the column col of line
+func (i *Input) getPosition(line inputLine, col int) int {
+	w := 0
+	for j := line.start; j < line.end; j++ {
+		w += runewidth.RuneWidth(i.Text[j])
+		if w > col {
+			return j
 		}
-	} else {
-		i.CursorPositionScreen -= i.GetRuneWidthRight()
+	}
+	return line.end
+}
+
+// MoveCursorWordLeft will move the cursor to the start of the word in front
+// of it
+func (i *Input) MoveCursorWordLeft() {
+	i.CursorPositionText = i.getWordStart()
+}
+
+// MoveCursorWordRight will move the cursor to the end of the word after it
+func (i *Input) MoveCursorWordRight() {
+	i.CursorPositionText = i.getWordEnd()
+}
+
+// MoveCursorHome will move the cursor to the start of the line it is on
+func (i *Input) MoveCursorHome() {
+	i.CursorPositionText = i.getLineStart()
+}
+
+// MoveCursorEnd will move the cursor to the end of the line it is on
+func (i *Input) MoveCursorEnd() {
+	i.CursorPositionText = i.getLineEnd()
+}
+
+// DeleteWordBack will kill the word in front of the cursor
+func (i *Input) DeleteWordBack() {
+	i.kill(i.getWordStart(), i.CursorPositionText)
+}
+
+// DeleteWord will kill the word after the cursor
+func (i *Input) DeleteWord() {
+	i.kill(i.CursorPositionText, i.getWordEnd())
+}
+
+// KillToEnd will kill the text from the cursor to the end of the line, at
+// the end of a line the newline is killed instead
+func (i *Input) KillToEnd() {
+	end := i.getLineEnd()
+	if end == i.CursorPositionText && end < len(i.Text) {
+		end++
+	}
+	i.kill(i.CursorPositionText, end)
+}
+
+// KillLine will kill the text of the line the cursor is on
+func (i *Input) KillLine() {
+	i.kill(i.getLineStart(), i.getLineEnd())
+}
+
+// Yank will insert the text that has been killed last at the cursor
+func (i *Input) Yank() {
+	if len(i.killRing) == 0 {
+		return
+	}
+
+	i.yankIndex = len(i.killRing) - 1
+	i.yankStart = i.CursorPositionText
+	i.Replace(i.CursorPositionText, i.killRing[i.yankIndex])
+}
+
+// YankPop will replace the text that has just been yanked with the text
+// that was killed before it
+func (i *Input) YankPop() {
+	if len(i.killRing) == 0 || i.yankIndex >= len(i.killRing) {
+		return
+	}
+
+	// Only the text that is in front of the cursor can be replaced, when
+	// something else was done after yanking it isn't there anymore
+	yanked := i.killRing[i.yankIndex]
+	if i.yankStart+len([]rune(yanked)) != i.CursorPositionText ||
+		string(i.Text[i.yankStart:i.CursorPositionText]) != yanked {
+		return
+	}
+
+	i.yankIndex = (i.yankIndex + len(i.killRing) - 1) % len(i.killRing)
+	i.Replace(i.yankStart, i.killRing[i.yankIndex])
+}
+
+// Transpose will swap the character in front of the cursor with the one
+// at the cursor, and moves the cursor forward. At the end of a line the two
+// characters in front of the cursor are swapped.
+func (i *Input) Transpose() {
+	pos := i.CursorPositionText
+	if pos == i.getLineEnd() {
+		pos--
+	}
+	if pos < 1 || pos >= len(i.Text) || i.Text[pos-1] == '\n' || i.Text[pos] == '\n' {
+		return
+	}
+
+	i.Text[pos-1], i.Text[pos] = i.Text[pos], i.Text[pos-1]
+	i.CursorPositionText = pos + 1
+}
+
+// kill will remove the text between start and end, and add it to the kill
+// ring so it can be yanked
+func (i *Input) kill(start int, end int) {
+	if start >= end {
+		return
+	}
+
+	i.killRing = append(i.killRing, string(i.Text[start:end]))
+	if len(i.killRing) > maxKillRing {
+		i.killRing = i.killRing[1:]
+	}
+
+	i.Text = append(i.Text[:start], i.Text[end:]...)
+	i.CursorPositionText = start
+}
+
+// getWordStart returns the position of the start of the word in front of
+// the cursor
+func (i *Input) getWordStart() int {
+	pos := i.CursorPositionText
+	for pos > 0 && !isWordRune(i.Text[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(i.Text[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// getWordEnd returns the position of the end of the word after the cursor
+func (i *Input) getWordEnd() int {
+	pos := i.CursorPositionText
+	for pos < len(i.Text) && !isWordRune(i.Text[pos]) {
+		pos++
+	}
+	for pos < len(i.Text) && isWordRune(i.Text[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// getLineStart returns the position of the start of the line the cursor is
+// on, lines are separated by newlines
+func (i *Input) getLineStart() int {
+	pos := i.CursorPositionText
+	for pos > 0 && i.Text[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+// getLineEnd returns the position of the end of the line the cursor is on
+func (i *Input) getLineEnd() int {
+	pos := i.CursorPositionText
+	for pos < len(i.Text) && i.Text[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+// SwitchDraft will keep the text as the draft of DraftKey, and show the
+// draft of key instead. It returns false when key is the DraftKey already.
+func (i *Input) SwitchDraft(key string) bool {
+	if key == i.DraftKey {
+		return false
+	}
+
+	i.SaveDraft()
+	i.RestoreDraft(key)
+	return true
+}
+
+// SaveDraft will keep the text as the draft of DraftKey, when the text is
+// empty the draft is removed
+func (i *Input) SaveDraft() {
+	if i.DraftKey == "" {
+		return
+	}
+
+	if i.IsEmpty() {
+		delete(i.Drafts, i.DraftKey)
+		return
+	}
+
+	i.Drafts[i.DraftKey] = Draft{
+		Text:   i.GetText(),
+		Cursor: i.CursorPositionText,
+	}
+}
+
+// RestoreDraft will replace the text with the draft of key, and make key
+// the DraftKey. The text that is shown isn't kept.
+func (i *Input) RestoreDraft(key string) {
+	draft := i.Drafts[key]
+	delete(i.Drafts, key)
+
+	i.DraftKey = key
+	i.historyKey = ""
+
+	i.SetText(draft.Text)
+	if draft.Cursor >= 0 && draft.Cursor < len(i.Text) {
+		i.CursorPositionText = draft.Cursor
 	}
 }
 
-func (i *Input) ScrollRight() {
-	// Is the cursor at the far right of the Input component, cursor
-	// isn't at the end of the text
-	if (i.CursorPositionScreen + i.GetRuneWidthLeft()) > i.Par.InnerBounds().Dx()-1 {
+// AllDrafts returns the drafts, together with the text that is shown as the
+// draft of DraftKey, this is what should be stored
+func (i *Input) AllDrafts() map[string]Draft {
+	drafts := make(map[string]Draft, len(i.Drafts)+1)
+	for key, draft := range i.Drafts {
+		drafts[key] = draft
+	}
 
-		// Increase offset to show what is on the right side
-		if i.Offset < len(i.Text) {
-			i.Offset = i.CalculateOffset()
-			i.CursorPositionScreen = i.GetRuneWidthOffsetToCursor()
+	if i.DraftKey != "" && !i.IsEmpty() {
+		drafts[i.DraftKey] = Draft{
+			Text:   i.GetText(),
+			Cursor: i.CursorPositionText,
+		}
+	}
+
+	return drafts
+}
+
+// HasDraft returns true when the channel with channelID, or one of its
+// threads, has a draft
+func (i *Input) HasDraft(channelID string) bool {
+	for key := range i.Drafts {
+		if key == channelID || strings.HasPrefix(key, channelID+"/") {
+			return true
 		}
-	} else {
-		i.CursorPositionScreen += i.GetRuneWidthLeft()
 	}
+	return false
 }
 
-// CalculateOffset will, based on the width of the runes on the
-// left of the text cursor, calculate the offset that needs to
-// be used by the Inpute Component
-func (i *Input) CalculateOffset() int {
-	var offset int
+// AddHistory will add text to the History of the channel with key, and
+// stops browsing the History
+func (i *Input) AddHistory(key string, text string) {
+	history := i.History[key]
 
-	var currentRuneWidth int
-	for j := (i.CursorPositionText - 1); currentRuneWidth < i.GetMaxWidth()-1; j-- {
-		currentRuneWidth += runewidth.RuneWidth(i.Text[j])
-		offset = j
+	// Sending the same message again doesn't add it twice
+	if len(history) == 0 || history[len(history)-1] != text {
+		history = append(history, text)
+	}
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
 	}
 
-	return offset
+	i.History[key] = history
+	i.historyKey = ""
 }
 
-// GetRunWidthOffsetToCursor will get the rune width of all
-// the runes from the offset until the text cursor
-func (i *Input) GetRuneWidthOffsetToCursor() int {
-	return runewidth.StringWidth(string(i.Text[i.Offset:i.CursorPositionText]))
+// IsBrowsingHistory returns true when a message of the History is shown
+func (i *Input) IsBrowsingHistory() bool {
+	return i.historyKey != ""
 }
 
-// GetRuneWidthLeft will get the width of a rune on the left side
-// of the CursorPositionText
-func (i *Input) GetRuneWidthLeft() int {
-	return runewidth.RuneWidth(i.Text[i.CursorPositionText-1])
+// HistoryPrev will show the message of the History of the channel with key
+// before the one that is shown, it returns false when there is none
+func (i *Input) HistoryPrev(key string) bool {
+	history := i.History[key]
+
+	// The text that is typed is kept, so it can be shown again after the
+	// last message
+	if i.historyKey != key {
+		i.historyKey = key
+		i.historyIndex = len(history)
+		i.historyText = i.GetText()
+	}
+
+	if i.historyIndex == 0 {
+		return false
+	}
+
+	i.historyIndex--
+	i.SetText(history[i.historyIndex])
+	return true
 }
 
-// GetRuneWidthLeft will get the width of a rune on the right side
-// of the CursorPositionText
-func (i *Input) GetRuneWidthRight() int {
-	return runewidth.RuneWidth(i.Text[i.CursorPositionText])
+// HistoryNext will show the message of the History of the channel with key
+// after the one that is shown, after the last message the text that was
+// typed before browsing is shown. It returns false when the History isn't
+// being browsed.
+func (i *Input) HistoryNext(key string) bool {
+	history := i.History[key]
+	if i.historyKey != key || i.historyIndex >= len(history) {
+		return false
+	}
+
+	i.historyIndex++
+	if i.historyIndex == len(history) {
+		i.SetText(i.historyText)
+		i.historyKey = ""
+	} else {
+		i.SetText(history[i.historyIndex])
+	}
+	return true
 }
 
 // IsEmpty will return true when the input is empty
 func (i *Input) IsEmpty() bool {
-	if i.Par.Text == "" {
-		return true
-	}
-	return false
+	return len(i.Text) == 0
 }
 
 // Clear will empty the input and move the cursor to the start position
 func (i *Input) Clear() {
 	i.Text = make([]rune, 0)
-	i.Par.Text = ""
-	i.CursorPositionScreen = 0
 	i.CursorPositionText = 0
 	i.Offset = 0
 }
 
+// SetText will replace the text of the input, the cursor is moved to the
+// end of the text
+func (i *Input) SetText(text string) {
+	i.Clear()
+	i.Text = []rune(text)
+	i.CursorPositionText = len(i.Text)
+}
+
+// Replace will replace the text between start and the CursorPositionText
+// with text, the cursor is moved to the end of the text that is inserted
+func (i *Input) Replace(start int, text string) {
+	runes := append(append([]rune{}, i.Text[:start]...), []rune(text)...)
+	cursor := len(runes)
+
+	i.Text = append(runes, i.Text[i.CursorPositionText:]...)
+	i.CursorPositionText = cursor
+}
+
+// SetStatus will show a status message, like an error, in the border of
+// the Input component
+func (i *Input) SetStatus(text string) {
+	i.Par.BorderLabel = text
+	i.Par.BorderLabelFg = termui.ColorRed
+}
+
+// SetInfo will show an informational message, like the progress of an
+// upload, in the border of the Input component
+func (i *Input) SetInfo(text string) {
+	i.Par.BorderLabel = text
+	i.Par.BorderLabelFg = termui.ThemeAttr("label.fg")
+}
+
+// ClearStatus will remove the status message from the border of the Input
+// component
+func (i *Input) ClearStatus() {
+	i.Par.BorderLabel = ""
+	i.Par.BorderLabelFg = termui.ThemeAttr("label.fg")
+}
+
+// ClearInfo will remove the informational message text from the border of
+// the Input component, when it is still shown. A message that was shown in
+// the meantime, like an error, is kept.
+func (i *Input) ClearInfo(text string) {
+	if i.Par.BorderLabel == text && i.Par.BorderLabelFg != termui.ColorRed {
+		i.ClearStatus()
+	}
+}
+
+// HasError returns true when an error is shown in the border of the Input
+// component
+func (i *Input) HasError() bool {
+	return i.Par.BorderLabel != "" && i.Par.BorderLabelFg == termui.ColorRed
+}
+
 // GetText returns the text currently in the input
 func (i *Input) GetText() string {
 	return string(i.Text)
@@ -0,0 +1,169 @@
+package components
+
+import "testing"
+
+// newTestInput returns an Input that is wide enough for the texts of the
+// tests, so they aren't wrapped
+func newTestInput(text string) *Input {
+	input := CreateInputComponent()
+	input.Par.Width = 80
+	input.SetText(text)
+	return input
+}
+
+func TestInputHistory(t *testing.T) {
+	input := newTestInput("")
+	input.AddHistory("C1", "first")
+	input.AddHistory("C1", "second")
+	input.AddHistory("C1", "second")
+	input.AddHistory("C2", "other")
+
+	if len(input.History["C1"]) != 2 {
+		t.Fatalf("got history %v, want first and second", input.History["C1"])
+	}
+
+	input.SetText("typed")
+
+	for _, want := range []string{"second", "first"} {
+		if !input.HistoryPrev("C1") || input.GetText() != want {
+			t.Errorf("got %q, want %q", input.GetText(), want)
+		}
+	}
+	if input.HistoryPrev("C1") {
+		t.Error("recalled a message before the first")
+	}
+
+	for _, want := range []string{"second", "typed"} {
+		if !input.HistoryNext("C1") || input.GetText() != want {
+			t.Errorf("got %q, want %q", input.GetText(), want)
+		}
+	}
+	if input.HistoryNext("C1") {
+		t.Error("recalled a message after the typed text")
+	}
+}
+
+func TestInputMoveCursorLines(t *testing.T) {
+	input := newTestInput("first line\nsecond")
+
+	if !input.MoveCursorUp() || input.CursorPositionText != 6 {
+		t.Errorf("cursor at %d, want 6 on the first line", input.CursorPositionText)
+	}
+	if input.MoveCursorUp() {
+		t.Error("moved up from the first line")
+	}
+	if !input.MoveCursorDown() || input.CursorPositionText != len(input.Text) {
+		t.Errorf("cursor at %d, want the end of the second line", input.CursorPositionText)
+	}
+	if input.MoveCursorDown() {
+		t.Error("moved down from the last line")
+	}
+}
+
+func TestInputKillAndYank(t *testing.T) {
+	input := newTestInput("hello brave world")
+
+	input.DeleteWordBack()
+	if input.GetText() != "hello brave " {
+		t.Errorf("got %q after deleting a word", input.GetText())
+	}
+
+	input.KillLine()
+	if input.GetText() != "" {
+		t.Errorf("got %q after killing the line", input.GetText())
+	}
+
+	input.Yank()
+	if input.GetText() != "hello brave " {
+		t.Errorf("got %q after yanking", input.GetText())
+	}
+
+	input.YankPop()
+	if input.GetText() != "world" {
+		t.Errorf("got %q after yanking the text killed before", input.GetText())
+	}
+}
+
+func TestInputTranspose(t *testing.T) {
+	input := newTestInput("ab")
+
+	input.Transpose()
+	if input.GetText() != "ba" {
+		t.Errorf("got %q, want ba", input.GetText())
+	}
+}
+
+func TestInputClearInfo(t *testing.T) {
+	input := newTestInput("")
+
+	input.SetInfo("uploading a.txt 50%")
+	input.ClearInfo("uploading a.txt 50%")
+	if input.Par.BorderLabel != "" {
+		t.Errorf("got %q, want the info cleared", input.Par.BorderLabel)
+	}
+
+	// An error that is shown in the meantime is kept
+	input.SetInfo("downloading a.txt")
+	input.SetStatus("downloading a.txt")
+	input.ClearInfo("downloading a.txt")
+	if !input.HasError() {
+		t.Errorf("got %q, want the error to be kept", input.Par.BorderLabel)
+	}
+}
+
+func TestInputDrafts(t *testing.T) {
+	input := newTestInput("")
+	input.RestoreDraft("C1")
+
+	input.SetText("hello")
+	if !input.SwitchDraft("C2") {
+		t.Fatal("the draft wasn't switched")
+	}
+	if input.GetText() != "" || !input.HasDraft("C1") {
+		t.Errorf("got %q, want an empty Input and a draft of C1", input.GetText())
+	}
+
+	// The draft that is shown is stored as well
+	input.SetText("world")
+	drafts := input.AllDrafts()
+	if drafts["C1"].Text != "hello" || drafts["C2"].Text != "world" {
+		t.Errorf("got drafts %v, want the drafts of C1 and C2", drafts)
+	}
+
+	input.SwitchDraft("C1")
+	if input.GetText() != "hello" || input.HasDraft("C1") || !input.HasDraft("C2") {
+		t.Errorf("got %q, want the draft of C1 restored", input.GetText())
+	}
+
+	// Threads are drafts of their channel
+	input.SwitchDraft("C1/1500000000.000100")
+	if !input.HasDraft("C1") {
+		t.Error("the draft of C1 isn't kept")
+	}
+
+	// An empty Input removes the draft
+	input.SetText("")
+	input.SwitchDraft("C3")
+	if _, ok := input.Drafts["C1/1500000000.000100"]; ok {
+		t.Error("an empty draft is kept")
+	}
+}
+
+func TestInputIsBrowsingHistory(t *testing.T) {
+	input := newTestInput("")
+	input.AddHistory("C1", "hello")
+
+	if input.IsBrowsingHistory() {
+		t.Fatal("the History is browsed before it is recalled")
+	}
+
+	input.HistoryPrev("C1")
+	if !input.IsBrowsingHistory() {
+		t.Error("the History isn't browsed after it is recalled")
+	}
+
+	input.HistoryNext("C1")
+	if input.IsBrowsingHistory() {
+		t.Error("the History is browsed after the typed text is shown again")
+	}
+}
@@ -20,8 +20,56 @@ var (
 	}
 )
 
+// Reaction is an emoji reaction on a message, Name is the shortcode of the
+// emoji without colons, and Users are the users that reacted with it
+type Reaction struct {
+	Name  string
+	Count int
+	Users []string
+}
+
+// HasUser returns true when userID is one of the users that reacted
+func (r Reaction) HasUser(userID string) bool {
+	for _, user := range r.Users {
+		if user == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// File is a file that is shared in a message, URL can only be downloaded
+// with the token of the workspace, unless the file is External, like the
+// image of a link unfurl. Thumb is the URL of a smaller version of an image.
+type File struct {
+	ID       string
+	Name     string
+	Title    string
+	Mimetype string
+	Filetype string
+	Size     int
+	URL      string
+	Thumb    string
+	External bool
+}
+
+// IsText returns true when the file is a text file, like a snippet
+func (f File) IsText() bool {
+	return strings.HasPrefix(f.Mimetype, "text/") || f.Filetype == "text"
+}
+
+// IsImage returns true when the file is an image that can be previewed
+func (f File) IsImage() bool {
+	switch f.Mimetype {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
 type Message struct {
 	ID       string
+	UserID   string
 	Messages map[string]Message
 
 	Time    time.Time
@@ -29,12 +77,31 @@ type Message struct {
 	Name    string
 	Content string
 
+	// Text is the text of the message as it was typed, it is used when
+	// the message is edited. Content is the text as it is shown.
+	Text string
+
+	Reactions []Reaction
+	Files     []File
+
+	// Image is previewed under the content, when image previews are
+	// enabled and the preview has been loaded
+	Image *File
+
 	StyleTime   string
 	StyleThread string
 	StyleName   string
 	StyleText   string
 
+	// StyleBar is the style of the bar in front of the lines of an
+	// attachment, there is no bar when it is empty
+	StyleBar string
+
 	FormatTime string
+
+	// Raw is the message as it was decoded by the slack library, encoded
+	// as JSON again. Fields the library doesn't know about are missing.
+	Raw []byte
 }
 
 func (m Message) GetTime() string {
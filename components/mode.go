@@ -1,6 +1,9 @@
 package components
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/erroneousboat/termui"
 )
 
@@ -8,6 +11,10 @@ const (
 	CommandMode = "NORMAL"
 	InsertMode  = "INSERT"
 	SearchMode  = "SEARCH"
+	EditMode    = "EDIT"
+	PickerMode  = "PICK"
+	ViewerMode  = "VIEW"
+	SelectMode  = "SELECT"
 )
 
 // Mode is the definition of Mode component
@@ -100,7 +107,55 @@ func (m *Mode) SetCommandMode() {
 	termui.Render(m)
 }
 
+func (m *Mode) SetEditMode() {
+	m.Par.Text = EditMode
+	termui.Render(m)
+}
+
+func (m *Mode) SetPickerMode() {
+	m.Par.Text = PickerMode
+	termui.Render(m)
+}
+
+func (m *Mode) SetViewerMode() {
+	m.Par.Text = ViewerMode
+	termui.Render(m)
+}
+
 func (m *Mode) SetSearchMode() {
 	m.Par.Text = SearchMode
 	termui.Render(m)
 }
+
+func (m *Mode) SetSelectMode() {
+	m.Par.Text = SelectMode
+	termui.Render(m)
+}
+
+// SetConnected will show the latency of the connection in the border of
+// the Mode component, when it isn't measured yet it will show that we're
+// connected
+func (m *Mode) SetConnected(latency time.Duration) {
+	m.Par.BorderLabel = "connected"
+	if latency > 0 {
+		m.Par.BorderLabel = fmt.Sprintf("%dms", latency/time.Millisecond)
+	}
+	m.Par.BorderLabelFg = termui.ColorGreen
+}
+
+// SetConnecting will show that we're (re)connecting in the border of the
+// Mode component
+func (m *Mode) SetConnecting(attempt int) {
+	m.Par.BorderLabel = "connecting"
+	if attempt > 1 {
+		m.Par.BorderLabel = fmt.Sprintf("connecting (%d)", attempt)
+	}
+	m.Par.BorderLabelFg = termui.ColorYellow
+}
+
+// SetDisconnected will show that there is no connection in the border of
+// the Mode component
+func (m *Mode) SetDisconnected() {
+	m.Par.BorderLabel = "offline"
+	m.Par.BorderLabelFg = termui.ColorRed
+}
@@ -0,0 +1,317 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/erroneousboat/termui"
+	runewidth "github.com/mattn/go-runewidth"
+
+	"github.com/erroneousboat/slack-term/config"
+)
+
+// colorMask are the bits of a termui.Attribute that hold the color, the
+// rest are attributes like bold and underline
+const colorMask = 0x1FF
+
+// Style is the foreground and background of a piece of text
+type Style struct {
+	Fg termui.Attribute
+	Bg termui.Attribute
+}
+
+// NewStyle converts a style of the theme, like "fg-red,fg-bold,bg-black",
+// to a Style
+func NewStyle(style string) Style {
+	// Hack, in order to get the correct fg and bg attributes. This is
+	// because the readAttr function in termui is unexported.
+	cells := termui.DefaultTxBuilder.Build(
+		fmt.Sprintf("[.](%s)", style),
+		termui.ColorDefault, termui.ColorDefault,
+	)
+	if len(cells) == 0 {
+		return Style{}
+	}
+
+	return Style{Fg: cells[0].Fg, Bg: cells[0].Bg}
+}
+
+// Over returns the style on top of base, the colors of s replace those of
+// base when they're set, and the attributes of both are combined
+func (s Style) Over(base Style) Style {
+	merge := func(top, bottom termui.Attribute) termui.Attribute {
+		if top&colorMask == 0 {
+			return bottom | top
+		}
+		return (bottom &^ colorMask) | top
+	}
+
+	return Style{
+		Fg: merge(s.Fg, base.Fg),
+		Bg: merge(s.Bg, base.Bg),
+	}
+}
+
+// MrkdwnStyle holds the styles of the elements of the mrkdwn format of slack
+type MrkdwnStyle struct {
+	Bold      Style
+	Italic    Style
+	Strike    Style
+	Code      Style
+	CodeBlock Style
+	Quote     Style
+}
+
+// NewMrkdwnStyle creates the MrkdwnStyle from the message theme
+func NewMrkdwnStyle(theme config.Message) MrkdwnStyle {
+	return MrkdwnStyle{
+		Bold:      NewStyle(theme.Bold),
+		Italic:    NewStyle(theme.Italic),
+		Strike:    NewStyle(theme.Strike),
+		Code:      NewStyle(theme.Code),
+		CodeBlock: NewStyle(theme.CodeBlock),
+		Quote:     NewStyle(theme.Quote),
+	}
+}
+
+// mrkdwnParser converts mrkdwn to termui.Cell, width is the width of the
+// Chat pane, which is used to wrap code blocks
+type mrkdwnParser struct {
+	style MrkdwnStyle
+	base  Style
+	width int
+	cells []termui.Cell
+}
+
+// MrkdwnToCells will convert text in the mrkdwn format of slack to
+// termui.Cell. The markers of *bold*, _italic_, ~strike~ and `code` are
+// removed and the text between them is styled. Lines starting with > are
+// shown as a quote, and ```code blocks``` get their own background. Lines of
+// code blocks that don't fit in width are wrapped, and keep their
+// indentation.
+//
+// https://api.slack.com/reference/surfaces/formatting#basics
+func MrkdwnToCells(text string, base Style, style MrkdwnStyle, width int) []termui.Cell {
+	p := &mrkdwnParser{
+		style: style,
+		base:  base,
+		width: width,
+	}
+
+	// Code blocks are taken out first, their content isn't formatted
+	for {
+		start := strings.Index(text, "```")
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(text[start+3:], "```")
+		if end < 0 {
+			break
+		}
+		end += start + 3
+
+		p.text(text[:start])
+		p.codeBlock(text[start+3 : end])
+		text = text[end+3:]
+
+		// The code block ends the line
+		text = strings.TrimPrefix(text, "\n")
+		if text != "" {
+			p.newline()
+		}
+	}
+	p.text(text)
+
+	return p.cells
+}
+
+// text will add the lines of text, that are outside of code blocks
+func (p *mrkdwnParser) text(text string) {
+	quoteAll := false
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			p.newline()
+		}
+
+		// >>> quotes the rest of the text
+		if strings.HasPrefix(line, ">>>") {
+			quoteAll = true
+			line = strings.TrimPrefix(strings.TrimPrefix(line, ">>>"), " ")
+		}
+
+		if quoteAll || strings.HasPrefix(line, ">") {
+			if !quoteAll {
+				line = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+			}
+
+			quote := p.style.Quote.Over(p.base)
+			p.add("▎ ", quote)
+			p.inline(line, quote)
+			continue
+		}
+
+		p.inline(line, p.base)
+	}
+}
+
+// inline will add a line of text, with the styles of the inline markers
+func (p *mrkdwnParser) inline(line string, base Style) {
+	runes := []rune(line)
+
+	var bold, italic, strike bool
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch r {
+		case '`':
+			// Inline code is shown as is
+			if end := indexRune(runes, '`', i+1); end > i+1 {
+				p.add(string(runes[i+1:end]), p.style.Code.Over(base))
+				i = end
+				continue
+			}
+		case '*', '_', '~':
+			active := map[rune]*bool{'*': &bold, '_': &italic, '~': &strike}[r]
+			if *active && canClose(runes, i) {
+				*active = false
+				continue
+			}
+			if !*active && canOpen(runes, i) && findClose(runes, r, i+1) > 0 {
+				*active = true
+				continue
+			}
+		}
+
+		style := base
+		if bold {
+			style = p.style.Bold.Over(style)
+		}
+		if italic {
+			style = p.style.Italic.Over(style)
+		}
+		if strike {
+			style = p.style.Strike.Over(style)
+		}
+
+		p.cells = append(p.cells, termui.Cell{Ch: r, Fg: style.Fg, Bg: style.Bg})
+	}
+}
+
+// codeBlock will add the lines of a code block, every line is filled up to
+// the width of the longest line, so the background forms a block
+func (p *mrkdwnParser) codeBlock(code string) {
+	code = strings.TrimPrefix(code, "\n")
+	code = strings.TrimSuffix(code, "\n")
+	code = strings.Replace(code, "\t", "    ", -1)
+
+	style := p.style.CodeBlock.Over(p.base)
+
+	// A code block starts on its own line, also when it is at the start
+	// of a message, otherwise it would follow the name of the user
+	if len(p.cells) == 0 || p.cells[len(p.cells)-1].Ch != '\n' {
+		p.newline()
+	}
+
+	// Wrap the lines that don't fit, the part that is wrapped gets the
+	// indentation of the line. One cell of padding is kept on both sides.
+	var lines []string
+	for _, line := range strings.Split(code, "\n") {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		if p.width < 3 || len(indent) > (p.width-2)/2 {
+			indent = ""
+		}
+
+		for p.width >= 3 && runewidth.StringWidth(line) > p.width-2 {
+			i := wrapIndex(line, p.width-2)
+			lines = append(lines, line[:i])
+			line = indent + line[i:]
+		}
+		lines = append(lines, line)
+	}
+
+	blockWidth := 0
+	for _, line := range lines {
+		if w := runewidth.StringWidth(line); w > blockWidth {
+			blockWidth = w
+		}
+	}
+
+	for i, line := range lines {
+		if i > 0 {
+			p.newline()
+		}
+
+		p.add(" "+line, style)
+		p.add(strings.Repeat(" ", blockWidth-runewidth.StringWidth(line)+1), style)
+	}
+}
+
+func (p *mrkdwnParser) add(text string, style Style) {
+	for _, r := range text {
+		p.cells = append(p.cells, termui.Cell{Ch: r, Fg: style.Fg, Bg: style.Bg})
+	}
+}
+
+func (p *mrkdwnParser) newline() {
+	p.cells = append(p.cells, termui.Cell{Ch: '\n'})
+}
+
+// canOpen returns true when the marker at i can start formatted text, it
+// needs to be at the start of a word and followed by text
+func canOpen(runes []rune, i int) bool {
+	if i > 0 && isWordRune(runes[i-1]) {
+		return false
+	}
+	return i+1 < len(runes) && !unicode.IsSpace(runes[i+1])
+}
+
+// canClose returns true when the marker at i can end formatted text, it
+// needs to be at the end of a word
+func canClose(runes []rune, i int) bool {
+	if i == 0 || unicode.IsSpace(runes[i-1]) {
+		return false
+	}
+	return i+1 == len(runes) || !isWordRune(runes[i+1])
+}
+
+// findClose returns the index of the marker that closes the one that is
+// opened before start, or -1 when there is none
+func findClose(runes []rune, marker rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == marker && i > start && canClose(runes, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexRune(runes []rune, r rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wrapIndex returns the byte index at which s has to be wrapped to fit
+// within width
+func wrapIndex(s string, width int) int {
+	w := 0
+	for i, r := range s {
+		w += runewidth.RuneWidth(r)
+		if w > width {
+			if i == 0 {
+				return len(string(r))
+			}
+			return i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,100 @@
+package components
+
+import (
+	"testing"
+
+	"github.com/erroneousboat/termui"
+)
+
+// testMrkdwnStyle gives every element of mrkdwn a style of its own, so the
+// cells show which element they belong to, see styleCode
+var testMrkdwnStyle = MrkdwnStyle{
+	Bold:      Style{Fg: termui.AttrBold},
+	Italic:    Style{Fg: termui.AttrUnderline},
+	Strike:    Style{Fg: termui.AttrReverse},
+	Code:      Style{Fg: termui.ColorRed},
+	CodeBlock: Style{Bg: termui.ColorBlack},
+	Quote:     Style{Fg: termui.ColorCyan},
+}
+
+// styleCode returns a letter for the element of mrkdwn the cell belongs to,
+// or a dot for plain text
+func styleCode(cell termui.Cell) rune {
+	switch {
+	case cell.Ch == '\n':
+		return '\n'
+	case cell.Bg == termui.ColorBlack:
+		return 'k'
+	case cell.Fg&colorMask == termui.ColorRed:
+		return 'c'
+	case cell.Fg&colorMask == termui.ColorCyan:
+		return 'q'
+	case cell.Fg&termui.AttrBold != 0:
+		return 'b'
+	case cell.Fg&termui.AttrUnderline != 0:
+		return 'i'
+	case cell.Fg&termui.AttrReverse != 0:
+		return 's'
+	}
+	return '.'
+}
+
+func TestMrkdwnToCells(t *testing.T) {
+	tests := []struct {
+		text      string
+		width     int
+		wantText  string
+		wantStyle string
+	}{
+		{"plain", 80, "plain", "....."},
+		{"*bold* text", 80, "bold text", "bbbb....."},
+		{"_italic_", 80, "italic", "iiiiii"},
+		{"~gone~", 80, "gone", "ssss"},
+		{"run `go *test*` now", 80, "run go *test* now", "....ccccccccc...."},
+		{"a*b*c", 80, "a*b*c", "....."},
+		{"2 * 3 * 4", 80, "2 * 3 * 4", "........."},
+		{"*unclosed", 80, "*unclosed", "........."},
+		{"> quoted", 80, "▎ quoted", "qqqqqqqq"},
+		{">>> a\nb", 80, "▎ a\n▎ b", "qqq\nqqq"},
+		{"x```code```", 80, "x\n code ", ".\nkkkkkk"},
+		{"```aaaaaaaaaa```", 8, "\n aaaaaa \n aaaa   ", "\nkkkkkkkk\nkkkkkkkk"},
+		{"```a\n  bbbbbbbb```", 8, "\n a      \n   bbbb \n   bbbb ", "\nkkkkkkkk\nkkkkkkkk\nkkkkkkkk"},
+	}
+
+	for _, test := range tests {
+		cells := MrkdwnToCells(test.text, Style{}, testMrkdwnStyle, test.width)
+
+		var text, style []rune
+		for _, cell := range cells {
+			text = append(text, cell.Ch)
+			style = append(style, styleCode(cell))
+		}
+
+		if string(text) != test.wantText {
+			t.Errorf("MrkdwnToCells(%q) = %q, want %q", test.text, string(text), test.wantText)
+		}
+		if string(style) != test.wantStyle {
+			t.Errorf("MrkdwnToCells(%q) styled %q, want %q", test.text, string(style), test.wantStyle)
+		}
+	}
+}
+
+func TestStyleOver(t *testing.T) {
+	base := Style{Fg: termui.ColorGreen | termui.AttrBold, Bg: termui.ColorBlue}
+
+	tests := []struct {
+		style Style
+		want  Style
+	}{
+		{Style{}, base},
+		{Style{Fg: termui.AttrUnderline}, Style{Fg: termui.ColorGreen | termui.AttrBold | termui.AttrUnderline, Bg: termui.ColorBlue}},
+		{Style{Fg: termui.ColorRed}, Style{Fg: termui.ColorRed | termui.AttrBold, Bg: termui.ColorBlue}},
+		{Style{Bg: termui.ColorBlack}, Style{Fg: termui.ColorGreen | termui.AttrBold, Bg: termui.ColorBlack}},
+	}
+
+	for _, test := range tests {
+		if got := test.style.Over(base); got != test.want {
+			t.Errorf("%+v over %+v = %+v, want %+v", test.style, base, got, test.want)
+		}
+	}
+}
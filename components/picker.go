@@ -0,0 +1,164 @@
+package components
+
+import (
+	"sort"
+
+	"github.com/erroneousboat/termui"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+// PickerItem is an item that can be picked, Label is what is shown in the
+// Picker and matched against, Value is what is returned
+type PickerItem struct {
+	Label string
+	Value string
+}
+
+// Picker is the definition of a Picker component, it shows the items that
+// fuzzy match the text typed in the Input component in a popup above it
+type Picker struct {
+	List     *termui.List
+	Items    []PickerItem
+	Matches  []PickerItem
+	Selected int
+	Term     string
+}
+
+// CreatePickerComponent is the constructor of the Picker struct
+func CreatePickerComponent() *Picker {
+	picker := &Picker{
+		List: termui.NewList(),
+	}
+
+	picker.List.Height = 12
+
+	return picker
+}
+
+// Buffer implements interface termui.Bufferer
+func (p *Picker) Buffer() termui.Buffer {
+	buf := p.List.Buffer()
+
+	// Scroll so the selected item stays in view
+	height := p.List.InnerBounds().Dy()
+	offset := 0
+	if p.Selected >= height {
+		offset = p.Selected - height + 1
+	}
+
+	y := p.List.InnerBounds().Min.Y
+	for i := offset; i < len(p.Matches) && y < p.List.InnerBounds().Max.Y; i++ {
+		fg, bg := p.List.ItemFgColor, p.List.ItemBgColor
+		if i == p.Selected {
+			fg |= termui.AttrReverse
+		}
+
+		x := p.List.InnerBounds().Min.X
+		for _, r := range p.Matches[i].Label {
+			cell := termui.Cell{Ch: r, Fg: fg, Bg: bg}
+			if x+cell.Width() > p.List.InnerBounds().Max.X {
+				break
+			}
+			buf.Set(x, y, cell)
+			x += cell.Width()
+		}
+
+		// Fill up the line, so the selected item is highlighted across
+		// the width of the Picker
+		for x < p.List.InnerBounds().Max.X {
+			buf.Set(x, y, termui.Cell{Ch: ' ', Fg: fg, Bg: bg})
+			x++
+		}
+		y++
+	}
+
+	return buf
+}
+
+// GetHeight implements interface termui.GridBufferer
+func (p *Picker) GetHeight() int {
+	return p.List.Block.GetHeight()
+}
+
+// SetWidth implements interface termui.GridBufferer
+func (p *Picker) SetWidth(w int) {
+	p.List.SetWidth(w)
+}
+
+// SetX implements interface termui.GridBufferer
+func (p *Picker) SetX(x int) {
+	p.List.SetX(x)
+}
+
+// SetY implements interface termui.GridBufferer
+func (p *Picker) SetY(y int) {
+	p.List.SetY(y)
+}
+
+// SetItems will set the items that can be picked, and resets the filter
+func (p *Picker) SetItems(items []PickerItem) {
+	p.Items = items
+	p.Term = ""
+	p.Matches = items
+	p.Selected = 0
+}
+
+// Filter will only keep the items that fuzzy match term, sorted by how well
+// they match. The selection is reset when the term has changed.
+func (p *Picker) Filter(term string) {
+	if term == p.Term && p.Matches != nil {
+		return
+	}
+	p.Term = term
+	p.Selected = 0
+
+	// Without a term every item matches, in the order they were set
+	if term == "" {
+		p.Matches = p.Items
+		return
+	}
+
+	targets := make([]string, 0, len(p.Items))
+	for _, item := range p.Items {
+		targets = append(targets, item.Label)
+	}
+
+	ranks := fuzzy.RankFindFold(term, targets)
+	sort.Stable(ranks)
+
+	p.Matches = make([]PickerItem, 0, len(ranks))
+	for _, rank := range ranks {
+		p.Matches = append(p.Matches, p.Items[rank.OriginalIndex])
+	}
+}
+
+// MoveCursorUp will select the previous match
+func (p *Picker) MoveCursorUp() {
+	if p.Selected > 0 {
+		p.Selected--
+	}
+}
+
+// MoveCursorDown will select the next match
+func (p *Picker) MoveCursorDown() {
+	if p.Selected < len(p.Matches)-1 {
+		p.Selected++
+	}
+}
+
+// MoveCursorNext will select the next match, after the last match the
+// first one is selected again
+func (p *Picker) MoveCursorNext() {
+	if len(p.Matches) > 0 {
+		p.Selected = (p.Selected + 1) % len(p.Matches)
+	}
+}
+
+// GetSelected returns the match that is selected, it returns false when
+// nothing matches
+func (p *Picker) GetSelected() (PickerItem, bool) {
+	if p.Selected >= len(p.Matches) {
+		return PickerItem{}, false
+	}
+	return p.Matches[p.Selected], true
+}
@@ -0,0 +1,76 @@
+package components
+
+import (
+	"fmt"
+	"testing"
+)
+
+// values returns the value of every match of the Picker
+func values(p *Picker) []string {
+	var values []string
+	for _, item := range p.Matches {
+		values = append(values, item.Value)
+	}
+	return values
+}
+
+func TestPickerFilter(t *testing.T) {
+	picker := CreatePickerComponent()
+	picker.SetItems([]PickerItem{
+		{Label: ":thumbsup:", Value: "thumbsup"},
+		{Label: ":tada:", Value: "tada"},
+		{Label: ":thinking_face:", Value: "thinking_face"},
+		{Label: ":taco:", Value: "taco"},
+	})
+
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"", "[thumbsup tada thinking_face taco]"},
+		{"ta", "[tada taco thinking_face]"},
+		{"TA", "[tada taco thinking_face]"},
+		{"thf", "[thinking_face]"},
+		{"xyz", "[]"},
+	}
+
+	for _, test := range tests {
+		picker.Filter(test.term)
+		if got := fmt.Sprint(values(picker)); got != test.want {
+			t.Errorf("Filter(%q) = %s, want %s", test.term, got, test.want)
+		}
+	}
+}
+
+func TestPickerSelection(t *testing.T) {
+	picker := CreatePickerComponent()
+	picker.SetItems([]PickerItem{
+		{Label: "one", Value: "1"},
+		{Label: "two", Value: "2"},
+		{Label: "three", Value: "3"},
+	})
+
+	picker.MoveCursorDown()
+	picker.MoveCursorDown()
+	picker.MoveCursorDown()
+	if item, _ := picker.GetSelected(); item.Value != "3" {
+		t.Errorf("got %s selected, want the last item", item.Value)
+	}
+
+	picker.MoveCursorNext()
+	if item, _ := picker.GetSelected(); item.Value != "1" {
+		t.Errorf("got %s selected, want the first item after the last", item.Value)
+	}
+
+	// The selection is reset when the term changes
+	picker.MoveCursorDown()
+	picker.Filter("t")
+	if picker.Selected != 0 {
+		t.Errorf("got %d selected, want 0 after filtering", picker.Selected)
+	}
+
+	picker.Filter("none")
+	if _, ok := picker.GetSelected(); ok {
+		t.Error("got a selection while nothing matches")
+	}
+}
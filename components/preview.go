@@ -0,0 +1,192 @@
+package components
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+
+	// Register the decoders of the image formats slack can preview
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/erroneousboat/termui"
+)
+
+// Preview is an image that is shown in the Chat pane. Every cell shows two
+// pixels with the upper half block character, the foreground is the color
+// of the upper pixel and the background the color of the lower pixel.
+//
+// The colors are those of the 256 color palette, so the terminal needs to
+// be in termbox.Output256 mode.
+type Preview struct {
+	Width  int
+	Height int
+	Pixels []termui.Attribute
+}
+
+// NewPreview decodes data, a png, jpeg or gif image, and scales it down so it
+// fits within cols by rows cells
+func NewPreview(data []byte, cols int, rows int) (*Preview, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, image.ErrFormat
+	}
+
+	// Keep the aspect ratio, a cell is two pixels high
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > cols {
+		height = height * cols / width
+		width = cols
+	}
+	if height > rows*2 {
+		width = width * rows * 2 / height
+		height = rows * 2
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	preview := &Preview{
+		Width:  width,
+		Height: height,
+		Pixels: make([]termui.Attribute, width*height),
+	}
+
+	// Every pixel of the preview gets the average color of the pixels of
+	// the image it covers
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+					r += uint32(c.R)
+					g += uint32(c.G)
+					b += uint32(c.B)
+					a += uint32(c.A)
+					n++
+				}
+			}
+
+			// Transparent pixels show the background of the
+			// terminal
+			if a/n < 128 {
+				preview.Pixels[y*width+x] = termui.ColorDefault
+				continue
+			}
+
+			preview.Pixels[y*width+x] = colorToAttribute(r/n, g/n, b/n)
+		}
+	}
+
+	return preview, nil
+}
+
+// Cells will convert the Preview to termui.Cell, scaled down when it is
+// wider than cols. Rows are separated by a newline cell.
+func (p *Preview) Cells(cols int) []termui.Cell {
+	width, height := p.Width, p.Height
+	if cols > 0 && width > cols {
+		height = height * cols / width
+		width = cols
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	pixel := func(x, y int) termui.Attribute {
+		if y >= height {
+			return termui.ColorDefault
+		}
+		return p.Pixels[(y*p.Height/height)*p.Width+x*p.Width/width]
+	}
+
+	cells := make([]termui.Cell, 0, (width+1)*(height+1)/2)
+	for y := 0; y < height; y += 2 {
+		if y > 0 {
+			cells = append(cells, termui.Cell{Ch: '\n'})
+		}
+
+		for x := 0; x < width; x++ {
+			cells = append(cells, termui.Cell{
+				Ch: '▀',
+				Fg: pixel(x, y),
+				Bg: pixel(x, y+1),
+			})
+		}
+	}
+
+	return cells
+}
+
+// colorToAttribute returns the color of the 256 color palette that is
+// closest to the rgb color, either from the 6x6x6 color cube or from the
+// grayscale ramp
+func colorToAttribute(r, g, b uint32) termui.Attribute {
+	levels := []uint32{0, 95, 135, 175, 215, 255}
+
+	nearest := func(v uint32) int {
+		best := 0
+		for i, l := range levels {
+			if diff(v, l) < diff(v, levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	ri, gi, bi := nearest(r), nearest(g), nearest(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := distance(r, g, b, levels[ri], levels[gi], levels[bi])
+
+	// The grayscale ramp goes from 8 to 238 in steps of 10
+	avg := (r + g + b) / 3
+	gray := 0
+	if avg > 8 {
+		gray = int((avg - 8 + 5) / 10)
+	}
+	if gray > 23 {
+		gray = 23
+	}
+	level := uint32(8 + 10*gray)
+	grayDist := distance(r, g, b, level, level, level)
+
+	// Attributes of termbox start at 1 for the first color of the palette
+	if grayDist < cubeDist {
+		return termui.Attribute(232 + gray + 1)
+	}
+	return termui.Attribute(cube + 1)
+}
+
+func diff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func distance(r1, g1, b1, r2, g2, b2 uint32) uint32 {
+	dr, dg, db := diff(r1, r2), diff(g1, g2), diff(b1, b2)
+	return dr*dr + dg*dg + db*db
+}
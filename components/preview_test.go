@@ -0,0 +1,132 @@
+package components
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/erroneousboat/termui"
+)
+
+// encodePNG returns the png of an image of width by height, the pixels are
+// colored by fill
+func encodePNG(t *testing.T, width int, height int, fill func(x, y int) color.Color) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill(x, y))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewPreviewSize(t *testing.T) {
+	tests := []struct {
+		width, height int
+		cols, rows    int
+		wantWidth     int
+		wantHeight    int
+	}{
+		{4, 4, 80, 10, 4, 4},
+		{40, 20, 10, 10, 10, 5},
+		{10, 100, 80, 5, 1, 10},
+		{200, 1, 20, 10, 20, 1},
+	}
+
+	for _, test := range tests {
+		data := encodePNG(t, test.width, test.height, func(x, y int) color.Color {
+			return color.White
+		})
+
+		preview, err := NewPreview(data, test.cols, test.rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preview.Width != test.wantWidth || preview.Height != test.wantHeight {
+			t.Errorf(
+				"%dx%d in %dx%d cells: got %dx%d, want %dx%d",
+				test.width, test.height, test.cols, test.rows,
+				preview.Width, preview.Height, test.wantWidth, test.wantHeight,
+			)
+		}
+	}
+}
+
+func TestNewPreviewInvalid(t *testing.T) {
+	if _, err := NewPreview([]byte("not an image"), 80, 10); err == nil {
+		t.Error("got a preview of data that isn't an image")
+	}
+}
+
+func TestPreviewCells(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+
+	// A red row, a blue row and a transparent row
+	data := encodePNG(t, 2, 3, func(x, y int) color.Color {
+		switch y {
+		case 0:
+			return red
+		case 1:
+			return blue
+		}
+		return color.Transparent
+	})
+
+	preview, err := NewPreview(data, 80, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redAttr, blueAttr := colorToAttribute(255, 0, 0), colorToAttribute(0, 0, 255)
+
+	// Every cell shows two rows of pixels, the upper one in the foreground
+	want := []termui.Cell{
+		{Ch: '▀', Fg: redAttr, Bg: blueAttr},
+		{Ch: '▀', Fg: redAttr, Bg: blueAttr},
+		{Ch: '\n'},
+		{Ch: '▀', Fg: termui.ColorDefault, Bg: termui.ColorDefault},
+		{Ch: '▀', Fg: termui.ColorDefault, Bg: termui.ColorDefault},
+	}
+
+	cells := preview.Cells(80)
+	if len(cells) != len(want) {
+		t.Fatalf("got %d cells, want %d", len(cells), len(want))
+	}
+	for i := range want {
+		if cells[i] != want[i] {
+			t.Errorf("cell %d: got %+v, want %+v", i, cells[i], want[i])
+		}
+	}
+
+	// A narrower Chat pane scales the preview down
+	if cells := preview.Cells(1); len(cells) != 1 {
+		t.Errorf("got %d cells in 1 column, want 1", len(cells))
+	}
+}
+
+func TestColorToAttribute(t *testing.T) {
+	tests := []struct {
+		r, g, b uint32
+		want    termui.Attribute
+	}{
+		{0, 0, 0, 17},
+		{255, 255, 255, 232},
+		{255, 0, 0, 197},
+		{0, 0, 255, 22},
+		{128, 128, 128, 245},
+	}
+
+	for _, test := range tests {
+		if got := colorToAttribute(test.r, test.g, test.b); got != test.want {
+			t.Errorf("colorToAttribute(%d, %d, %d) = %d, want %d", test.r, test.g, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package components
+
+import (
+	"strings"
+
+	"github.com/erroneousboat/termui"
+	runewidth "github.com/mattn/go-runewidth"
+)
+
+// Viewer is the definition of a Viewer component, it shows a text, like the
+// content of a snippet, in place of the Chat pane. Long lines are wrapped,
+// and the text can be scrolled.
+type Viewer struct {
+	List   *termui.List
+	Lines  []string
+	Offset int
+}
+
+// CreateViewerComponent is the constructor of the Viewer struct
+func CreateViewerComponent() *Viewer {
+	viewer := &Viewer{
+		List: termui.NewList(),
+	}
+
+	return viewer
+}
+
+// Buffer implements interface termui.Bufferer
+func (v *Viewer) Buffer() termui.Buffer {
+	buf := v.List.Buffer()
+
+	lines := v.wrap()
+
+	// Protect overscrolling
+	if max := len(lines) - v.List.InnerBounds().Dy(); v.Offset > max {
+		v.Offset = max
+	}
+	if v.Offset < 0 {
+		v.Offset = 0
+	}
+
+	y := v.List.InnerBounds().Min.Y
+	for i := v.Offset; i < len(lines) && y < v.List.InnerBounds().Max.Y; i++ {
+		x := v.List.InnerBounds().Min.X
+		for _, r := range lines[i] {
+			cell := termui.Cell{
+				Ch: r,
+				Fg: v.List.ItemFgColor,
+				Bg: v.List.ItemBgColor,
+			}
+			buf.Set(x, y, cell)
+			x += cell.Width()
+		}
+		y++
+	}
+
+	return buf
+}
+
+// GetHeight implements interface termui.GridBufferer
+func (v *Viewer) GetHeight() int {
+	return v.List.Block.GetHeight()
+}
+
+// SetWidth implements interface termui.GridBufferer
+func (v *Viewer) SetWidth(w int) {
+	v.List.SetWidth(w)
+}
+
+// SetX implements interface termui.GridBufferer
+func (v *Viewer) SetX(x int) {
+	v.List.SetX(x)
+}
+
+// SetY implements interface termui.GridBufferer
+func (v *Viewer) SetY(y int) {
+	v.List.SetY(y)
+}
+
+// SetText will show text in the Viewer, title is shown in the border
+func (v *Viewer) SetText(title string, text string) {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\t", "    ", -1)
+
+	v.Lines = strings.Split(text, "\n")
+	v.Offset = 0
+	v.List.BorderLabel = title
+}
+
+// ScrollUp will scroll the text up by n lines
+func (v *Viewer) ScrollUp(n int) {
+	v.Offset -= n
+	if v.Offset < 0 {
+		v.Offset = 0
+	}
+}
+
+// ScrollDown will scroll the text down by n lines, the Buffer makes sure
+// we don't scroll past the end
+func (v *Viewer) ScrollDown(n int) {
+	v.Offset += n
+}
+
+// ScrollTop will scroll to the start of the text
+func (v *Viewer) ScrollTop() {
+	v.Offset = 0
+}
+
+// ScrollBottom will scroll to the end of the text
+func (v *Viewer) ScrollBottom() {
+	v.Offset = len(v.wrap())
+}
+
+// GetPageSize returns the number of lines that fit in the Viewer
+func (v *Viewer) GetPageSize() int {
+	return v.List.InnerBounds().Dy()
+}
+
+// wrap returns the lines as they fit within the width of the Viewer
+func (v *Viewer) wrap() []string {
+	width := v.List.InnerBounds().Dx()
+	if width < 1 {
+		return v.Lines
+	}
+
+	var lines []string
+	for _, line := range v.Lines {
+		for runewidth.StringWidth(line) > width {
+			var w, i int
+			for j, r := range line {
+				if w+runewidth.RuneWidth(r) > width {
+					i = j
+					break
+				}
+				w += runewidth.RuneWidth(r)
+			}
+			if i == 0 {
+				break
+			}
+			lines = append(lines, line[:i])
+			line = line[i:]
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	fp "path/filepath"
+	"strings"
 
 	"github.com/OpenPeeDeeP/xdg"
 	"github.com/erroneousboat/termui"
@@ -15,11 +16,25 @@ import (
 const (
 	NotifyAll     = "all"
 	NotifyMention = "mention"
+
+	TransportRTM        = "rtm"
+	TransportSocketMode = "socketmode"
 )
 
 // Config is the definition of a Config struct
 type Config struct {
 	SlackToken   string                `json:"slack_token"`
+	AppToken     string                `json:"app_token"`
+	Transport    string                `json:"transport"`
+	APIURL       string                `json:"api_url"`
+	Workspaces   []Workspace           `json:"workspaces"`
+	CacheDir     string                `json:"cache_dir"`
+	DownloadDir  string                `json:"download_dir"`
+	OpenCommand  string                `json:"open_command"`
+	CopyCommand  string                `json:"copy_command"`
+	ImagePreview bool                  `json:"image_preview"`
+	ImageHeight  int                   `json:"image_height"`
+	ImageMaxSize int                   `json:"image_max_size"`
 	Notify       string                `json:"notify"`
 	Emoji        bool                  `json:"emoji"`
 	SidebarWidth int                   `json:"sidebar_width"`
@@ -31,6 +46,16 @@ type Config struct {
 
 type keyMapping map[string]string
 
+// Workspace is the definition of a slack workspace, when no workspaces are
+// defined in the config file, the tokens and transport of the Config are
+// used as the only workspace.
+type Workspace struct {
+	Name       string `json:"name"`
+	SlackToken string `json:"slack_token"`
+	AppToken   string `json:"app_token"`
+	Transport  string `json:"transport"`
+}
+
 // NewConfig loads the config file and returns a Config struct
 func NewConfig(filepath string) (*Config, error) {
 	cfg := getDefaultConfig()
@@ -55,6 +80,10 @@ func NewConfig(filepath string) (*Config, error) {
 
 	cfg.MainWidth = 12 - cfg.SidebarWidth
 
+	if cfg.ImageHeight < 1 {
+		return &cfg, errors.New("please specify an 'image_height' of at least 1")
+	}
+
 	switch cfg.Notify {
 	case NotifyAll, NotifyMention, "":
 		break
@@ -62,6 +91,42 @@ func NewConfig(filepath string) (*Config, error) {
 		return &cfg, fmt.Errorf("unsupported setting for notify: %s", cfg.Notify)
 	}
 
+	switch cfg.Transport {
+	case TransportRTM, TransportSocketMode:
+		break
+	default:
+		return &cfg, fmt.Errorf("unsupported setting for transport: %s", cfg.Transport)
+	}
+
+	// The name of a workspace is the name of its cache directory, so it
+	// has to be unique, and can't be a path
+	names := make(map[string]bool)
+	for i, ws := range cfg.Workspaces {
+		if ws.Name == "" {
+			return &cfg, fmt.Errorf("please specify the 'name' of workspace %d", i+1)
+		}
+
+		if ws.Name == "." || ws.Name == ".." || strings.ContainsAny(ws.Name, `/\`) {
+			return &cfg, fmt.Errorf("the name of workspace %s can't contain a path separator", ws.Name)
+		}
+
+		if names[ws.Name] {
+			return &cfg, fmt.Errorf("there is more than one workspace named %s", ws.Name)
+		}
+		names[ws.Name] = true
+
+		if ws.SlackToken == "" {
+			return &cfg, fmt.Errorf("please specify the 'slack_token' of workspace %s", ws.Name)
+		}
+
+		switch ws.Transport {
+		case TransportRTM, TransportSocketMode, "":
+			break
+		default:
+			return &cfg, fmt.Errorf("unsupported setting for transport of workspace %s: %s", ws.Name, ws.Transport)
+		}
+	}
+
 	termui.ColorMap = map[string]termui.Attribute{
 		"fg":        termui.StringToAttribute(cfg.Theme.View.Fg),
 		"bg":        termui.StringToAttribute(cfg.Theme.View.Bg),
@@ -74,6 +139,42 @@ func NewConfig(filepath string) (*Config, error) {
 	return &cfg, nil
 }
 
+// GetWorkspaces returns the workspaces defined in the config, when none are
+// defined it will return one workspace based on the tokens of the config.
+func (c *Config) GetWorkspaces() []Workspace {
+	if len(c.Workspaces) > 0 {
+		return c.Workspaces
+	}
+
+	return []Workspace{
+		{
+			Name:       "slack",
+			SlackToken: c.SlackToken,
+			AppToken:   c.AppToken,
+			Transport:  c.Transport,
+		},
+	}
+}
+
+// ForWorkspace returns a copy of the config where the tokens, the
+// transport and the cache directory are set to those of the workspace.
+func (c *Config) ForWorkspace(ws Workspace) *Config {
+	cfg := *c
+
+	cfg.SlackToken = ws.SlackToken
+	cfg.AppToken = ws.AppToken
+	if ws.Transport != "" {
+		cfg.Transport = ws.Transport
+	}
+
+	// Every workspace gets its own cache directory
+	if cfg.CacheDir != "" {
+		cfg.CacheDir = fp.Join(cfg.CacheDir, ws.Name)
+	}
+
+	return &cfg
+}
+
 func CreateConfigFile(filepath string) (*os.File, error) {
 	filepath = fmt.Sprintf("%s/slack-term/%s", xdg.ConfigHome(), "config")
 
@@ -101,11 +202,18 @@ func getDefaultConfig() Config {
 		MainWidth:    11,
 		ThreadsWidth: 1,
 		Notify:       "",
+		Transport:    TransportRTM,
+		CacheDir:     fp.Join(xdg.DataHome(), "slack-term"),
+		DownloadDir:  fp.Join(os.Getenv("HOME"), "Downloads", "slack-term"),
 		Emoji:        false,
+		ImagePreview: false,
+		ImageHeight:  10,
+		ImageMaxSize: 2 << 20,
 		KeyMap: map[string]keyMapping{
 			"command": {
 				"i":          "mode-insert",
 				"/":          "mode-search",
+				"s":          "mode-select",
 				"k":          "channel-up",
 				"j":          "channel-down",
 				"g":          "channel-top",
@@ -121,18 +229,92 @@ func getDefaultConfig() Config {
 				"n":          "channel-search-next",
 				"N":          "channel-search-prev",
 				"'":          "channel-jump",
+				"w":          "workspace-next",
+				"W":          "workspace-prev",
+				"R":          "retry",
+				"D":          "delete-message",
+				"+":          "react",
+				"o":          "file-open",
+				"v":          "file-view",
 				"q":          "quit",
 				"<f1>":       "help",
 			},
 			"insert": {
 				"<left>":      "cursor-left",
 				"<right>":     "cursor-right",
+				"<up>":        "input-up",
+				"<down>":      "history-next",
 				"<enter>":     "send",
 				"<escape>":    "mode-command",
 				"<backspace>": "backspace",
 				"C-8":         "backspace",
 				"<delete>":    "delete",
 				"<space>":     "space",
+				"<tab>":       "complete",
+				"C-j":         "newline",
+				"C-o":         "editor",
+				"<home>":      "cursor-home",
+				"C-a":         "cursor-home",
+				"<end>":       "cursor-end",
+				"C-e":         "cursor-end",
+				"C-w":         "delete-word-back",
+				"C-k":         "kill-to-end",
+				"C-u":         "kill-line",
+				"C-y":         "yank",
+				"C-t":         "transpose",
+				"C-p":         "history-prev",
+				"C-n":         "history-next",
+			},
+			"picker": {
+				"<left>":      "cursor-left",
+				"<right>":     "cursor-right",
+				"<up>":        "picker-up",
+				"<down>":      "picker-down",
+				"C-p":         "picker-up",
+				"C-n":         "picker-down",
+				"<tab>":       "picker-down",
+				"<escape>":    "picker-cancel",
+				"<enter>":     "picker-select",
+				"<backspace>": "backspace",
+				"C-8":         "backspace",
+				"<delete>":    "delete",
+			},
+			"select": {
+				"j":          "select-down",
+				"k":          "select-up",
+				"<down>":     "select-down",
+				"<up>":       "select-up",
+				"<previous>": "chat-up",
+				"<next>":     "chat-down",
+				"p":          "select-parent",
+				"r":          "select-reply",
+				"<enter>":    "select-reply",
+				"+":          "react",
+				"e":          "select-edit",
+				"D":          "select-delete",
+				"y":          "select-copy",
+				"l":          "select-open-link",
+				"o":          "file-open",
+				"v":          "file-view",
+				"V":          "select-raw",
+				"R":          "retry",
+				"q":          "select-cancel",
+				"<escape>":   "select-cancel",
+			},
+			"viewer": {
+				"j":          "viewer-down",
+				"k":          "viewer-up",
+				"<down>":     "viewer-down",
+				"<up>":       "viewer-up",
+				"C-d":        "viewer-page-down",
+				"C-u":        "viewer-page-up",
+				"<next>":     "viewer-page-down",
+				"<previous>": "viewer-page-up",
+				"<space>":    "viewer-page-down",
+				"g":          "viewer-top",
+				"G":          "viewer-bottom",
+				"q":          "viewer-close",
+				"<escape>":   "viewer-close",
 			},
 			"search": {
 				"<left>":      "cursor-left",
@@ -165,6 +347,12 @@ func getDefaultConfig() Config {
 				Thread:     "fg-bold",
 				Name:       "",
 				Text:       "",
+				Bold:       "fg-bold",
+				Italic:     "fg-underline",
+				Strike:     "fg-magenta",
+				Code:       "fg-red",
+				CodeBlock:  "fg-white,bg-black",
+				Quote:      "fg-cyan",
 			},
 		},
 	}
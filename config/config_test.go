@@ -0,0 +1,74 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadConfig writes data to a config file and loads it
+func loadConfig(t *testing.T, data string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "slack-term-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewConfig(path)
+}
+
+func TestWorkspaces(t *testing.T) {
+	cfg, err := loadConfig(t, `{"workspaces": [
+		{"name": "acme", "slack_token": "xoxp-1"},
+		{"name": "globex", "slack_token": "xoxp-2", "transport": "socketmode"}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workspaces := cfg.GetWorkspaces()
+	if len(workspaces) != 2 {
+		t.Fatalf("got %d workspaces, want 2", len(workspaces))
+	}
+
+	globex := cfg.ForWorkspace(workspaces[1])
+	if globex.SlackToken != "xoxp-2" || globex.Transport != TransportSocketMode {
+		t.Errorf("got token %q and transport %q, want those of globex", globex.SlackToken, globex.Transport)
+	}
+}
+
+func TestWorkspacesDefault(t *testing.T) {
+	cfg, err := loadConfig(t, `{"slack_token": "xoxp-1"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workspaces := cfg.GetWorkspaces()
+	if len(workspaces) != 1 || workspaces[0].SlackToken != "xoxp-1" {
+		t.Errorf("got workspaces %v, want one with the token of the config", workspaces)
+	}
+}
+
+func TestWorkspacesInvalid(t *testing.T) {
+	tests := []string{
+		`{"workspaces": [{"slack_token": "xoxp-1"}]}`,
+		`{"workspaces": [{"name": "acme"}]}`,
+		`{"workspaces": [{"name": "acme", "slack_token": "xoxp-1", "transport": "carrier-pigeon"}]}`,
+		`{"workspaces": [{"name": "acme", "slack_token": "xoxp-1"}, {"name": "acme", "slack_token": "xoxp-2"}]}`,
+		`{"workspaces": [{"name": "../acme", "slack_token": "xoxp-1"}]}`,
+		`{"workspaces": [{"name": "acme\\globex", "slack_token": "xoxp-1"}]}`,
+		`{"workspaces": [{"name": "..", "slack_token": "xoxp-1"}]}`,
+	}
+
+	for _, data := range tests {
+		if _, err := loadConfig(t, data); err == nil {
+			t.Errorf("config %s was accepted", data)
+		}
+	}
+}
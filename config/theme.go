@@ -21,6 +21,12 @@ type Message struct {
 	Thread     string `json:"thread"`
 	Text       string `json:"text"`
 	TimeFormat string `json:"time_format"`
+	Bold       string `json:"bold"`       // *bold*
+	Italic     string `json:"italic"`     // _italic_
+	Strike     string `json:"strike"`     // ~strike~
+	Code       string `json:"code"`       // `code`
+	CodeBlock  string `json:"code_block"` // ```code block```
+	Quote      string `json:"quote"`      // > quote
 }
 
 type Channel struct {
@@ -2,9 +2,11 @@ package context
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"sync"
 
 	"github.com/0xAX/notificator"
 	"github.com/erroneousboat/termui"
@@ -19,6 +21,9 @@ const (
 	CommandMode = "command"
 	InsertMode  = "insert"
 	SearchMode  = "search"
+	PickerMode  = "picker"
+	ViewerMode  = "viewer"
+	SelectMode  = "select"
 
 	ChatFocus = iota
 	ThreadFocus
@@ -28,7 +33,7 @@ type AppContext struct {
 	Version    string
 	Usage      string
 	EventQueue chan termbox.Event
-	Service    *service.SlackService
+	Service    service.Service
 	Body       *termui.Grid
 	View       *views.View
 	Config     *config.Config
@@ -36,6 +41,98 @@ type AppContext struct {
 	Mode       string
 	Focus      int
 	Notify     *notificator.Notificator
+
+	// Tasks are run on the goroutine that handles the key events, see Do
+	Tasks chan func(*AppContext)
+
+	// Sends are the messages that are being sent, see Send
+	Sends chan func()
+
+	// Workspaces holds every workspace that is connected, Service and
+	// View are those of the active workspace
+	Workspaces      []*Workspace
+	ActiveWorkspace int
+
+	// FailedWorkspaces holds the workspaces that couldn't be created,
+	// they're marked in the list of workspaces, and have their Err set
+	FailedWorkspaces []*Workspace
+
+	// Retry is the action that failed most recently, it is executed
+	// again by the `retry` action
+	Retry func(*AppContext)
+
+	// Confirm is set when a question is shown in the status area, it is
+	// called with the answer on the next key press
+	Confirm func(ctx *AppContext, yes bool)
+
+	// Pick is set when the Picker is shown, it is called with the value
+	// that has been picked, ok is false when picking was cancelled
+	Pick func(ctx *AppContext, value string, ok bool)
+
+	// Edit is set when a message of the current user is being edited in
+	// the Input component
+	Edit *Edit
+
+	// ReplyTo is the timestamp of the thread the next message is sent
+	// to, it is set when replying to a message in select mode
+	ReplyTo string
+
+	// Complete is set while the candidates of a completion are shown in
+	// the Picker
+	Complete *Complete
+}
+
+// Edit is the message that is being edited
+type Edit struct {
+	ChannelID string
+	MessageID string
+}
+
+// Complete is the word in the Input that is being completed, Start is the
+// position in the text where the word starts
+type Complete struct {
+	Start int
+}
+
+// Workspace holds the Service and the View of a single slack workspace,
+// when the workspace couldn't be created Err is set instead
+type Workspace struct {
+	Name         string
+	Service      service.Service
+	View         *views.View
+	Notification bool
+	Err          error
+}
+
+// Do will run fn on the goroutine that handles the key events. Goroutines
+// that work in the background use it to change the view, so they don't
+// race with the actions of the user. It must not be called from that
+// goroutine itself.
+func (ctx *AppContext) Do(fn func(*AppContext)) {
+	ctx.Tasks <- fn
+}
+
+// Send will run fn in the background, so the user interface doesn't wait
+// while a message is sent. The functions are run one at a time in the order
+// they were sent, so the messages arrive in the order they were typed.
+func (ctx *AppContext) Send(fn func()) {
+	ctx.Sends <- fn
+}
+
+// IsActive returns true when ws is the workspace that is on screen
+func (ctx *AppContext) IsActive(ws *Workspace) bool {
+	return ctx.Workspaces[ctx.ActiveWorkspace] == ws
+}
+
+// SetActiveWorkspace will make the workspace at index the workspace that
+// is on screen, by setting the Service and View of the context
+func (ctx *AppContext) SetActiveWorkspace(index int) {
+	ws := ctx.Workspaces[index]
+
+	ctx.ActiveWorkspace = index
+	ctx.Service = ws.Service
+	ctx.View = ws.View
+	ws.Notification = false
 }
 
 // CreateAppContext creates an application context which can be passed
@@ -56,6 +153,14 @@ func CreateAppContext(flgConfig string, flgToken string, flgDebug bool, version
 		return nil, err
 	}
 
+	// The tokens of the workspaces are always set in the config file, the
+	// command-line flag would be ambiguous
+	if len(config.Workspaces) > 0 && flgToken != "" {
+		return nil, errors.New(
+			"the -token flag can't be used when 'workspaces' are set in the config file",
+		)
+	}
+
 	// When slack token isn't set in the config file, we'll check
 	// the command-line flag or the environment variable
 	if config.SlackToken == "" {
@@ -66,6 +171,18 @@ func CreateAppContext(flgConfig string, flgToken string, flgDebug bool, version
 		}
 	}
 
+	// The app-level token, used by the socket mode transport, can also be
+	// set with an environment variable
+	if config.AppToken == "" {
+		config.AppToken = os.Getenv("SLACK_APP_TOKEN")
+	}
+
+	if len(config.Workspaces) == 0 && config.SlackToken == "" {
+		return nil, errors.New(
+			"please specify the 'slack_token' in the config file, with -token or with SLACK_TOKEN",
+		)
+	}
+
 	// Create desktop notifier
 	var notify *notificator.Notificator
 	if config.Notify != "" {
@@ -77,18 +194,38 @@ func CreateAppContext(flgConfig string, flgToken string, flgDebug bool, version
 		}
 	}
 
-	// Create Service
-	svc, err := service.NewSlackService(config)
-	if err != nil {
-		return nil, err
+	// Create a Service and a View for every workspace, at the same time
+	// so a slow workspace doesn't hold up the others. A workspace that
+	// fails, for instance because its token has been revoked, doesn't
+	// stop the others.
+	wsConfigs := config.GetWorkspaces()
+	created := make([]*Workspace, len(wsConfigs))
+
+	var wg sync.WaitGroup
+	for i := range wsConfigs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created[i] = createWorkspace(wsConfigs[i].Name, config.ForWorkspace(wsConfigs[i]))
+		}(i)
 	}
+	wg.Wait()
 
-	// Create the main view
-	view, err := views.CreateView(config, svc)
-	if err != nil {
-		return nil, err
+	var workspaces, failed []*Workspace
+	for _, ws := range created {
+		if ws.Err != nil {
+			failed = append(failed, ws)
+		} else {
+			workspaces = append(workspaces, ws)
+		}
+	}
+	if len(workspaces) == 0 {
+		return nil, failed[0].Err
 	}
 
+	// The first workspace will be the one on screen
+	view := workspaces[0].View
+
 	columns := []*termui.Row{
 		termui.NewCol(config.SidebarWidth, 0, view.Channels),
 	}
@@ -144,17 +281,43 @@ func CreateAppContext(flgConfig string, flgToken string, flgDebug bool, version
 	termui.Body.Align()
 	termui.Render(termui.Body)
 
-	return &AppContext{
+	ctx := &AppContext{
 		Version:    version,
 		Usage:      usage,
 		EventQueue: make(chan termbox.Event, 20),
-		Service:    svc,
+		Tasks:      make(chan func(*AppContext), 100),
+		Sends:      make(chan func(), 100),
 		Body:       termui.Body,
-		View:       view,
 		Config:     config,
 		Debug:      flgDebug,
 		Mode:       CommandMode,
 		Focus:      ChatFocus,
 		Notify:     notify,
-	}, nil
+		Workspaces: workspaces,
+
+		FailedWorkspaces: failed,
+	}
+	ctx.SetActiveWorkspace(0)
+
+	return ctx, nil
+}
+
+// createWorkspace will create the Service and the View of the workspace
+// with name, Err is set when that fails
+func createWorkspace(name string, config *config.Config) *Workspace {
+	svc, err := service.NewSlackService(config)
+	if err != nil {
+		return &Workspace{Name: name, Err: fmt.Errorf("workspace %s: %v", name, err)}
+	}
+
+	view, err := views.CreateView(config, svc)
+	if err != nil {
+		return &Workspace{Name: name, Err: fmt.Errorf("workspace %s: %v", name, err)}
+	}
+
+	return &Workspace{
+		Name:    name,
+		Service: svc,
+		View:    view,
+	}
 }
@@ -1,28 +1,48 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/0xAX/notificator"
 	"github.com/erroneousboat/termui"
 	termbox "github.com/nsf/termbox-go"
-	"github.com/slack-go/slack"
 
 	"github.com/erroneousboat/slack-term/components"
 	"github.com/erroneousboat/slack-term/config"
 	"github.com/erroneousboat/slack-term/context"
+	"github.com/erroneousboat/slack-term/service"
 	"github.com/erroneousboat/slack-term/views"
 )
 
 var scrollTimer *time.Timer
 var notifyTimer *time.Timer
 
+// pasting is set while the key events come in faster than they can be
+// typed, which is the case when text is pasted in the terminal. The newlines
+// of the pasted text are inserted instead of sending every line.
+var pasting bool
+var lastKeyEvent time.Time
+
+// pasteDelay is the time between two key events under which they're
+// considered part of a paste
+const pasteDelay = 5 * time.Millisecond
+
 // actionMap binds specific action names to the function counterparts,
 // these action names can then be used to bind them to specific keys
 // in the Config.
@@ -32,11 +52,56 @@ var actionMap = map[string]func(*context.AppContext){
 	"delete":              actionDelete,
 	"cursor-right":        actionMoveCursorRight,
 	"cursor-left":         actionMoveCursorLeft,
+	"cursor-word-left":    actionMoveCursorWordLeft,
+	"cursor-word-right":   actionMoveCursorWordRight,
+	"cursor-home":         actionMoveCursorHome,
+	"cursor-end":          actionMoveCursorEnd,
+	"delete-word-back":    actionDeleteWordBack,
+	"delete-word":         actionDeleteWord,
+	"kill-to-end":         actionKillToEnd,
+	"kill-line":           actionKillLine,
+	"yank":                actionYank,
+	"yank-pop":            actionYankPop,
+	"transpose":           actionTranspose,
+	"input-up":            actionInputUp,
+	"history-prev":        actionHistoryPrev,
+	"history-next":        actionHistoryNext,
+	"newline":             actionNewline,
+	"editor":              actionEditor,
 	"send":                actionSend,
+	"edit-prev":           actionEditPrev,
+	"edit-next":           actionEditNext,
+	"delete-message":      actionDeleteMessage,
+	"react":               actionReact,
+	"select-up":           actionSelectUp,
+	"select-down":         actionSelectDown,
+	"select-parent":       actionSelectParent,
+	"select-reply":        actionSelectReply,
+	"select-edit":         actionSelectEdit,
+	"select-delete":       actionSelectDelete,
+	"select-copy":         actionSelectCopy,
+	"select-open-link":    actionSelectOpenLink,
+	"select-raw":          actionSelectRaw,
+	"select-cancel":       actionSelectCancel,
+	"complete":            actionComplete,
+	"picker-up":           actionPickerUp,
+	"picker-down":         actionPickerDown,
+	"picker-select":       actionPickerSelect,
+	"picker-cancel":       actionPickerCancel,
+	"file-open":           actionOpenFile,
+	"file-view":           actionViewFile,
+	"viewer-up":           actionViewerUp,
+	"viewer-down":         actionViewerDown,
+	"viewer-page-up":      actionViewerPageUp,
+	"viewer-page-down":    actionViewerPageDown,
+	"viewer-top":          actionViewerTop,
+	"viewer-bottom":       actionViewerBottom,
+	"viewer-close":        actionCloseViewer,
 	"quit":                actionQuit,
 	"mode-insert":         actionInsertMode,
 	"mode-command":        actionCommandMode,
 	"mode-search":         actionSearchMode,
+	"mode-select":         actionSelectMode,
 	"clear-input":         actionClearInput,
 	"channel-up":          actionMoveCursorUpChannels,
 	"channel-down":        actionMoveCursorDownChannels,
@@ -49,6 +114,9 @@ var actionMap = map[string]func(*context.AppContext){
 	"thread-down":         actionMoveCursorDownThreads,
 	"chat-up":             actionScrollUpChat,
 	"chat-down":           actionScrollDownChat,
+	"workspace-next":      actionNextWorkspace,
+	"workspace-prev":      actionPrevWorkspace,
+	"retry":               actionRetry,
 	"help":                actionHelp,
 }
 
@@ -62,7 +130,32 @@ func Initialize(ctx *context.AppContext) {
 	messageHandler(ctx)
 
 	// User presence
-	go actionSetPresenceAll(ctx)
+	ctx.Do(func(ctx *context.AppContext) {
+		for _, ws := range ctx.Workspaces {
+			actionSetPresenceAll(ctx, ws)
+		}
+	})
+
+	// Replies of the threads in the first channel
+	for _, ws := range ctx.Workspaces {
+		go actionLoadReplies(
+			ctx, ws.Service, ws.View,
+			ws.View.Channels.ChannelItems[ws.View.Channels.SelectedChannel].ID,
+			ws.View.Threads.ChannelItems,
+		)
+	}
+
+	// Workspace indicator
+	actionRenderWorkspaces(ctx)
+
+	// The workspaces that couldn't be created
+	if len(ctx.FailedWorkspaces) > 0 {
+		var errs []string
+		for _, ws := range ctx.FailedWorkspaces {
+			errs = append(errs, ws.Err.Error())
+		}
+		actionShowError(ctx, errors.New(strings.Join(errs, "; ")), nil)
+	}
 }
 
 // eventHandler will handle events created by the user
@@ -73,17 +166,29 @@ func eventHandler(ctx *context.AppContext) {
 		}
 	}()
 
+	go func() {
+		for send := range ctx.Sends {
+			send()
+		}
+	}()
+
+	// The key events and the tasks of the goroutines that work in the
+	// background are handled one at a time
 	go func() {
 		for {
-			ev := <-ctx.EventQueue
-			handleTermboxEvents(ctx, ev)
-			handleMoreTermboxEvents(ctx, ev)
-
-			// Place your debugging statements here
-			if ctx.Debug {
-				ctx.View.Debug.Println(
-					"event received",
-				)
+			select {
+			case ev := <-ctx.EventQueue:
+				handleTermboxEvents(ctx, ev)
+				handleMoreTermboxEvents(ctx, ev)
+
+				// Place your debugging statements here
+				if ctx.Debug {
+					ctx.View.Debug.Println(
+						"event received",
+					)
+				}
+			case task := <-ctx.Tasks:
+				task(ctx)
 			}
 		}
 	}()
@@ -92,6 +197,8 @@ func eventHandler(ctx *context.AppContext) {
 func handleTermboxEvents(ctx *context.AppContext, ev termbox.Event) bool {
 	switch ev.Type {
 	case termbox.EventKey:
+		pasting = isPaste(len(ctx.EventQueue), time.Since(lastKeyEvent))
+		lastKeyEvent = time.Now()
 		actionKeyEvent(ctx, ev)
 	case termbox.EventResize:
 		actionResizeEvent(ctx, ev)
@@ -100,6 +207,13 @@ func handleTermboxEvents(ctx *context.AppContext, ev termbox.Event) bool {
 	return true
 }
 
+// isPaste returns true when a key event is part of a paste, that is when
+// there are more events waiting, or the previous key event came in less
+// than pasteDelay ago
+func isPaste(waiting int, sinceLast time.Duration) bool {
+	return waiting > 0 || sinceLast < pasteDelay
+}
+
 func handleMoreTermboxEvents(ctx *context.AppContext, ev termbox.Event) bool {
 	for {
 		select {
@@ -114,78 +228,184 @@ func handleMoreTermboxEvents(ctx *context.AppContext, ev termbox.Event) bool {
 	}
 }
 
-// messageHandler will handle events created by the service
+// messageHandler will handle events created by the service of every
+// workspace
 func messageHandler(ctx *context.AppContext) {
-	go func() {
-		for {
-			select {
-			case rtmEvent := <-ctx.Service.RTM.IncomingEvents:
-				switch ev := rtmEvent.Data.(type) {
-				case *slack.MessageEvent:
-
-					// Construct message
-					msg, err := ctx.Service.CreateMessageFromMessageEvent(ev, ev.Channel)
-					if err != nil {
-						continue
+	for _, ws := range ctx.Workspaces {
+		go func(ws *context.Workspace) {
+			for event := range ws.Service.Events() {
+				event := event
+
+				// The events are handled on the goroutine of the
+				// key events, so the workspace can't be switched
+				// while an event is handled
+				ctx.Do(func(ctx *context.AppContext) {
+					if ctx.IsActive(ws) {
+						handleServiceEvent(ctx, ws, event)
+					} else {
+						handleBackgroundServiceEvent(ctx, ws, event)
 					}
+				})
+			}
+		}(ws)
+	}
+}
 
-					// Add message to the selected channel
-					if ev.Channel == ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID {
-
-						// Get the thread timestamp of the event, we need to
-						// check the previous message as well, because edited
-						// message don't have the thread timestamp
-						var threadTimestamp string
-						if ev.ThreadTimestamp != "" {
-							threadTimestamp = ev.ThreadTimestamp
-						} else if ev.PreviousMessage != nil && ev.PreviousMessage.ThreadTimestamp != "" {
-							threadTimestamp = ev.PreviousMessage.ThreadTimestamp
-						} else {
-							threadTimestamp = ""
-						}
+// handleServiceEvent will handle the events of the workspace ws, which is
+// on screen
+func handleServiceEvent(ctx *context.AppContext, ws *context.Workspace, event service.Event) {
+	switch ev := event.Data.(type) {
+	case *service.MessageEvent:
+
+		// Edited messages replace the message when it is shown, they
+		// don't count as new messages
+		if ev.Edited {
+			if ev.ChannelID == ws.View.Channels.ChannelItems[ws.View.Channels.SelectedChannel].ID &&
+				ws.View.Chat.UpdateMessage(ev.Message) {
+				termui.Render(ws.View.Chat)
+			}
+			return
+		}
 
-						// When timestamp isn't set this is a thread reply,
-						// handle as such
-						if threadTimestamp != "" {
-							ctx.View.Chat.AddReply(threadTimestamp, msg)
-						} else if threadTimestamp == "" && ctx.Focus == context.ChatFocus {
-							ctx.View.Chat.AddMessage(msg)
-						}
+		// Add message to the selected channel
+		if ev.ChannelID == ws.View.Channels.ChannelItems[ws.View.Channels.SelectedChannel].ID {
 
-						// we (mis)use actionChangeChannel, to rerender, the
-						// view when a new thread has been started
-						if ctx.View.Chat.IsNewThread(threadTimestamp) {
-							actionChangeChannel(ctx)
-						} else {
-							termui.Render(ctx.View.Chat)
-						}
+			// When the thread timestamp is set this is a thread
+			// reply, handle as such
+			if ev.ThreadID != "" {
+				ws.View.Chat.AddReply(ev.ThreadID, ev.Message)
+			} else if ev.ThreadID == "" && ctx.Focus == context.ChatFocus {
+				ws.View.Chat.AddMessage(ev.Message)
+			}
 
-						// TODO: set Chat.Offset to 0, to automatically scroll
-						// down?
-					}
+			// we (mis)use actionChangeChannel, to rerender, the
+			// view when a new thread has been started
+			if ws.View.Chat.IsNewThread(ev.ThreadID) {
+				actionChangeChannel(ctx)
+			} else {
+				termui.Render(ws.View.Chat)
+				actionLoadPreviews(ctx)
+			}
 
-					// Set new message indicator for channel, I'm leaving
-					// this here because I also want to be notified when
-					// I'm currently in a channel but not in the terminal
-					// window (tmux). But only create a notification when
-					// it comes from someone else but the current user.
-					if ev.User != ctx.Service.CurrentUserID {
-						actionNewMessage(ctx, ev)
-					}
-				case *slack.PresenceChangeEvent:
-					actionSetPresence(ctx, ev.User, ev.Presence)
-				case *slack.RTMError:
-					ctx.View.Debug.Println(
-						ev.Error(),
-					)
-				}
+			// TODO: set Chat.Offset to 0, to automatically scroll
+			// down?
+		}
+
+		// Set new message indicator for channel, I'm leaving
+		// this here because I also want to be notified when
+		// I'm currently in a channel but not in the terminal
+		// window (tmux). But only create a notification when
+		// it comes from someone else but the current user.
+		if ev.UserID != ws.Service.GetCurrentUserID() {
+			actionNewMessage(ctx, ws, ev)
+		}
+	case *service.DeleteEvent:
+		if ctx.Edit != nil && ctx.Edit.MessageID == ev.MessageID {
+			actionCancelEdit(ctx)
+		}
+
+		if ev.ChannelID == ws.View.Channels.ChannelItems[ws.View.Channels.SelectedChannel].ID &&
+			ws.View.Chat.DeleteMessage(ev.MessageID) {
+			termui.Render(ws.View.Chat)
+		}
+	case *service.ReactionEvent:
+		if ev.ChannelID != ws.View.Channels.ChannelItems[ws.View.Channels.SelectedChannel].ID {
+			break
+		}
+
+		var ok bool
+		if ev.Added {
+			ok = ws.View.Chat.AddReaction(ev.MessageID, ev.Reaction, ev.UserID)
+		} else {
+			ok = ws.View.Chat.RemoveReaction(ev.MessageID, ev.Reaction, ev.UserID)
+		}
+
+		if ok {
+			termui.Render(ws.View.Chat)
+		}
+	case *service.PresenceEvent:
+		actionSetPresence(ctx, ev.ChannelID, ev.Presence)
+	case *service.ReadStateEvent:
+		actionSetReadState(ctx, ev.ChannelID)
+	case *service.ErrorEvent:
+		actionShowError(ctx, ev.Err, nil)
+	case *service.ConnectionEvent:
+		actionSetConnection(ctx, ws, ev)
+	case *service.LatencyEvent:
+		ws.View.Mode.SetConnected(ev.Latency)
+		termui.Render(ws.View.Mode)
+	case *service.ChannelsEvent:
+		actionSetChannels(ctx, ws, ev.Channels)
+	case *service.HistoryEvent:
+		// The messages were shown from the cache, they're replaced when
+		// the channel is still shown
+		if ev.ChannelID == ws.View.Channels.ChannelItems[ws.View.Channels.SelectedChannel].ID &&
+			ctx.Focus == context.ChatFocus && ctx.Mode != context.SelectMode {
+			actionShowMessages(ctx, ev.Messages, ev.Threads)
+		}
+	}
+}
+
+// handleBackgroundServiceEvent will handle the events of a workspace that
+// isn't on screen. Only the state of its view is updated, nothing will be
+// rendered except for the workspace indicator.
+func handleBackgroundServiceEvent(ctx *context.AppContext, ws *context.Workspace, event service.Event) {
+	switch ev := event.Data.(type) {
+	case *service.MessageEvent:
+		if !ev.Edited && ev.UserID != ws.Service.GetCurrentUserID() {
+			ws.Notification = true
+			actionNewMessage(ctx, ws, ev)
+		}
+	case *service.PresenceEvent:
+		ws.View.Channels.SetPresence(ev.ChannelID, ev.Presence)
+	case *service.ReadStateEvent:
+		for i, channel := range ws.View.Channels.ChannelItems {
+			if channel.ID == ev.ChannelID {
+				ws.View.Channels.MarkAsRead(i)
+				break
 			}
 		}
-	}()
+	case *service.ErrorEvent:
+		ws.View.Debug.List.Items = append(ws.View.Debug.List.Items, ev.Err.Error())
+	case *service.ConnectionEvent:
+		actionSetConnection(ctx, ws, ev)
+	case *service.LatencyEvent:
+		ws.View.Mode.SetConnected(ev.Latency)
+	case *service.ChannelsEvent:
+		actionSetChannels(ctx, ws, ev.Channels)
+	}
+}
+
+// actionSetChannels will replace the channels of a workspace with the
+// channels that have been refreshed. When the channel that was selected is
+// gone, the channel that is selected now is opened.
+func actionSetChannels(ctx *context.AppContext, ws *context.Workspace, channels []components.ChannelItem) {
+	if len(channels) == 0 {
+		return
+	}
+
+	selected := ws.View.Channels.GetSelectedChannel().ID
+	ws.View.Channels.ReplaceChannels(channels)
+
+	if ws.View != ctx.View {
+		return
+	}
+
+	if ws.View.Channels.GetSelectedChannel().ID != selected {
+		actionChangeChannel(ctx)
+		return
+	}
+	termui.Render(ws.View.Channels)
 }
 
 func actionKeyEvent(ctx *context.AppContext, ev termbox.Event) {
 
+	// When a question is asked, the key press is the answer
+	if ctx.Confirm != nil {
+		actionAnswer(ctx, ev.Ch == 'y')
+		return
+	}
+
 	keyStr := getKeyString(ev)
 
 	// Get the action name (actionStr) from the key that
@@ -193,6 +413,13 @@ func actionKeyEvent(ctx *context.AppContext, ev termbox.Event) {
 	// the associated function with this key and execute
 	// it.
 	actionStr, ok := ctx.Config.KeyMap[ctx.Mode][keyStr]
+
+	// The candidates of a completion are shown until another key than the
+	// one that completes is pressed, the candidate that is inserted stays
+	if ctx.Complete != nil && actionStr != "complete" {
+		actionStopComplete(ctx)
+	}
+
 	if ok {
 		action, ok := actionMap[actionStr]
 		if ok {
@@ -203,8 +430,17 @@ func actionKeyEvent(ctx *context.AppContext, ev termbox.Event) {
 			actionInput(ctx.View, ev.Ch)
 		} else if ctx.Mode == context.SearchMode && ev.Ch != 0 {
 			actionSearch(ctx, ev.Ch)
+		} else if ctx.Mode == context.PickerMode && ev.Ch != 0 {
+			actionInput(ctx.View, ev.Ch)
 		}
 	}
+
+	// The matches of the Picker follow what is typed
+	if ctx.Mode == context.PickerMode {
+		actionFilterPicker(ctx)
+	}
+
+	actionResizeInput(ctx)
 }
 
 func actionResizeEvent(ctx *context.AppContext, ev termbox.Event) {
@@ -216,13 +452,42 @@ func actionResizeEvent(ctx *context.AppContext, ev termbox.Event) {
 
 	termui.Body.Width = termui.TermWidth()
 
-	// Vertical resize components
+	actionResizeView(ctx)
+
+	termui.Body.Align()
+	termui.Render(termui.Body)
+}
+
+// actionResizeView will resize the components of the view vertically to
+// the height of the terminal
+func actionResizeView(ctx *context.AppContext) {
 	ctx.View.Channels.List.Height = termui.TermHeight() - ctx.View.Input.Par.Height
+	ctx.View.Threads.List.Height = termui.TermHeight() - ctx.View.Input.Par.Height
 	ctx.View.Chat.List.Height = termui.TermHeight() - ctx.View.Input.Par.Height
 	ctx.View.Debug.List.Height = termui.TermHeight() - ctx.View.Input.Par.Height
+}
+
+// actionResizeInput will change the height of the Input to the number of
+// lines of its text, the other components get the rest of the height of the
+// terminal
+func actionResizeInput(ctx *context.AppContext) {
+	height := ctx.View.Input.GetLineCount() + 2
+	if height == ctx.View.Input.Par.Height {
+		return
+	}
+
+	ctx.View.Input.Par.Height = height
+	actionResizeView(ctx)
 
 	termui.Body.Align()
+	termui.Clear()
 	termui.Render(termui.Body)
+
+	// The Picker is placed on top of the Input, so it moves along
+	if ctx.Mode == context.PickerMode || ctx.Complete != nil {
+		setPickerPosition(ctx)
+		termui.Render(ctx.View.Picker)
+	}
 }
 
 func actionRedrawGrid(ctx *context.AppContext, threads bool, debug bool) {
@@ -289,8 +554,13 @@ func actionInput(view *views.View, key rune) {
 }
 
 func actionClearInput(ctx *context.AppContext) {
-	// Clear input
+	// Clear input, after searching the draft of the channel that was
+	// found is shown
 	ctx.View.Input.Clear()
+	if ctx.Mode == context.SearchMode {
+		ctx.View.Input.RestoreDraft(getDraftKey(ctx))
+		actionMarkDrafts(ctx)
+	}
 	ctx.View.Refresh()
 
 	// Set command mode
@@ -321,179 +591,1376 @@ func actionMoveCursorLeft(ctx *context.AppContext) {
 	termui.Render(ctx.View.Input)
 }
 
-func actionSend(ctx *context.AppContext) {
-	if !ctx.View.Input.IsEmpty() {
-
-		// Clear message before sending, to combat
-		// quick succession of actionSend
-		message := ctx.View.Input.GetText()
-		ctx.View.Input.Clear()
-		termui.Render(ctx.View.Input)
-
-		// Send slash command
-		isCmd, err := ctx.Service.SendCommand(
-			ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
-			message,
-		)
-		if err != nil {
-			ctx.View.Debug.Println(
-				err.Error(),
-			)
-		}
-
-		// Send message
-		if !isCmd {
-			if ctx.Focus == context.ChatFocus {
-				err := ctx.Service.SendMessage(
-					ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
-					message,
-				)
-				if err != nil {
-					ctx.View.Debug.Println(
-						err.Error(),
-					)
-				}
-
-			}
+func actionMoveCursorWordLeft(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorWordLeft()
+	termui.Render(ctx.View.Input)
+}
 
-			if ctx.Focus == context.ThreadFocus {
-				err := ctx.Service.SendReply(
-					ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
-					ctx.View.Threads.ChannelItems[ctx.View.Threads.SelectedChannel].ID,
-					message,
-				)
-				if err != nil {
-					ctx.View.Debug.Println(
-						err.Error(),
-					)
-				}
-			}
-		}
+func actionMoveCursorWordRight(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorWordRight()
+	termui.Render(ctx.View.Input)
+}
 
-		// Clear notification icon if there is any
-		channelItem := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel]
-		if channelItem.Notification {
-			ctx.Service.MarkAsRead(channelItem)
-			ctx.View.Channels.MarkAsRead(ctx.View.Channels.SelectedChannel)
-		}
-		termui.Render(ctx.View.Channels)
-	}
+func actionMoveCursorHome(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorHome()
+	termui.Render(ctx.View.Input)
 }
 
-// actionSearch will search through the channels based on the users
-// input. A time is implemented to make sure the actual searching
-// and changing of channels is done when the user's typing is paused.
-func actionSearch(ctx *context.AppContext, key rune) {
-	actionInput(ctx.View, key)
+func actionMoveCursorEnd(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorEnd()
+	termui.Render(ctx.View.Input)
+}
 
-	go func() {
-		if scrollTimer != nil {
-			scrollTimer.Stop()
-		}
+func actionDeleteWordBack(ctx *context.AppContext) {
+	ctx.View.Input.DeleteWordBack()
+	termui.Render(ctx.View.Input)
+}
 
-		scrollTimer = time.NewTimer(time.Second / 4)
-		<-scrollTimer.C
+func actionDeleteWord(ctx *context.AppContext) {
+	ctx.View.Input.DeleteWord()
+	termui.Render(ctx.View.Input)
+}
 
-		// Only actually search when the time expires
-		term := ctx.View.Input.GetText()
-		ctx.View.Channels.Search(term)
-		actionChangeChannel(ctx)
-	}()
+func actionKillToEnd(ctx *context.AppContext) {
+	ctx.View.Input.KillToEnd()
+	termui.Render(ctx.View.Input)
 }
 
-// actionQuit will exit the program by using os.Exit, this is
-// done because we are using a custom termui EvtStream. Which
-// we won't be able to call termui.StopLoop() on. See main.go
-// for the customEvtStream and why this is done.
-func actionQuit(ctx *context.AppContext) {
-	termbox.Close()
-	os.Exit(0)
+func actionKillLine(ctx *context.AppContext) {
+	ctx.View.Input.KillLine()
+	termui.Render(ctx.View.Input)
 }
 
-func actionInsertMode(ctx *context.AppContext) {
-	ctx.Mode = context.InsertMode
-	ctx.View.Mode.SetInsertMode()
+func actionYank(ctx *context.AppContext) {
+	ctx.View.Input.Yank()
+	termui.Render(ctx.View.Input)
 }
 
-func actionCommandMode(ctx *context.AppContext) {
-	ctx.Mode = context.CommandMode
-	ctx.View.Mode.SetCommandMode()
+func actionYankPop(ctx *context.AppContext) {
+	ctx.View.Input.YankPop()
+	termui.Render(ctx.View.Input)
 }
 
-func actionSearchMode(ctx *context.AppContext) {
-	ctx.Mode = context.SearchMode
-	ctx.View.Mode.SetSearchMode()
+func actionTranspose(ctx *context.AppContext) {
+	ctx.View.Input.Transpose()
+	termui.Render(ctx.View.Input)
 }
 
-func actionGetMessages(ctx *context.AppContext) {
-	msgs, _, err := ctx.Service.GetMessages(
-		ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
-		ctx.View.Chat.GetMaxItems(),
-	)
-	if err != nil {
-		termbox.Close()
-		log.Println(err)
-		os.Exit(0)
+// actionHistoryPrev will show the message that was sent before the one
+// that is shown in the Input, in the current channel. When the cursor isn't
+// on the first line of the Input, it is moved up a line instead, and while
+// a message is edited the message before it is edited.
+func actionHistoryPrev(ctx *context.AppContext) {
+	if ctx.View.Input.MoveCursorUp() {
+		termui.Render(ctx.View.Input)
+		return
 	}
 
-	ctx.View.Chat.SetMessages(msgs)
+	if ctx.Edit != nil {
+		actionEditPrev(ctx)
+		return
+	}
 
-	termui.Render(ctx.View.Chat)
+	channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+	if ctx.View.Input.HistoryPrev(channelID) {
+		termui.Render(ctx.View.Input)
+	}
 }
 
-// actionMoveCursorUpChannels will execute the actionChangeChannel
-// function. A timer is implemented to support fast scrolling through
-// the list without executing the actionChangeChannel event
-func actionMoveCursorUpChannels(ctx *context.AppContext) {
-	go func() {
-		if scrollTimer != nil {
-			scrollTimer.Stop()
+// actionInputUp will edit the last message of the current user when the
+// Input is empty, like up does in the slack client. Otherwise it moves the
+// cursor up a line, or shows the message that was sent before, see
+// actionHistoryPrev.
+func actionInputUp(ctx *context.AppContext) {
+	input := ctx.View.Input
+	if ctx.Edit == nil && input.IsEmpty() && !input.IsBrowsingHistory() {
+		msg, ok := ctx.View.Chat.SelectPrevious(ctx.Service.GetCurrentUserID())
+		if ok {
+			actionStartEdit(ctx, msg)
+			return
 		}
+	}
 
-		ctx.View.Channels.MoveCursorUp()
-		termui.Render(ctx.View.Channels)
+	actionHistoryPrev(ctx)
+}
 
-		scrollTimer = time.NewTimer(time.Second / 4)
-		<-scrollTimer.C
+// actionHistoryNext will show the message that was sent after the one that
+// is shown in the Input, in the current channel. When the cursor isn't on
+// the last line of the Input, it is moved down a line instead, and while a
+// message is edited the message after it is edited.
+func actionHistoryNext(ctx *context.AppContext) {
+	if ctx.View.Input.MoveCursorDown() {
+		termui.Render(ctx.View.Input)
+		return
+	}
 
-		// Only actually change channel when the timer expires
-		actionChangeChannel(ctx)
-	}()
+	if ctx.Edit != nil {
+		actionEditNext(ctx)
+		return
+	}
+
+	channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+	if ctx.View.Input.HistoryNext(channelID) {
+		termui.Render(ctx.View.Input)
+	}
 }
 
-// actionMoveCursorDownChannels will execute the actionChangeChannel
-// function. A timer is implemented to support fast scrolling through
-// the list without executing the actionChangeChannel event
-func actionMoveCursorDownChannels(ctx *context.AppContext) {
-	go func() {
-		if scrollTimer != nil {
-			scrollTimer.Stop()
-		}
+// actionNewline will insert a newline in the Input, so a message can span
+// multiple lines
+func actionNewline(ctx *context.AppContext) {
+	actionInput(ctx.View, '\n')
+}
 
-		ctx.View.Channels.MoveCursorDown()
-		termui.Render(ctx.View.Channels)
+// actionEditor will open the text of the Input in $VISUAL or $EDITOR, and
+// put the text back in the Input when the editor exits
+func actionEditor(ctx *context.AppContext) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
 
-		scrollTimer = time.NewTimer(time.Second / 4)
-		<-scrollTimer.C
+	file, err := ioutil.TempFile("", "slack-term-*.txt")
+	if err != nil {
+		actionShowError(ctx, err, nil)
+		return
+	}
+	defer os.Remove(file.Name())
 
-		// Only actually change channel when the timer expires
-		actionChangeChannel(ctx)
-	}()
-}
+	_, err = file.WriteString(ctx.View.Input.GetText())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		actionShowError(ctx, err, nil)
+		return
+	}
 
-func actionMoveCursorTopChannels(ctx *context.AppContext) {
-	ctx.View.Channels.MoveCursorTop()
-	actionChangeChannel(ctx)
-}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], file.Name())...)
+	if err := actionRunInTerminal(ctx, cmd); err != nil {
+		actionShowError(ctx, fmt.Errorf("running %s: %v", editor, err), nil)
+		return
+	}
 
-func actionMoveCursorBottomChannels(ctx *context.AppContext) {
-	ctx.View.Channels.MoveCursorBottom()
-	actionChangeChannel(ctx)
-}
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		actionShowError(ctx, err, nil)
+		return
+	}
 
-func actionSearchNextChannels(ctx *context.AppContext) {
-	ctx.View.Channels.SearchNext()
-	actionChangeChannel(ctx)
+	// Editors end the file with a newline, which isn't part of the
+	// message
+	ctx.View.Input.SetText(strings.TrimRight(string(data), "\n"))
+	termui.Render(ctx.View.Input)
+}
+
+func actionSend(ctx *context.AppContext) {
+	// An <enter> in pasted text is a newline of the text
+	if pasting {
+		actionNewline(ctx)
+		return
+	}
+
+	if !ctx.View.Input.IsEmpty() {
+
+		// Clear message before sending, to combat
+		// quick succession of actionSend
+		message := ctx.View.Input.GetText()
+		ctx.View.Input.Clear()
+		termui.Render(ctx.View.Input)
+
+		// When a message is being edited, replace its text instead
+		if ctx.Edit != nil {
+			actionSendEdit(ctx, message)
+			return
+		}
+
+		// The message is sent to the channel, or thread, that is selected
+		// now. When sending fails, retrying will send it to the same one.
+		svc := ctx.Service
+		channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+		var threadID string
+		if ctx.Focus == context.ThreadFocus {
+			threadID = ctx.View.Threads.ChannelItems[ctx.View.Threads.SelectedChannel].ID
+		}
+
+		// A reply to a message that was selected goes to its thread
+		if ctx.ReplyTo != "" {
+			threadID = ctx.ReplyTo
+			actionCancelReply(ctx)
+		}
+
+		// Uploads are handled here instead of by SendCommand, so we
+		// can show their progress
+		if actionUploadCommand(ctx, svc, channelID, threadID, message) {
+			return
+		}
+
+		// Clear notification icon if there is any
+		channelItem := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel]
+		markAsRead := channelItem.Notification
+		if markAsRead {
+			ctx.View.Channels.MarkAsRead(ctx.View.Channels.SelectedChannel)
+		}
+		termui.Render(ctx.View.Channels)
+
+		// The message is sent in the background, errors are shown
+		// when it's done
+		view := ctx.View
+		var send func(*context.AppContext)
+		send = func(ctx *context.AppContext) {
+			ctx.Send(func() {
+				// Send slash command
+				isCmd, err := svc.SendCommand(channelID, message)
+
+				// Send message
+				if err == nil && !isCmd {
+					if threadID == "" {
+						err = svc.SendMessage(channelID, message)
+					} else {
+						err = svc.SendReply(channelID, threadID, message)
+					}
+				}
+
+				if err == nil && markAsRead {
+					svc.MarkAsRead(channelItem)
+					markAsRead = false
+				}
+
+				ctx.Do(func(ctx *context.AppContext) {
+					// The message that has been sent can be
+					// recalled in this channel, also in the
+					// next session
+					if err == nil {
+						view.Input.AddHistory(channelID, message)
+						if err := svc.SaveInputHistory(view.Input.History); err != nil && ctx.Debug {
+							view.Debug.Println(err.Error())
+						}
+						return
+					}
+
+					// The message is put back in the Input,
+					// so the mention can be corrected
+					if service.IsAmbiguous(err) {
+						if view.Input.IsEmpty() {
+							view.Input.SetText(message)
+						}
+						actionShowError(ctx, err, nil)
+						return
+					}
+
+					actionShowError(ctx, err, send)
+				})
+			})
+		}
+		send(ctx)
+	}
+}
+
+// uploadCommand matches the `/upload <path> [comment]` and `/snippet <text>`
+// commands
+var uploadCommand = regexp.MustCompile(`(?s)^/(upload|snippet)(?:\s+(.*))?$`)
+
+// parseUploadCommand returns the name of the upload command in message, and
+// its arguments. For `/upload` these are the path, with ~ expanded, and the
+// comment, for `/snippet` arg is the text of the snippet. It returns false
+// when message isn't an upload command.
+func parseUploadCommand(message string) (cmd string, arg string, comment string, ok bool) {
+	match := uploadCommand.FindStringSubmatch(message)
+	if match == nil {
+		return "", "", "", false
+	}
+
+	cmd = match[1]
+	args := strings.TrimSpace(match[2])
+	if cmd == "snippet" || args == "" {
+		return cmd, args, "", true
+	}
+
+	parts := strings.SplitN(args, " ", 2)
+	if len(parts) == 2 {
+		comment = strings.TrimSpace(parts[1])
+	}
+
+	path := parts[0]
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+
+	return cmd, path, comment, true
+}
+
+// actionUploadCommand will handle the upload commands, it returns false when
+// message isn't one of them. When `/upload` is used without a path a file
+// can be picked.
+func actionUploadCommand(ctx *context.AppContext, svc service.Service, channelID string, threadID string, message string) bool {
+	cmd, arg, comment, ok := parseUploadCommand(message)
+	if !ok {
+		return false
+	}
+
+	switch cmd {
+	case "snippet":
+		if arg == "" {
+			actionShowError(ctx, errors.New("'/snippet' command malformed"), nil)
+			return true
+		}
+
+		var upload func(*context.AppContext)
+		upload = func(ctx *context.AppContext) {
+			ctx.Send(func() {
+				if err := svc.UploadSnippet(channelID, threadID, arg, ""); err != nil {
+					ctx.Do(func(ctx *context.AppContext) {
+						actionShowError(ctx, err, upload)
+					})
+				}
+			})
+		}
+		upload(ctx)
+	case "upload":
+		if arg == "" {
+			dir, err := os.Getwd()
+			if err != nil {
+				actionShowError(ctx, err, nil)
+				return true
+			}
+
+			actionPickFile(ctx, dir, func(ctx *context.AppContext, path string) {
+				actionUpload(ctx, svc, channelID, threadID, path, "")
+			})
+			return true
+		}
+
+		actionUpload(ctx, svc, channelID, threadID, arg, comment)
+	}
+
+	return true
+}
+
+// actionUpload will upload the file at path in the background, while the
+// progress is shown in the border of the Input. An error that is shown in
+// the meantime isn't replaced by the progress.
+func actionUpload(ctx *context.AppContext, svc service.Service, channelID string, threadID string, path string, comment string) {
+	view := ctx.View
+	name := filepath.Base(path)
+
+	var upload func(*context.AppContext)
+	upload = func(ctx *context.AppContext) {
+		// info is the progress that is shown, it is only used on the
+		// goroutine of the user interface
+		var info string
+
+		go func() {
+			percent := -1
+			err := svc.UploadFile(channelID, threadID, path, comment, func(sent int64, total int64) {
+				p := 100
+				if total > 0 {
+					p = int(sent * 100 / total)
+				}
+				if p == percent {
+					return
+				}
+				percent = p
+
+				ctx.Do(func(ctx *context.AppContext) {
+					if view.Input.HasError() {
+						return
+					}
+
+					info = fmt.Sprintf("uploading %s %d%%", name, p)
+					view.Input.SetInfo(info)
+					if ctx.View == view {
+						termui.Render(view.Input)
+					}
+				})
+			})
+
+			ctx.Do(func(ctx *context.AppContext) {
+				view.Input.ClearInfo(info)
+				if ctx.View == view {
+					termui.Render(view.Input)
+				}
+
+				if err != nil {
+					actionShowError(ctx, err, upload)
+				}
+			})
+		}()
+	}
+	upload(ctx)
+}
+
+// actionPickFile will show the files in dir in the Picker, picking a
+// directory will show the files in that directory. The path of the file
+// that is picked is passed to pick.
+func actionPickFile(ctx *context.AppContext, dir string, pick func(*context.AppContext, string)) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		actionShowError(ctx, err, nil)
+		return
+	}
+
+	items := []components.PickerItem{
+		{Label: "../", Value: filepath.Dir(dir)},
+	}
+	for _, file := range files {
+		label := file.Name()
+		if file.IsDir() {
+			label += "/"
+		}
+
+		items = append(items, components.PickerItem{
+			Label: label,
+			Value: filepath.Join(dir, file.Name()),
+		})
+	}
+
+	actionPick(ctx, dir, items, func(ctx *context.AppContext, path string, ok bool) {
+		if !ok {
+			return
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			actionPickFile(ctx, path, pick)
+			return
+		}
+
+		pick(ctx, path)
+	})
+}
+
+// maxViewSize is the size of the largest file that can be shown in the
+// Viewer
+const maxViewSize = 1 << 20
+
+// actionOpenFile will download the file of the selected message, and open
+// it with the `open_command` of the config. When that isn't set text files
+// are opened with $PAGER, and other files with xdg-open.
+func actionOpenFile(ctx *context.AppContext) {
+	actionSelectFile(ctx, func(ctx *context.AppContext, file components.File) {
+		actionDownloadFile(ctx, file, func(ctx *context.AppContext, path string) {
+			var args []string
+			switch {
+			case ctx.Config.OpenCommand != "":
+				args = strings.Fields(ctx.Config.OpenCommand)
+			case file.IsText() && os.Getenv("PAGER") != "":
+				args = strings.Fields(os.Getenv("PAGER"))
+			case runtime.GOOS == "darwin":
+				args = []string{"open"}
+			default:
+				args = []string{"xdg-open"}
+			}
+
+			cmd := exec.Command(args[0], append(args[1:], path)...)
+			if err := actionRunInTerminal(ctx, cmd); err != nil {
+				actionShowError(ctx, fmt.Errorf("opening %s: %v", file.Name, err), nil)
+			}
+		})
+	})
+}
+
+// actionViewFile will download the file of the selected message, and show
+// it in the Viewer when it is a text file
+func actionViewFile(ctx *context.AppContext) {
+	actionSelectFile(ctx, func(ctx *context.AppContext, file components.File) {
+		if file.Size > maxViewSize {
+			actionShowError(ctx, fmt.Errorf("%s is too large to view", file.Name), nil)
+			return
+		}
+
+		actionDownloadFile(ctx, file, func(ctx *context.AppContext, path string) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				actionShowError(ctx, err, nil)
+				return
+			}
+
+			if !utf8.Valid(data) {
+				actionShowError(ctx, fmt.Errorf("%s isn't a text file", file.Name), nil)
+				return
+			}
+
+			title := file.Title
+			if title == "" {
+				title = file.Name
+			}
+
+			actionShowViewer(ctx, title, string(data))
+		})
+	})
+}
+
+// actionSelectFile will pass the file of the selected message to fn, when
+// no message is selected the last message with a file is used. When the
+// message has more than one file, the file can be picked.
+func actionSelectFile(ctx *context.AppContext, fn func(*context.AppContext, components.File)) {
+	var msg components.Message
+	var ok bool
+	if ctx.View.Chat.GetSelectedID() != "" {
+		msg, ok = ctx.View.Chat.GetSelectedMessage()
+	} else {
+		msg, ok = ctx.View.Chat.FindLastMessage(func(msg components.Message) bool {
+			return len(msg.Files) > 0
+		})
+	}
+
+	if !ok || len(msg.Files) == 0 {
+		actionShowError(ctx, errors.New("there is no file to open"), nil)
+		return
+	}
+
+	if len(msg.Files) == 1 {
+		fn(ctx, msg.Files[0])
+		return
+	}
+
+	var items []components.PickerItem
+	for _, file := range msg.Files {
+		items = append(items, components.PickerItem{
+			Label: file.Name,
+			Value: file.ID,
+		})
+	}
+
+	actionPick(ctx, "files", items, func(ctx *context.AppContext, id string, ok bool) {
+		if !ok {
+			return
+		}
+
+		for _, file := range msg.Files {
+			if file.ID == id {
+				fn(ctx, file)
+			}
+		}
+	})
+}
+
+// actionDownloadFile will download the file in the background, while it
+// is downloading this is shown in the border of the Input. The path of the
+// downloaded file is passed to fn.
+func actionDownloadFile(ctx *context.AppContext, file components.File, fn func(*context.AppContext, string)) {
+	svc := ctx.Service
+	view := ctx.View
+
+	var download func(*context.AppContext)
+	download = func(ctx *context.AppContext) {
+		// An error that is shown isn't replaced
+		var info string
+		if !view.Input.HasError() {
+			info = fmt.Sprintf("downloading %s", file.Name)
+			view.Input.SetInfo(info)
+			termui.Render(view.Input)
+		}
+
+		go func() {
+			path, err := svc.DownloadFile(file)
+
+			ctx.Do(func(ctx *context.AppContext) {
+				view.Input.ClearInfo(info)
+				if ctx.View == view {
+					termui.Render(view.Input)
+				}
+
+				if err != nil {
+					actionShowError(ctx, err, download)
+					return
+				}
+
+				// Don't open the file when the user has moved on to
+				// another workspace
+				if ctx.View == view {
+					fn(ctx, path)
+				}
+			})
+		}()
+	}
+	download(ctx)
+}
+
+// suspendRender is rendered to hold the render loop of termui, while the
+// terminal is used by another program
+type suspendRender struct {
+	suspended chan struct{}
+	resume    chan struct{}
+}
+
+// Buffer implements interface termui.Bufferer, it blocks until the
+// terminal is given back
+func (s *suspendRender) Buffer() termui.Buffer {
+	close(s.suspended)
+	<-s.resume
+	return termui.NewBuffer()
+}
+
+// actionRunInTerminal will hand the terminal over to cmd, like a pager or
+// an editor, and restores the interface when it exits. Everything that is
+// rendered in the meantime waits until the terminal is given back.
+func actionRunInTerminal(ctx *context.AppContext, cmd *exec.Cmd) error {
+	suspend := &suspendRender{
+		suspended: make(chan struct{}),
+		resume:    make(chan struct{}),
+	}
+	termui.Render(suspend)
+	<-suspend.suspended
+
+	termbox.Close()
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+
+	if initErr := termbox.Init(); initErr != nil {
+		fmt.Fprintln(os.Stderr, initErr)
+		os.Exit(1)
+	}
+	close(suspend.resume)
+
+	// The terminal could have been resized in the meantime
+	termui.Body.Width = termui.TermWidth()
+	actionResizeView(ctx)
+	termui.Body.Align()
+	termui.Clear()
+	termui.Render(termui.Body)
+
+	return err
+}
+
+// actionShowViewer will show text in the Viewer, in place of the Chat
+func actionShowViewer(ctx *context.AppContext, title string, text string) {
+	ctx.View.Viewer.SetText(title, text)
+
+	ctx.View.Viewer.List.Height = ctx.View.Chat.List.Height
+	ctx.View.Viewer.SetWidth(ctx.View.Chat.List.Width)
+	ctx.View.Viewer.SetX(ctx.View.Chat.List.X)
+	ctx.View.Viewer.SetY(ctx.View.Chat.List.Y)
+
+	ctx.Mode = context.ViewerMode
+	ctx.View.Mode.SetViewerMode()
+
+	termui.Render(ctx.View.Viewer)
+}
+
+// actionCloseViewer will show the Chat again. When the Viewer was opened in
+// select mode the message is still selected, and we return to select mode.
+func actionCloseViewer(ctx *context.AppContext) {
+	if ctx.View.Chat.GetSelectedID() != "" && ctx.Edit == nil {
+		ctx.Mode = context.SelectMode
+		ctx.View.Mode.SetSelectMode()
+	} else {
+		ctx.Mode = context.CommandMode
+		ctx.View.Mode.SetCommandMode()
+	}
+
+	termui.Render(termui.Body)
+}
+
+func actionViewerUp(ctx *context.AppContext) {
+	ctx.View.Viewer.ScrollUp(1)
+	termui.Render(ctx.View.Viewer)
+}
+
+func actionViewerDown(ctx *context.AppContext) {
+	ctx.View.Viewer.ScrollDown(1)
+	termui.Render(ctx.View.Viewer)
+}
+
+func actionViewerPageUp(ctx *context.AppContext) {
+	ctx.View.Viewer.ScrollUp(ctx.View.Viewer.GetPageSize())
+	termui.Render(ctx.View.Viewer)
+}
+
+func actionViewerPageDown(ctx *context.AppContext) {
+	ctx.View.Viewer.ScrollDown(ctx.View.Viewer.GetPageSize())
+	termui.Render(ctx.View.Viewer)
+}
+
+func actionViewerTop(ctx *context.AppContext) {
+	ctx.View.Viewer.ScrollTop()
+	termui.Render(ctx.View.Viewer)
+}
+
+func actionViewerBottom(ctx *context.AppContext) {
+	ctx.View.Viewer.ScrollBottom()
+	termui.Render(ctx.View.Viewer)
+}
+
+// actionSendEdit will replace the text of the message that is being edited
+// with message
+func actionSendEdit(ctx *context.AppContext, message string) {
+	svc := ctx.Service
+	edit := *ctx.Edit
+
+	ctx.Edit = nil
+	ctx.View.Chat.ClearSelection()
+	ctx.View.Mode.SetInsertMode()
+	termui.Render(ctx.View.Chat)
+
+	var send func(*context.AppContext)
+	send = func(ctx *context.AppContext) {
+		ctx.Send(func() {
+			err := svc.EditMessage(edit.ChannelID, edit.MessageID, message)
+			if err != nil {
+				ctx.Do(func(ctx *context.AppContext) {
+					actionShowError(ctx, err, send)
+				})
+			}
+		})
+	}
+	send(ctx)
+}
+
+// actionEditPrev will start editing the last message of the current user in
+// the Chat, when the Input is empty. When a message is being edited already
+// the message before it is edited instead.
+func actionEditPrev(ctx *context.AppContext) {
+	if ctx.Edit == nil && !ctx.View.Input.IsEmpty() {
+		return
+	}
+
+	msg, ok := ctx.View.Chat.SelectPrevious(ctx.Service.GetCurrentUserID())
+	if !ok {
+		return
+	}
+
+	actionStartEdit(ctx, msg)
+}
+
+// actionEditNext will edit the message of the current user after the one
+// that is being edited, when there is none editing is stopped.
+func actionEditNext(ctx *context.AppContext) {
+	if ctx.Edit == nil {
+		return
+	}
+
+	msg, ok := ctx.View.Chat.SelectNext(ctx.Service.GetCurrentUserID())
+	if !ok {
+		actionCancelEdit(ctx)
+		return
+	}
+
+	actionStartEdit(ctx, msg)
+}
+
+// actionStartEdit will put the text of msg in the Input, so it can be
+// edited and sent with the `send` action
+func actionStartEdit(ctx *context.AppContext, msg components.Message) {
+	ctx.Edit = &context.Edit{
+		ChannelID: ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
+		MessageID: msg.ID,
+	}
+
+	ctx.View.Chat.Select(msg.ID)
+	ctx.View.Input.SetText(msg.Text)
+	ctx.View.Mode.SetEditMode()
+
+	termui.Render(ctx.View.Chat)
+	termui.Render(ctx.View.Input)
+}
+
+// actionCancelEdit will stop editing a message, the text in the Input is
+// discarded
+func actionCancelEdit(ctx *context.AppContext) {
+	if ctx.Edit == nil {
+		return
+	}
+
+	ctx.Edit = nil
+	ctx.View.Chat.ClearSelection()
+	ctx.View.Input.Clear()
+
+	if ctx.Mode == context.InsertMode {
+		ctx.View.Mode.SetInsertMode()
+	}
+
+	termui.Render(ctx.View.Chat)
+	termui.Render(ctx.View.Input)
+}
+
+// actionKeepEdit will select the message that is being edited again, after
+// the messages of the Chat have been replaced. When the message isn't shown
+// anymore editing is stopped.
+func actionKeepEdit(ctx *context.AppContext) {
+	if ctx.Edit == nil {
+		return
+	}
+
+	channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+	if ctx.Edit.ChannelID != channelID || !ctx.View.Chat.Select(ctx.Edit.MessageID) {
+		actionCancelEdit(ctx)
+	}
+}
+
+// actionDeleteMessage will delete the message that is being edited, or
+// else the last message of the current user in the Chat, once the user has
+// confirmed it
+func actionDeleteMessage(ctx *context.AppContext) {
+	svc := ctx.Service
+	channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+
+	var messageID string
+	if ctx.Edit != nil {
+		channelID = ctx.Edit.ChannelID
+		messageID = ctx.Edit.MessageID
+	} else {
+		ctx.View.Chat.ClearSelection()
+		msg, ok := ctx.View.Chat.SelectPrevious(svc.GetCurrentUserID())
+		if !ok {
+			return
+		}
+		messageID = msg.ID
+		termui.Render(ctx.View.Chat)
+	}
+
+	actionConfirm(ctx, "delete message?", func(ctx *context.AppContext, yes bool) {
+		if ctx.Edit == nil {
+			ctx.View.Chat.ClearSelection()
+			termui.Render(ctx.View.Chat)
+		}
+
+		if yes {
+			actionRemoveMessage(ctx, channelID, messageID)
+		}
+	})
+}
+
+// actionRemoveMessage will delete the message with messageID from the
+// channel
+func actionRemoveMessage(ctx *context.AppContext, channelID string, messageID string) {
+	svc := ctx.Service
+
+	var del func(*context.AppContext)
+	del = func(ctx *context.AppContext) {
+		ctx.Send(func() {
+			if err := svc.DeleteMessage(channelID, messageID); err != nil {
+				ctx.Do(func(ctx *context.AppContext) {
+					actionShowError(ctx, err, del)
+				})
+			}
+		})
+	}
+	del(ctx)
+}
+
+// actionConfirm will ask a yes or no question in the status area, the
+// answer is passed to answer on the next key press
+func actionConfirm(ctx *context.AppContext, question string, answer func(*context.AppContext, bool)) {
+	ctx.Confirm = answer
+
+	ctx.View.Input.SetStatus(fmt.Sprintf("%s (y/n)", question))
+	termui.Render(ctx.View.Input)
+}
+
+// actionAnswer will clear the question from the status area, and pass the
+// answer to the action that asked it
+func actionAnswer(ctx *context.AppContext, yes bool) {
+	answer := ctx.Confirm
+
+	ctx.Confirm = nil
+	ctx.View.Input.ClearStatus()
+	termui.Render(ctx.View.Input)
+
+	answer(ctx, yes)
+}
+
+// actionReact will show the emoji Picker, the picked emoji is added as a
+// reaction to the selected message, or to the last message when none is
+// selected. When the current user already reacted with it, the reaction is
+// removed instead.
+func actionReact(ctx *context.AppContext) {
+	msg, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok {
+		return
+	}
+
+	svc := ctx.Service
+	channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+
+	selected := ctx.View.Chat.GetSelectedID()
+	ctx.View.Chat.Select(msg.ID)
+	termui.Render(ctx.View.Chat)
+
+	actionPick(ctx, "react", getEmojiItems(ctx), func(ctx *context.AppContext, name string, ok bool) {
+		if !ctx.View.Chat.Select(selected) {
+			ctx.View.Chat.ClearSelection()
+		}
+		termui.Render(ctx.View.Chat)
+
+		if !ok {
+			return
+		}
+
+		var react func(*context.AppContext)
+		react = func(ctx *context.AppContext) {
+			ctx.Send(func() {
+				if err := toggleReaction(svc, channelID, msg, name); err != nil {
+					ctx.Do(func(ctx *context.AppContext) {
+						actionShowError(ctx, err, react)
+					})
+				}
+			})
+		}
+		react(ctx)
+	})
+}
+
+// toggleReaction will add the reaction name to msg, or remove it when the
+// current user already reacted with it
+func toggleReaction(svc service.Service, channelID string, msg components.Message, name string) error {
+	for _, r := range msg.Reactions {
+		if r.Name == name && r.HasUser(svc.GetCurrentUserID()) {
+			return svc.RemoveReaction(channelID, msg.ID, name)
+		}
+	}
+
+	return svc.AddReaction(channelID, msg.ID, name)
+}
+
+// getEmojiItems returns the emoji that can be picked as reactions, the
+// value is the shortcode without colons
+func getEmojiItems(ctx *context.AppContext) []components.PickerItem {
+	codes := make([]string, 0, len(config.EmojiCodemap))
+	for code := range config.EmojiCodemap {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	items := make([]components.PickerItem, 0, len(codes))
+	for _, code := range codes {
+		label := code
+		if ctx.Config.Emoji {
+			label = fmt.Sprintf("%s %s", config.EmojiCodemap[code], code)
+		}
+
+		items = append(items, components.PickerItem{
+			Label: label,
+			Value: strings.Trim(code, ":"),
+		})
+	}
+
+	return items
+}
+
+// actionPick will show the Picker with items above the Input, while it is
+// shown the text in the Input filters the items. The value of the item that
+// is picked is passed to pick, afterwards the Input and the mode are
+// restored.
+func actionPick(ctx *context.AppContext, title string, items []components.PickerItem, pick func(*context.AppContext, string, bool)) {
+	text := ctx.View.Input.GetText()
+	mode := ctx.Mode
+
+	ctx.Pick = func(ctx *context.AppContext, value string, ok bool) {
+		ctx.Pick = nil
+
+		ctx.View.Input.SetText(text)
+		ctx.Mode = mode
+		switch mode {
+		case context.InsertMode:
+			ctx.View.Mode.SetInsertMode()
+		case context.SearchMode:
+			ctx.View.Mode.SetSearchMode()
+		case context.SelectMode:
+			ctx.View.Mode.SetSelectMode()
+		default:
+			ctx.View.Mode.SetCommandMode()
+		}
+
+		// Remove the Picker from the screen
+		termui.Render(termui.Body)
+
+		pick(ctx, value, ok)
+	}
+
+	ctx.View.Picker.SetItems(items)
+	ctx.View.Picker.List.BorderLabel = title
+	setPickerPosition(ctx)
+
+	ctx.View.Input.Clear()
+	ctx.Mode = context.PickerMode
+	ctx.View.Mode.SetPickerMode()
+
+	termui.Render(ctx.View.Input)
+	termui.Render(ctx.View.Picker)
+}
+
+// setPickerPosition will place the Picker on top of the Input
+func setPickerPosition(ctx *context.AppContext) {
+	width := ctx.View.Input.Par.Width
+	if width > 40 {
+		width = 40
+	}
+	ctx.View.Picker.SetWidth(width)
+	ctx.View.Picker.SetX(ctx.View.Input.Par.X)
+	ctx.View.Picker.SetY(ctx.View.Input.Par.Y - ctx.View.Picker.GetHeight())
+}
+
+// actionComplete will complete the word in front of the cursor in the
+// Input, depending on how it starts:
+//
+//	@user     the users of the workspace
+//	#channel  the channels of the sidebar
+//	:emoji:   the emoji of the emoji codemap
+//	/command  the commands of slack-term, at the start of the message
+//
+// When there are more candidates they're shown in the Picker, and the first
+// one is inserted. Completing again will insert the next candidate instead.
+func actionComplete(ctx *context.AppContext) {
+	input := ctx.View.Input
+
+	if ctx.Complete != nil {
+		ctx.View.Picker.MoveCursorNext()
+		if item, ok := ctx.View.Picker.GetSelected(); ok {
+			input.Replace(ctx.Complete.Start, item.Value)
+		}
+
+		termui.Render(input)
+		termui.Render(ctx.View.Picker)
+		return
+	}
+
+	start, term, title, items := getCompleteItems(ctx, input.Text, input.CursorPositionText)
+	if len(items) == 0 {
+		return
+	}
+
+	ctx.View.Picker.SetItems(items)
+	ctx.View.Picker.Filter(term)
+
+	item, ok := ctx.View.Picker.GetSelected()
+	if !ok {
+		return
+	}
+	input.Replace(start, item.Value)
+	termui.Render(input)
+
+	// Only when there is a choice the candidates are shown
+	if len(ctx.View.Picker.Matches) > 1 {
+		ctx.Complete = &context.Complete{Start: start}
+
+		ctx.View.Picker.List.BorderLabel = title
+		setPickerPosition(ctx)
+		termui.Render(ctx.View.Picker)
+	}
+}
+
+// getCompleteItems returns the candidates for the word in front of cursor in
+// text, see actionComplete. The word starts at start, and the candidates are
+// filtered with term. It returns no candidates when the word can't be
+// completed.
+func getCompleteItems(ctx *context.AppContext, text []rune, cursor int) (start int, term string, title string, items []components.PickerItem) {
+	// The word starts after the last space in front of the cursor
+	start = cursor
+	for start > 0 && !unicode.IsSpace(text[start-1]) {
+		start--
+	}
+	word := string(text[start:cursor])
+	if word == "" {
+		return start, "", "", nil
+	}
+
+	switch word[0] {
+	case '@':
+		title, items = "users", getUserItems(ctx)
+	case '#':
+		title, items = "channels", getChannelItems(ctx)
+	case ':':
+		title = "emoji"
+		for _, item := range getEmojiItems(ctx) {
+			item.Value = ":" + item.Value + ":"
+			items = append(items, item)
+		}
+	case '/':
+		if start > 0 {
+			return start, "", "", nil
+		}
+		title, items = "commands", getCommandItems()
+	default:
+		return start, "", "", nil
+	}
+
+	// The candidates are followed by a space, so the next word can be
+	// typed right away
+	if cursor == len(text) || !unicode.IsSpace(text[cursor]) {
+		for i := range items {
+			items[i].Value += " "
+		}
+	}
+
+	return start, strings.Trim(word[1:], ":"), title, items
+}
+
+// actionStopComplete will remove the candidates of the completion from the
+// screen
+func actionStopComplete(ctx *context.AppContext) {
+	ctx.Complete = nil
+	termui.Render(termui.Body)
+}
+
+// getUserItems returns the users that can be mentioned, the label contains
+// the display name of the user as well, so it can be found with it
+func getUserItems(ctx *context.AppContext) []components.PickerItem {
+	names := ctx.Service.GetUserNames()
+
+	handles := make([]string, 0, len(names))
+	for handle := range names {
+		handles = append(handles, handle)
+	}
+	sort.Strings(handles)
+
+	items := make([]components.PickerItem, 0, len(handles))
+	for _, handle := range handles {
+		label := "@" + handle
+		if names[handle] != "" && names[handle] != handle {
+			label = fmt.Sprintf("@%s (%s)", handle, names[handle])
+		}
+
+		items = append(items, components.PickerItem{
+			Label: label,
+			Value: "@" + handle,
+		})
+	}
+
+	return items
+}
+
+// getChannelItems returns the channels and groups of the sidebar
+func getChannelItems(ctx *context.AppContext) []components.PickerItem {
+	var items []components.PickerItem
+	for _, channel := range ctx.View.Channels.ChannelItems {
+		if channel.Type != components.ChannelTypeChannel &&
+			channel.Type != components.ChannelTypeGroup {
+			continue
+		}
+
+		items = append(items, components.PickerItem{
+			Label: "#" + channel.Name,
+			Value: "#" + channel.Name,
+		})
+	}
+
+	return items
+}
+
+// getCommandItems returns the commands that are handled by slack-term
+func getCommandItems() []components.PickerItem {
+	return []components.PickerItem{
+		{Label: "/thread <id> <message>", Value: "/thread"},
+		{Label: "/upload [path] [comment]", Value: "/upload"},
+		{Label: "/snippet <text>", Value: "/snippet"},
+	}
+}
+
+// actionFilterPicker will only show the items of the Picker that match the
+// text in the Input
+func actionFilterPicker(ctx *context.AppContext) {
+	ctx.View.Picker.Filter(strings.Trim(ctx.View.Input.GetText(), ":"))
+	termui.Render(ctx.View.Picker)
+}
+
+func actionPickerUp(ctx *context.AppContext) {
+	ctx.View.Picker.MoveCursorUp()
+	termui.Render(ctx.View.Picker)
+}
+
+func actionPickerDown(ctx *context.AppContext) {
+	ctx.View.Picker.MoveCursorDown()
+	termui.Render(ctx.View.Picker)
+}
+
+// actionPickerSelect will pick the selected item of the Picker, when nothing
+// matches the text in the Input is picked as is
+func actionPickerSelect(ctx *context.AppContext) {
+	if ctx.Pick == nil {
+		return
+	}
+
+	value := strings.Trim(ctx.View.Input.GetText(), ":")
+	if item, ok := ctx.View.Picker.GetSelected(); ok {
+		value = item.Value
+	}
+
+	ctx.Pick(ctx, value, value != "")
+}
+
+func actionPickerCancel(ctx *context.AppContext) {
+	if ctx.Pick == nil {
+		return
+	}
+
+	ctx.Pick(ctx, "", false)
+}
+
+// actionSearch will search through the channels based on the users
+// input. A time is implemented to make sure the actual searching
+// and changing of channels is done when the user's typing is paused.
+func actionSearch(ctx *context.AppContext, key rune) {
+	actionInput(ctx.View, key)
+
+	view := ctx.View
+	go func() {
+		if scrollTimer != nil {
+			scrollTimer.Stop()
+		}
+
+		scrollTimer = time.NewTimer(time.Second / 4)
+		<-scrollTimer.C
+
+		// Only actually search when the time expires
+		ctx.Do(func(ctx *context.AppContext) {
+			if ctx.View != view {
+				return
+			}
+
+			term := ctx.View.Input.GetText()
+			ctx.View.Channels.Search(term)
+			actionChangeChannel(ctx)
+		})
+	}()
+}
+
+// actionQuit will exit the program by using os.Exit, this is
+// done because we are using a custom termui EvtStream. Which
+// we won't be able to call termui.StopLoop() on. See main.go
+// for the customEvtStream and why this is done.
+func actionQuit(ctx *context.AppContext) {
+	// The drafts are restored in the next session
+	for _, ws := range ctx.Workspaces {
+		ws.View.Input.SaveDraft()
+		ws.Service.SaveDrafts(ws.View.Input.Drafts)
+		ws.Service.Close()
+	}
+
+	termbox.Close()
+	os.Exit(0)
+}
+
+func actionInsertMode(ctx *context.AppContext) {
+	ctx.Mode = context.InsertMode
+	ctx.View.Mode.SetInsertMode()
+}
+
+func actionCommandMode(ctx *context.AppContext) {
+	actionCancelEdit(ctx)
+	actionCancelReply(ctx)
+
+	ctx.Mode = context.CommandMode
+	ctx.View.Mode.SetCommandMode()
+}
+
+func actionSearchMode(ctx *context.AppContext) {
+	// The Input is used for the search term, the draft is restored
+	// afterwards
+	ctx.View.Input.SaveDraft()
+	ctx.View.Input.Clear()
+	termui.Render(ctx.View.Input)
+
+	ctx.Mode = context.SearchMode
+	ctx.View.Mode.SetSearchMode()
+}
+
+// actionSelectMode will select the last message in the Chat, the selection
+// can be moved and the selected message can be acted upon
+func actionSelectMode(ctx *context.AppContext) {
+	actionCancelEdit(ctx)
+
+	ctx.View.Chat.ClearSelection()
+	if _, ok := ctx.View.Chat.SelectUp(); !ok {
+		return
+	}
+
+	ctx.Mode = context.SelectMode
+	ctx.View.Mode.SetSelectMode()
+	termui.Render(ctx.View.Chat)
+}
+
+func actionGetMessages(ctx *context.AppContext) {
+	msgs, _, err := ctx.Service.GetMessages(
+		ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
+		ctx.View.Chat.GetMaxItems(),
+	)
+	if err != nil {
+		actionShowError(ctx, err, actionGetMessages)
+		return
+	}
+
+	ctx.View.Chat.SetMessages(msgs)
+
+	termui.Render(ctx.View.Chat)
+	actionLoadPreviews(ctx)
+}
+
+// actionMoveCursorUpChannels will execute the actionChangeChannel
+// function. A timer is implemented to support fast scrolling through
+// the list without executing the actionChangeChannel event
+func actionMoveCursorUpChannels(ctx *context.AppContext) {
+	ctx.View.Channels.MoveCursorUp()
+	termui.Render(ctx.View.Channels)
+
+	view := ctx.View
+	go func() {
+		if scrollTimer != nil {
+			scrollTimer.Stop()
+		}
+
+		scrollTimer = time.NewTimer(time.Second / 4)
+		<-scrollTimer.C
+
+		// Only actually change channel when the timer expires
+		ctx.Do(func(ctx *context.AppContext) {
+			if ctx.View == view {
+				actionChangeChannel(ctx)
+			}
+		})
+	}()
+}
+
+// actionMoveCursorDownChannels will execute the actionChangeChannel
+// function. A timer is implemented to support fast scrolling through
+// the list without executing the actionChangeChannel event
+func actionMoveCursorDownChannels(ctx *context.AppContext) {
+	ctx.View.Channels.MoveCursorDown()
+	termui.Render(ctx.View.Channels)
+
+	view := ctx.View
+	go func() {
+		if scrollTimer != nil {
+			scrollTimer.Stop()
+		}
+
+		scrollTimer = time.NewTimer(time.Second / 4)
+		<-scrollTimer.C
+
+		// Only actually change channel when the timer expires
+		ctx.Do(func(ctx *context.AppContext) {
+			if ctx.View == view {
+				actionChangeChannel(ctx)
+			}
+		})
+	}()
+}
+
+func actionMoveCursorTopChannels(ctx *context.AppContext) {
+	ctx.View.Channels.MoveCursorTop()
+	actionChangeChannel(ctx)
+}
+
+func actionMoveCursorBottomChannels(ctx *context.AppContext) {
+	ctx.View.Channels.MoveCursorBottom()
+	actionChangeChannel(ctx)
+}
+
+func actionSearchNextChannels(ctx *context.AppContext) {
+	ctx.View.Channels.SearchNext()
+	actionChangeChannel(ctx)
 }
 
 func actionSearchPrevChannels(ctx *context.AppContext) {
@@ -507,23 +1974,30 @@ func actionJumpChannels(ctx *context.AppContext) {
 }
 
 func actionChangeChannel(ctx *context.AppContext) {
-	// Clear messages from Chat pane
-	ctx.View.Chat.ClearMessages()
-
 	// Get messages of the SelectedChannel, and get the count of messages
-	// that fit into the Chat component
+	// that fit into the Chat component. When this fails we keep showing
+	// the messages we have.
 	msgs, threads, err := ctx.Service.GetMessages(
 		ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
 		ctx.View.Chat.GetMaxItems(),
 	)
 	if err != nil {
-		termbox.Close()
-		log.Println(err)
-		os.Exit(0)
+		actionShowError(ctx, err, actionChangeChannel)
+		return
 	}
 
+	actionShowMessages(ctx, msgs, threads)
+}
+
+// actionShowMessages will show the messages and threads of the selected
+// channel, as they're returned by GetMessages
+func actionShowMessages(ctx *context.AppContext, msgs []components.Message, threads []components.ChannelItem) {
+	// Clear messages from Chat pane
+	ctx.View.Chat.ClearMessages()
+
 	// Set messages for the channel
 	ctx.View.Chat.SetMessages(msgs)
+	actionKeepEdit(ctx)
 
 	// Set the threads identifiers in the threads pane
 	var haveThreads bool
@@ -554,6 +2028,11 @@ func actionChangeChannel(ctx *context.AppContext) {
 		ctx.View.Channels.MarkAsRead(ctx.View.Channels.SelectedChannel)
 	}
 
+	// Set focus, necessary to know when replying to thread or chat, and
+	// to show the draft of the channel
+	ctx.Focus = context.ChatFocus
+	actionSwitchDraft(ctx)
+
 	// Redraw grid, necessary when threads and/or debug is set. We will redraw
 	// the grid when there are threads, or we just came from a thread and went
 	// to a channel without threads. Hence the clearing of ChannelItems of
@@ -569,102 +2048,318 @@ func actionChangeChannel(ctx *context.AppContext) {
 		termui.Render(ctx.View.Chat)
 	}
 
-	// Set focus, necessary to know when replying to thread or chat
-	ctx.Focus = context.ChatFocus
+	// Load the replies of the threads and the previews of images after
+	// the messages are shown
+	go actionLoadReplies(ctx, ctx.Service, ctx.View, channelItem.ID, threads)
+	actionLoadPreviews(ctx)
 }
 
 func actionChangeThread(ctx *context.AppContext) {
-	// Clear messages from Chat pane
-	ctx.View.Chat.ClearMessages()
-
 	// The first channel in the Thread list is current Channel. Set context
-	// Focus and messages accordingly.
+	// Focus and messages accordingly. When this fails we keep showing the
+	// messages we have.
 	var err error
 	msgs := []components.Message{}
 	if ctx.View.Threads.SelectedChannel == 0 {
-		ctx.Focus = context.ChatFocus
-
-		msgs, _, err = ctx.Service.GetMessages(
+		var threads []components.ChannelItem
+		msgs, threads, err = ctx.Service.GetMessages(
 			ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
 			ctx.View.Chat.GetMaxItems(),
 		)
 		if err != nil {
-			termbox.Close()
-			log.Println(err)
-			os.Exit(0)
+			actionShowError(ctx, err, actionChangeThread)
+			return
 		}
+
+		ctx.Focus = context.ChatFocus
+
+		go actionLoadReplies(
+			ctx, ctx.Service, ctx.View,
+			ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
+			threads,
+		)
 	} else {
+		msgs, err = ctx.Service.GetMessageByID(
+			ctx.View.Threads.ChannelItems[ctx.View.Threads.SelectedChannel].ID,
+			ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
+		)
+		if err != nil {
+			actionShowError(ctx, err, actionChangeThread)
+			return
+		}
+
 		ctx.Focus = context.ThreadFocus
+	}
+
+	// Clear messages from Chat pane
+	ctx.View.Chat.ClearMessages()
+
+	// Set messages for the channel
+	ctx.View.Chat.SetMessages(msgs)
+	actionKeepEdit(ctx)
+	actionSwitchDraft(ctx)
+
+	termui.Render(ctx.View.Channels)
+	termui.Render(ctx.View.Threads)
+	termui.Render(ctx.View.Chat)
+	actionLoadPreviews(ctx)
+}
+
+// actionSwitchDraft will keep the text of the Input as the draft of the
+// channel, or thread, it was typed in, and show the draft of the channel or
+// thread that is selected now. The channels and threads are marked, but not
+// rendered. The drafts are stored when they're switched, so they survive a
+// crash.
+func actionSwitchDraft(ctx *context.AppContext) {
+	// While searching the Input holds the search term, the draft is
+	// restored when searching is done
+	if ctx.Mode == context.SearchMode {
+		return
+	}
+
+	// While editing the Input holds the text of the message that is
+	// edited, which isn't a draft. Editing only starts when the Input is
+	// empty, so there is nothing to keep.
+	key := getDraftKey(ctx)
+	if ctx.Edit != nil {
+		ctx.View.Input.DraftKey = key
+		actionMarkDrafts(ctx)
+		return
+	}
+
+	switched := ctx.View.Input.SwitchDraft(key)
+
+	// The Threads could have been replaced, so they're marked again
+	// also when the draft is the same
+	actionMarkDrafts(ctx)
 
-		msgs, err = ctx.Service.GetMessageByID(
-			ctx.View.Threads.ChannelItems[ctx.View.Threads.SelectedChannel].ID,
-			ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID,
-		)
-		if err != nil {
-			termbox.Close()
-			log.Println(err)
-			os.Exit(0)
+	if switched {
+		termui.Render(ctx.View.Input)
+		actionResizeInput(ctx)
+
+		if err := ctx.Service.SaveDrafts(ctx.View.Input.AllDrafts()); err != nil {
+			actionShowError(ctx, err, nil)
 		}
 	}
+}
 
-	// Set messages for the channel
-	ctx.View.Chat.SetMessages(msgs)
+// actionMarkDrafts will mark the channels and threads that have a draft
+func actionMarkDrafts(ctx *context.AppContext) {
+	input := ctx.View.Input
+	channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+
+	ctx.View.Channels.MarkDrafts(input.HasDraft)
+	ctx.View.Threads.MarkDrafts(func(threadID string) bool {
+		// The first item of the Threads pane is the channel itself
+		if threadID == channelID {
+			_, ok := input.Drafts[channelID]
+			return ok
+		}
+		return input.HasDraft(channelID + "/" + threadID)
+	})
+}
 
-	termui.Render(ctx.View.Channels)
-	termui.Render(ctx.View.Threads)
-	termui.Render(ctx.View.Chat)
+// getDraftKey returns the key of the draft of the channel, or thread, that
+// is selected
+func getDraftKey(ctx *context.AppContext) string {
+	key := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+	if ctx.Focus == context.ThreadFocus {
+		key += "/" + ctx.View.Threads.ChannelItems[ctx.View.Threads.SelectedChannel].ID
+	}
+	return key
 }
 
 func actionMoveCursorUpThreads(ctx *context.AppContext) {
+	ctx.View.Threads.MoveCursorUp()
+	termui.Render(ctx.View.Threads)
+
+	view := ctx.View
 	go func() {
 		if scrollTimer != nil {
 			scrollTimer.Stop()
 		}
 
-		ctx.View.Threads.MoveCursorUp()
-		termui.Render(ctx.View.Threads)
-
 		scrollTimer = time.NewTimer(time.Second / 4)
 		<-scrollTimer.C
 
 		// Only actually change channel when the timer expires
-		actionChangeThread(ctx)
+		ctx.Do(func(ctx *context.AppContext) {
+			if ctx.View == view {
+				actionChangeThread(ctx)
+			}
+		})
 	}()
 }
 
 func actionMoveCursorDownThreads(ctx *context.AppContext) {
+	ctx.View.Threads.MoveCursorDown()
+	termui.Render(ctx.View.Threads)
+
+	view := ctx.View
 	go func() {
 		if scrollTimer != nil {
 			scrollTimer.Stop()
 		}
 
-		ctx.View.Threads.MoveCursorDown()
-		termui.Render(ctx.View.Threads)
-
 		scrollTimer = time.NewTimer(time.Second / 4)
 		<-scrollTimer.C
 
 		// Only actually change thread when the timer expires
-		actionChangeThread(ctx)
+		ctx.Do(func(ctx *context.AppContext) {
+			if ctx.View == view {
+				actionChangeThread(ctx)
+			}
+		})
+	}()
+}
+
+// actionLoadReplies will load the replies of the threads in a channel, and
+// add them to the messages in the Chat pane of the view. The replies are
+// loaded concurrently, and are only added when the channel is still on
+// screen.
+func actionLoadReplies(ctx *context.AppContext, svc service.Service, view *views.View, channelID string, threads []components.ChannelItem) {
+	const workers = 4
+
+	queue := make(chan string)
+	go func() {
+		for _, thread := range threads {
+			// The first item of the Threads pane is the channel itself
+			if thread.ID == channelID {
+				continue
+			}
+			queue <- thread.ID
+		}
+		close(queue)
+	}()
+
+	// The replies are requested in parallel, but they're added to the
+	// Chat one thread at a time by the goroutine of the key events
+	for i := 0; i < workers; i++ {
+		go func() {
+			for threadID := range queue {
+				threadID := threadID
+				replies, err := svc.GetReplies(channelID, threadID)
+
+				ctx.Do(func(ctx *context.AppContext) {
+					if err != nil {
+						if ctx.View == view {
+							view.Debug.Println(err.Error())
+						}
+						return
+					}
+
+					if ctx.View != view || ctx.Focus != context.ChatFocus ||
+						view.Channels.ChannelItems[view.Channels.SelectedChannel].ID != channelID {
+						return
+					}
+
+					for _, reply := range replies {
+						view.Chat.AddReply(threadID, reply)
+					}
+					termui.Render(view.Chat)
+					actionLoadPreviews(ctx)
+				})
+			}
+		}()
+	}
+}
+
+// actionLoadPreviews will load the previews of the images in the Chat pane
+// that haven't been loaded yet, when image previews are enabled. Images are
+// loaded one at a time in the background, and the Chat pane is rendered
+// again for every preview.
+func actionLoadPreviews(ctx *context.AppContext) {
+	if !ctx.Config.ImagePreview {
+		return
+	}
+
+	svc := ctx.Service
+	view := ctx.View
+
+	files := view.Chat.MissingPreviews()
+	if len(files) == 0 {
+		return
+	}
+
+	go func() {
+		for _, file := range files {
+			var preview *components.Preview
+
+			data, err := svc.DownloadPreview(file)
+			if err == nil {
+				preview, err = components.NewPreview(
+					data, view.Chat.List.InnerBounds().Dx(), ctx.Config.ImageHeight,
+				)
+			}
+
+			// A preview that fails isn't tried again, the title
+			// of the image is still shown
+			if err != nil {
+				ctx.Do(func(ctx *context.AppContext) {
+					if ctx.View == view {
+						view.Debug.Println(err.Error())
+					}
+				})
+				continue
+			}
+
+			view.Chat.SetPreview(file.ID, preview)
+			ctx.Do(func(ctx *context.AppContext) {
+				if ctx.View == view {
+					termui.Render(view.Chat)
+				}
+			})
+		}
 	}()
 }
 
 // actionNewMessage will set the new message indicator for a channel, and
 // if configured will also display a desktop notification
-func actionNewMessage(ctx *context.AppContext, ev *slack.MessageEvent) {
-	ctx.View.Channels.MarkAsUnread(ev.Channel)
-	termui.Render(ctx.View.Channels)
+func actionNewMessage(ctx *context.AppContext, ws *context.Workspace, ev *service.MessageEvent) {
+	ws.View.Channels.MarkAsUnread(ev.ChannelID)
+	if ctx.IsActive(ws) {
+		termui.Render(ctx.View.Channels)
+	} else {
+		actionRenderWorkspaces(ctx)
+	}
+
+	// Messages we've missed while we were disconnected are only marked,
+	// otherwise we would ring for every one of them after reconnecting
+	if ev.Missed {
+		return
+	}
 
 	// Terminal bell
 	fmt.Print("\a")
 
 	// Desktop notification
 	if ctx.Config.Notify == config.NotifyMention {
-		if isMention(ctx, ev) {
-			createNotifyMessage(ctx, ev)
+		if isMention(ws, ev) {
+			createNotifyMessage(ctx, ws, ev)
 		}
 	} else if ctx.Config.Notify == config.NotifyAll {
-		createNotifyMessage(ctx, ev)
+		createNotifyMessage(ctx, ws, ev)
+	}
+}
+
+// actionSetConnection will show the state of the connection of a workspace
+// in its Mode component
+func actionSetConnection(ctx *context.AppContext, ws *context.Workspace, ev *service.ConnectionEvent) {
+	switch ev.State {
+	case service.ConnectionStateConnecting:
+		ws.View.Mode.SetConnecting(ev.Attempt)
+	case service.ConnectionStateConnected:
+		ws.View.Mode.SetConnected(0)
+	case service.ConnectionStateDisconnected:
+		ws.View.Mode.SetDisconnected()
+	}
+
+	if ev.Err != nil && ctx.Debug {
+		ws.View.Debug.List.Items = append(ws.View.Debug.List.Items, ev.Err.Error())
+	}
+
+	if ctx.IsActive(ws) {
+		termui.Render(ws.View.Mode)
 	}
 }
 
@@ -673,22 +2368,48 @@ func actionSetPresence(ctx *context.AppContext, channelID string, presence strin
 	termui.Render(ctx.View.Channels)
 }
 
-// actionPresenceAll will set the presence of the user list. Because the
-// requests to the endpoint are rate limited we implement a timeout here.
-func actionSetPresenceAll(ctx *context.AppContext) {
-	for _, chn := range ctx.Service.Conversations {
-		if chn.IsIM {
+// actionSetReadState will remove the new message indicator of a channel,
+// when it has been read in another client
+func actionSetReadState(ctx *context.AppContext, channelID string) {
+	for i, channel := range ctx.View.Channels.ChannelItems {
+		if channel.ID == channelID && channel.Notification {
+			ctx.View.Channels.MarkAsRead(i)
+			termui.Render(ctx.View.Channels)
+			break
+		}
+	}
+}
+
+// actionPresenceAll will set the presence of the user list of a workspace.
+// The requests to the endpoint are rate limited, the service will space
+// them out, and prioritize the requests the user is waiting on. So they're
+// done in the background, and every result is set through ctx.Do. The im
+// channels without a presence are skipped, the service leaves it empty when
+// the presence isn't updated, as in Socket Mode.
+func actionSetPresenceAll(ctx *context.AppContext, ws *context.Workspace) {
+	var ims []components.ChannelItem
+	for _, chn := range ws.View.Channels.ChannelItems {
+		if chn.Type == components.ChannelTypeIM && chn.Presence != "" {
+			ims = append(ims, chn)
+		}
+	}
 
-			presence, err := ctx.Service.GetUserPresence(chn.User)
+	go func() {
+		for _, chn := range ims {
+			presence, err := ws.Service.GetUserPresence(chn.UserID)
 			if err != nil {
 				presence = "away"
 			}
-			ctx.View.Channels.SetPresence(chn.ID, presence)
 
-			termui.Render(ctx.View.Channels)
-			time.Sleep(1200 * time.Millisecond)
+			channelID := chn.ID
+			ctx.Do(func(ctx *context.AppContext) {
+				ws.View.Channels.SetPresence(channelID, presence)
+				if ctx.IsActive(ws) {
+					termui.Render(ctx.View.Channels)
+				}
+			})
 		}
-	}
+	}()
 }
 
 func actionScrollUpChat(ctx *context.AppContext) {
@@ -701,12 +2422,405 @@ func actionScrollDownChat(ctx *context.AppContext) {
 	termui.Render(ctx.View.Chat)
 }
 
+func actionSelectUp(ctx *context.AppContext) {
+	ctx.View.Chat.SelectUp()
+	termui.Render(ctx.View.Chat)
+}
+
+func actionSelectDown(ctx *context.AppContext) {
+	ctx.View.Chat.SelectDown()
+	termui.Render(ctx.View.Chat)
+}
+
+// actionSelectParent will select the message a selected reply belongs to
+func actionSelectParent(ctx *context.AppContext) {
+	parent, ok := ctx.View.Chat.GetParent(ctx.View.Chat.GetSelectedID())
+	if !ok {
+		return
+	}
+
+	ctx.View.Chat.Select(parent.ID)
+	ctx.View.Chat.ScrollToSelected()
+	termui.Render(ctx.View.Chat)
+}
+
+// actionSelectCancel will remove the selection and return to command mode
+func actionSelectCancel(ctx *context.AppContext) {
+	ctx.View.Chat.ClearSelection()
+	termui.Render(ctx.View.Chat)
+
+	ctx.Mode = context.CommandMode
+	ctx.View.Mode.SetCommandMode()
+}
+
+// actionSelectReply will switch to insert mode, the message that is sent
+// next is a reply in the thread of the selected message. When it is a reply
+// itself, it goes to the same thread.
+func actionSelectReply(ctx *context.AppContext) {
+	msg, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok {
+		return
+	}
+
+	threadID := msg.ID
+	if parent, ok := ctx.View.Chat.GetParent(msg.ID); ok {
+		threadID = parent.ID
+	}
+
+	actionSelectCancel(ctx)
+
+	ctx.ReplyTo = threadID
+	ctx.View.Input.SetInfo(fmt.Sprintf("reply to %s", msg.Name))
+	termui.Render(ctx.View.Input)
+
+	actionInsertMode(ctx)
+}
+
+// actionCancelReply will stop replying to the message that was selected
+func actionCancelReply(ctx *context.AppContext) {
+	if ctx.ReplyTo == "" {
+		return
+	}
+
+	ctx.ReplyTo = ""
+	ctx.View.Input.ClearStatus()
+	termui.Render(ctx.View.Input)
+}
+
+// actionSelectEdit will edit the selected message in insert mode, when it
+// is a message of the current user
+func actionSelectEdit(ctx *context.AppContext) {
+	msg, ok := getSelectedOwnMessage(ctx)
+	if !ok {
+		return
+	}
+
+	// The text in the Input would be replaced by the message
+	if !ctx.View.Input.IsEmpty() {
+		actionShowError(ctx, errors.New("the input isn't empty"), nil)
+		return
+	}
+
+	ctx.Mode = context.InsertMode
+	actionStartEdit(ctx, msg)
+}
+
+// actionSelectDelete will delete the selected message, when it is a message
+// of the current user and the user has confirmed it
+func actionSelectDelete(ctx *context.AppContext) {
+	msg, ok := getSelectedOwnMessage(ctx)
+	if !ok {
+		return
+	}
+
+	channelID := ctx.View.Channels.ChannelItems[ctx.View.Channels.SelectedChannel].ID
+	actionConfirm(ctx, "delete message?", func(ctx *context.AppContext, yes bool) {
+		if yes {
+			actionRemoveMessage(ctx, channelID, msg.ID)
+		}
+	})
+}
+
+// getSelectedOwnMessage returns the selected message when it is a message
+// of the current user, otherwise an error is shown
+func getSelectedOwnMessage(ctx *context.AppContext) (components.Message, bool) {
+	msg, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok {
+		return msg, false
+	}
+
+	if msg.UserID != ctx.Service.GetCurrentUserID() {
+		actionShowError(ctx, errors.New("this isn't your message"), nil)
+		return msg, false
+	}
+
+	return msg, true
+}
+
+// actionSelectCopy will copy the text of the selected message to the
+// clipboard
+func actionSelectCopy(ctx *context.AppContext) {
+	msg, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok {
+		return
+	}
+
+	if err := copyToClipboard(ctx, getMessageText(msg)); err != nil {
+		actionShowError(ctx, fmt.Errorf("copying message: %v", err), nil)
+	}
+}
+
+// copyToClipboard will copy text with the `copy_command` of the config.
+// When that isn't set a clipboard program of the system is used, and when
+// there is none the terminal is asked to copy it with an OSC 52 sequence.
+func copyToClipboard(ctx *context.AppContext, text string) error {
+	var args []string
+	switch {
+	case ctx.Config.CopyCommand != "":
+		args = strings.Fields(ctx.Config.CopyCommand)
+	case runtime.GOOS == "darwin":
+		args = []string{"pbcopy"}
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasCommand("wl-copy"):
+		args = []string{"wl-copy"}
+	case os.Getenv("DISPLAY") != "" && hasCommand("xclip"):
+		args = []string{"xclip", "-selection", "clipboard"}
+	case os.Getenv("DISPLAY") != "" && hasCommand("xsel"):
+		args = []string{"xsel", "--clipboard", "--input"}
+	default:
+		_, err := fmt.Fprintf(
+			os.Stdout, "\x1b]52;c;%s\a",
+			base64.StdEncoding.EncodeToString([]byte(text)),
+		)
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// hasCommand returns true when the program name can be found in $PATH
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// linkRegex matches the urls in the text of a message
+var linkRegex = regexp.MustCompile(`(?:https?|ftp)://[^\s()<>]+`)
+
+// actionSelectOpenLink will open a link in the selected message with the
+// `open_command` of the config, or else with the opener of the system.
+// When the message has more than one link, the link can be picked.
+func actionSelectOpenLink(ctx *context.AppContext) {
+	msg, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok {
+		return
+	}
+
+	links := findLinks(msg)
+	if len(links) == 0 {
+		actionShowError(ctx, errors.New("there is no link to open"), nil)
+		return
+	}
+
+	if len(links) == 1 {
+		actionOpenLink(ctx, links[0])
+		return
+	}
+
+	var items []components.PickerItem
+	for _, link := range links {
+		items = append(items, components.PickerItem{
+			Label: link,
+			Value: link,
+		})
+	}
+
+	actionPick(ctx, "links", items, func(ctx *context.AppContext, link string, ok bool) {
+		if ok {
+			actionOpenLink(ctx, link)
+		}
+	})
+}
+
+// findLinks returns the links in the text of msg and its attachments, in
+// the order they appear, without duplicates. Punctuation that follows a link
+// isn't part of it.
+func findLinks(msg components.Message) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, link := range linkRegex.FindAllString(getMessageText(msg), -1) {
+		link = strings.TrimRight(link, ".,;:!?'\"")
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	return links
+}
+
+// actionOpenLink will open link with the `open_command` of the config, or
+// else with open or xdg-open. These open the link in another program, like a
+// browser, so the terminal is kept and we don't wait for them.
+func actionOpenLink(ctx *context.AppContext, link string) {
+	var args []string
+	switch {
+	case ctx.Config.OpenCommand != "":
+		args = strings.Fields(ctx.Config.OpenCommand)
+	case runtime.GOOS == "darwin":
+		args = []string{"open"}
+	default:
+		args = []string{"xdg-open"}
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], link)...)
+	if err := cmd.Start(); err != nil {
+		actionShowError(ctx, fmt.Errorf("opening %s: %v", link, err), nil)
+		return
+	}
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			ctx.Do(func(ctx *context.AppContext) {
+				actionShowError(ctx, fmt.Errorf("opening %s: %v", link, err), nil)
+			})
+		}
+	}()
+}
+
+// actionSelectRaw will show the selected message, as it was decoded by the
+// slack library, in the Viewer
+func actionSelectRaw(ctx *context.AppContext) {
+	msg, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok {
+		return
+	}
+
+	var raw bytes.Buffer
+	if err := json.Indent(&raw, msg.Raw, "", "  "); err != nil {
+		actionShowError(ctx, errors.New("the raw message isn't available"), nil)
+		return
+	}
+
+	actionShowViewer(ctx, fmt.Sprintf("message %s", msg.ID), raw.String())
+}
+
+// getMessageText returns the text of msg, together with the text of its
+// attachments and blocks
+func getMessageText(msg components.Message) string {
+	var lines []string
+	if msg.Content != "" {
+		lines = append(lines, msg.Content)
+	}
+
+	for _, m := range components.SortMessages(msg.Messages) {
+		if m.Name == "" && m.Content != "" {
+			lines = append(lines, m.Content)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func actionNextWorkspace(ctx *context.AppContext) {
+	actionChangeWorkspace(ctx, (ctx.ActiveWorkspace+1)%len(ctx.Workspaces))
+}
+
+func actionPrevWorkspace(ctx *context.AppContext) {
+	actionChangeWorkspace(ctx, (ctx.ActiveWorkspace+len(ctx.Workspaces)-1)%len(ctx.Workspaces))
+}
+
+// actionChangeWorkspace will put the workspace at index on screen
+func actionChangeWorkspace(ctx *context.AppContext, index int) {
+	if index == ctx.ActiveWorkspace {
+		return
+	}
+
+	actionCancelEdit(ctx)
+	ctx.SetActiveWorkspace(index)
+
+	// Views of workspaces that weren't on screen haven't received the
+	// latest resize events, and mode changes
+	actionResizeView(ctx)
+	switch ctx.Mode {
+	case context.InsertMode:
+		ctx.View.Mode.SetInsertMode()
+	case context.SearchMode:
+		ctx.View.Mode.SetSearchMode()
+	default:
+		ctx.View.Mode.SetCommandMode()
+	}
+
+	ctx.Focus = context.ChatFocus
+	ctx.View.Threads.MoveCursorTop()
+
+	actionRenderWorkspaces(ctx)
+	actionRedrawGrid(ctx, len(ctx.View.Threads.ChannelItems) > 0, ctx.Debug)
+}
+
+// actionRenderWorkspaces will set the label of the Channels pane of the
+// workspace on screen. When there are multiple workspaces, they are listed
+// with the active one between brackets, and a notification icon for the
+// workspaces that have unread messages. The workspaces that couldn't be
+// created are listed last, with a failed icon.
+func actionRenderWorkspaces(ctx *context.AppContext) {
+	if len(ctx.Workspaces)+len(ctx.FailedWorkspaces) < 2 {
+		return
+	}
+
+	var names []string
+	for i, ws := range ctx.Workspaces {
+		if i == ctx.ActiveWorkspace {
+			names = append(names, fmt.Sprintf("[%s]", ws.Name))
+		} else if ws.Notification {
+			names = append(names, ws.Name+components.IconNotification)
+		} else {
+			names = append(names, ws.Name)
+		}
+	}
+	for _, ws := range ctx.FailedWorkspaces {
+		names = append(names, ws.Name+components.IconFailed)
+	}
+
+	ctx.View.Channels.List.BorderLabel = strings.Join(names, " ")
+	termui.Render(ctx.View.Channels)
+}
+
+// actionShowError will show the error in the status area, which is the
+// border of the Input component. When retry is set, the failed action can be
+// executed again with the `retry` action.
+func actionShowError(ctx *context.AppContext, err error, retry func(*context.AppContext)) {
+	ctx.Retry = retry
+
+	status := err.Error()
+	if key := getKeyForAction(ctx, context.CommandMode, "retry"); key != "" {
+		if retry != nil {
+			status = fmt.Sprintf("%s (%s: retry)", status, key)
+		} else {
+			status = fmt.Sprintf("%s (%s: dismiss)", status, key)
+		}
+	}
+
+	ctx.View.Input.SetStatus(status)
+	termui.Render(ctx.View.Input)
+
+	if ctx.Debug {
+		ctx.View.Debug.Println(err.Error())
+	}
+}
+
+// actionRetry will clear the status area, and execute the action that failed
+// most recently again
+func actionRetry(ctx *context.AppContext) {
+	retry := ctx.Retry
+
+	ctx.Retry = nil
+	ctx.View.Input.ClearStatus()
+	termui.Render(ctx.View.Input)
+
+	if retry != nil {
+		retry(ctx)
+	}
+}
+
 func actionHelp(ctx *context.AppContext) {
 	ctx.View.Chat.ClearMessages()
 	ctx.View.Chat.Help(ctx.Usage, ctx.Config)
 	termui.Render(ctx.View.Chat)
 }
 
+// getKeyForAction returns the key that is bound to the action in mode, or an
+// empty string when there is none
+func getKeyForAction(ctx *context.AppContext, mode string, action string) string {
+	for key, name := range ctx.Config.KeyMap[mode] {
+		if name == action {
+			return key
+		}
+	}
+	return ""
+}
+
 // GetKeyString will return a string that resembles the key event from
 // termbox. This is blatanly copied from termui because it is an unexported
 // function.
@@ -734,7 +2848,7 @@ func getKeyString(e termbox.Event) string {
 
 		if e.Key <= 0x7F {
 			pre = "C-"
-			k = string('a' - 1 + int(e.Key))
+			k = string(rune('a' - 1 + int(e.Key)))
 			kmap := map[termbox.Key][2]string{
 				termbox.KeyCtrlSpace:     {"C-", "<space>"},
 				termbox.KeyBackspace:     {"", "<backspace>"},
@@ -759,8 +2873,8 @@ func getKeyString(e termbox.Event) string {
 
 // isMention check if the message event either contains a
 // mention or is posted on an IM channel.
-func isMention(ctx *context.AppContext, ev *slack.MessageEvent) bool {
-	channel := ctx.View.Channels.ChannelItems[ctx.View.Channels.FindChannel(ev.Channel)]
+func isMention(ws *context.Workspace, ev *service.MessageEvent) bool {
+	channel := ws.View.Channels.ChannelItems[ws.View.Channels.FindChannel(ev.ChannelID)]
 
 	if channel.Type == components.ChannelTypeIM {
 		return true
@@ -772,7 +2886,7 @@ func isMention(ctx *context.AppContext, ev *slack.MessageEvent) bool {
 	r := regexp.MustCompile(`\<@(\w+\|*\w+)\>`)
 	matches := r.FindAllString(ev.Text, -1)
 	for _, match := range matches {
-		if strings.Contains(match, ctx.Service.CurrentUserID) {
+		if strings.Contains(match, ws.Service.GetCurrentUserID()) {
 			return true
 		}
 	}
@@ -780,29 +2894,34 @@ func isMention(ctx *context.AppContext, ev *slack.MessageEvent) bool {
 	return false
 }
 
-func createNotifyMessage(ctx *context.AppContext, ev *slack.MessageEvent) {
-	go func() {
-		if notifyTimer != nil {
-			notifyTimer.Stop()
-		}
-
-		// Only actually notify when time expires
-		notifyTimer = time.NewTimer(time.Second * 2)
-		<-notifyTimer.C
-
-		var message string
-		channel := ctx.View.Channels.ChannelItems[ctx.View.Channels.FindChannel(ev.Channel)]
-		switch channel.Type {
-		case components.ChannelTypeChannel:
-			message = fmt.Sprintf("Message received on channel: %s", channel.Name)
-		case components.ChannelTypeGroup:
-			message = fmt.Sprintf("Message received in group: %s", channel.Name)
-		case components.ChannelTypeIM:
-			message = fmt.Sprintf("Message received from: %s", channel.Name)
-		default:
-			message = fmt.Sprintf("Message received from: %s", channel.Name)
-		}
+// createNotifyMessage will push a desktop notification for the message.
+// The message is created right away, but only pushed when no other message
+// arrives in the next 2 seconds.
+func createNotifyMessage(ctx *context.AppContext, ws *context.Workspace, ev *service.MessageEvent) {
+	var message string
+	channel := ws.View.Channels.ChannelItems[ws.View.Channels.FindChannel(ev.ChannelID)]
+	switch channel.Type {
+	case components.ChannelTypeChannel:
+		message = fmt.Sprintf("Message received on channel: %s", channel.Name)
+	case components.ChannelTypeGroup:
+		message = fmt.Sprintf("Message received in group: %s", channel.Name)
+	case components.ChannelTypeIM:
+		message = fmt.Sprintf("Message received from: %s", channel.Name)
+	default:
+		message = fmt.Sprintf("Message received from: %s", channel.Name)
+	}
+
+	// Prefix the message with the workspace, when there is more than one
+	if len(ctx.Workspaces) > 1 {
+		message = fmt.Sprintf("[%s] %s", ws.Name, message)
+	}
+
+	if notifyTimer != nil {
+		notifyTimer.Stop()
+	}
 
+	// Only actually notify when time expires
+	notifyTimer = time.AfterFunc(time.Second*2, func() {
 		ctx.Notify.Push("slack-term", message, "", notificator.UR_NORMAL)
-	}()
+	})
 }
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/erroneousboat/slack-term/components"
+	"github.com/erroneousboat/slack-term/config"
+	"github.com/erroneousboat/slack-term/context"
+	"github.com/erroneousboat/slack-term/service"
+	"github.com/erroneousboat/slack-term/views"
+)
+
+// newTestWorkspace returns a workspace of alice with the channel #general
+// and an im channel with bob
+func newTestWorkspace() *context.Workspace {
+	svc := service.NewFakeService(&config.Config{}, "U1", "alice")
+
+	channels := components.CreateChannelsComponent(10)
+	channels.SetChannels([]components.ChannelItem{
+		{ID: "C1", Name: "general", Type: components.ChannelTypeChannel},
+		{ID: "D1", Name: "bob", Type: components.ChannelTypeIM, UserID: "U2"},
+	})
+
+	return &context.Workspace{
+		Name:    "test",
+		Service: svc,
+		View:    &views.View{Channels: channels},
+	}
+}
+
+func TestIsMention(t *testing.T) {
+	ws := newTestWorkspace()
+
+	tests := []struct {
+		channelID string
+		text      string
+		want      bool
+	}{
+		{"C1", "hello", false},
+		{"C1", "hello <@U1>", true},
+		{"C1", "hello <@U1|alice>", true},
+		{"C1", "hello <@U2>", false},
+		{"D1", "hello", true},
+	}
+
+	for _, test := range tests {
+		ev := &service.MessageEvent{ChannelID: test.channelID, Text: test.text}
+		if got := isMention(ws, ev); got != test.want {
+			t.Errorf("isMention(%s, %q) = %v, want %v", test.channelID, test.text, got, test.want)
+		}
+	}
+}
+
+func TestToggleReaction(t *testing.T) {
+	ws := newTestWorkspace()
+
+	tests := []struct {
+		reactions []components.Reaction
+		want      bool
+	}{
+		{nil, true},
+		{[]components.Reaction{{Name: "tada", Count: 1, Users: []string{"U1"}}}, false},
+		{[]components.Reaction{{Name: "tada", Count: 1, Users: []string{"U2"}}}, true},
+		{[]components.Reaction{{Name: "eyes", Count: 1, Users: []string{"U1"}}}, true},
+	}
+
+	for _, test := range tests {
+		msg := components.Message{ID: "1500000000.000000", Reactions: test.reactions}
+		if err := toggleReaction(ws.Service, "C1", msg, "tada"); err != nil {
+			t.Fatal(err)
+		}
+
+		ev, ok := (<-ws.Service.Events()).Data.(*service.ReactionEvent)
+		if !ok {
+			t.Fatalf("got no reaction event")
+		}
+		if ev.Reaction != "tada" || ev.MessageID != msg.ID || ev.Added != test.want {
+			t.Errorf("reactions %v: got %+v, want added %v", test.reactions, ev, test.want)
+		}
+	}
+}
+
+func TestIsPaste(t *testing.T) {
+	tests := []struct {
+		waiting   int
+		sinceLast time.Duration
+		want      bool
+	}{
+		{0, time.Second, false},
+		{0, 50 * time.Millisecond, false},
+		{3, time.Second, true},
+		{0, time.Millisecond, true},
+	}
+
+	for _, test := range tests {
+		if got := isPaste(test.waiting, test.sinceLast); got != test.want {
+			t.Errorf("isPaste(%d, %s) = %v, want %v", test.waiting, test.sinceLast, got, test.want)
+		}
+	}
+}
+
+func TestParseUploadCommand(t *testing.T) {
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	os.Setenv("HOME", "/home/alice")
+
+	tests := []struct {
+		message string
+		cmd     string
+		arg     string
+		comment string
+		ok      bool
+	}{
+		{"/upload", "upload", "", "", true},
+		{"/upload report.pdf", "upload", "report.pdf", "", true},
+		{"/upload  report.pdf   the report  ", "upload", "report.pdf", "the report", true},
+		{"/upload ~/report.pdf", "upload", "/home/alice/report.pdf", "", true},
+		{"/snippet", "snippet", "", "", true},
+		{"/snippet func main() {\n}", "snippet", "func main() {\n}", "", true},
+		{"/uploads report.pdf", "", "", "", false},
+		{"upload report.pdf", "", "", "", false},
+		{"/shrug", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		cmd, arg, comment, ok := parseUploadCommand(test.message)
+		if cmd != test.cmd || arg != test.arg || comment != test.comment || ok != test.ok {
+			t.Errorf(
+				"parseUploadCommand(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+				test.message, cmd, arg, comment, ok, test.cmd, test.arg, test.comment, test.ok,
+			)
+		}
+	}
+}
+
+func TestGetCompleteItems(t *testing.T) {
+	ws := newTestWorkspace()
+	svc := ws.Service.(*service.FakeService)
+	svc.AddUser("U2", "bob", components.PresenceActive)
+	svc.AddUser("U3", "carol", components.PresenceAway)
+
+	ctx := &context.AppContext{
+		Config:  &config.Config{},
+		Service: ws.Service,
+		View:    ws.View,
+	}
+
+	tests := []struct {
+		text   string
+		cursor int
+		start  int
+		title  string
+		first  string
+	}{
+		{"hi @bo", 6, 3, "users", "@bob "},
+		{"hi @bo there", 6, 3, "users", "@bob"},
+		{"#gen", 4, 0, "channels", "#general "},
+		{"hi :tada", 8, 3, "emoji", ":tada: "},
+		{"/up", 3, 0, "commands", "/upload "},
+		{"hi /up", 6, 3, "", ""},
+		{"hello", 5, 0, "", ""},
+		{"hi ", 3, 3, "", ""},
+	}
+
+	for _, test := range tests {
+		start, term, title, items := getCompleteItems(ctx, []rune(test.text), test.cursor)
+
+		picker := components.CreatePickerComponent()
+		picker.SetItems(items)
+		picker.Filter(term)
+
+		var first string
+		if item, ok := picker.GetSelected(); ok && len(items) > 0 {
+			first = item.Value
+		}
+
+		if start != test.start || title != test.title || first != test.first {
+			t.Errorf(
+				"getCompleteItems(%q, %d) = %d, %q, %q, want %d, %q, %q",
+				test.text, test.cursor, start, title, first, test.start, test.title, test.first,
+			)
+		}
+	}
+}
+
+func TestFindLinks(t *testing.T) {
+	tests := []struct {
+		content     string
+		attachments []string
+		want        string
+	}{
+		{"no links here", nil, "[]"},
+		{"see https://example.com.", nil, "[https://example.com]"},
+		{"(https://example.com/a?b=c) and ftp://files.example.com/x!", nil, "[https://example.com/a?b=c ftp://files.example.com/x]"},
+		{"https://example.com and https://example.com again", nil, "[https://example.com]"},
+		{"the report", []string{"*Report* (https://example.com/report)"}, "[https://example.com/report]"},
+	}
+
+	for _, test := range tests {
+		msg := components.Message{ID: "1", Name: "bob", Content: test.content, Messages: make(map[string]components.Message)}
+		for i, content := range test.attachments {
+			id := fmt.Sprintf("1-%d", i)
+			msg.Messages[id] = components.Message{ID: id, Content: content}
+		}
+
+		if got := fmt.Sprint(findLinks(msg)); got != test.want {
+			t.Errorf("findLinks(%q, %q) = %s, want %s", test.content, test.attachments, got, test.want)
+		}
+	}
+}
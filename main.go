@@ -105,6 +105,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Image previews use the colors of the 256 color palette
+	if ctx.Config.ImagePreview {
+		termbox.SetOutputMode(termbox.Output256)
+	}
+
 	// Initialize handlers
 	handlers.Initialize(ctx)
 
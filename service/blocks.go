@@ -0,0 +1,327 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// The slack library decodes the header and rich text blocks as an
+// UnknownBlock, which only has the type of the block. We decode them from
+// the json of the messages ourselves, which is kept by the recordingClient
+// for the responses of the web api, and is at hand for the events of Socket
+// Mode and the messages in the Cache. Events of the RTM api are decoded by
+// the slack library alone, so those blocks are only known after the
+// messages are loaded again.
+
+// headerBlock is a block with a title in plain text
+//
+// https://api.slack.com/reference/block-kit/blocks#header
+type headerBlock struct {
+	Type    slack.MessageBlockType `json:"type"`
+	BlockID string                 `json:"block_id,omitempty"`
+	Text    *slack.TextBlockObject `json:"text"`
+}
+
+func (b *headerBlock) BlockType() slack.MessageBlockType {
+	return b.Type
+}
+
+// richTextBlock is the formatted text of a message, it is what the composer
+// of slack sends along with the text of a message
+//
+// https://api.slack.com/reference/block-kit/blocks#rich_text
+type richTextBlock struct {
+	Type     slack.MessageBlockType `json:"type"`
+	BlockID  string                 `json:"block_id,omitempty"`
+	Elements []richTextElement      `json:"elements"`
+}
+
+func (b *richTextBlock) BlockType() slack.MessageBlockType {
+	return b.Type
+}
+
+// richTextElement is an element of a rich text block. The sections, lists,
+// quotes and preformatted text contain Elements, the other elements are the
+// text, links, mentions and emoji in them.
+type richTextElement struct {
+	Type     string            `json:"type"`
+	Elements []richTextElement `json:"elements,omitempty"`
+
+	// Style is the style of a list, "bullet" or "ordered", or the
+	// style of the text as an object
+	Style  json.RawMessage `json:"style,omitempty"`
+	Indent int             `json:"indent,omitempty"`
+
+	Text        string `json:"text,omitempty"`
+	URL         string `json:"url,omitempty"`
+	UserID      string `json:"user_id,omitempty"`
+	ChannelID   string `json:"channel_id,omitempty"`
+	UsergroupID string `json:"usergroup_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Range       string `json:"range,omitempty"`
+	Timestamp   int64  `json:"timestamp,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Fallback    string `json:"fallback,omitempty"`
+}
+
+// richTextStyle is the style of a text element
+type richTextStyle struct {
+	Bold   bool `json:"bold"`
+	Italic bool `json:"italic"`
+	Strike bool `json:"strike"`
+	Code   bool `json:"code"`
+}
+
+// rawMessage holds the blocks of a message, and of its attachments, as json
+type rawMessage struct {
+	Blocks      []json.RawMessage `json:"blocks"`
+	Attachments []struct {
+		Blocks []json.RawMessage `json:"blocks"`
+	} `json:"attachments"`
+}
+
+// restoreMessages will decode the header and rich text blocks of every
+// message from its json in raw, the messages and raw should be in the same
+// order
+func restoreMessages(messages []slack.Message, raw []rawMessage) {
+	if len(messages) != len(raw) {
+		return
+	}
+
+	for i := range messages {
+		restoreMessage(&messages[i].Msg, raw[i])
+	}
+}
+
+// restoreMessage will decode the header and rich text blocks of msg, and of
+// its attachments, from its json
+func restoreMessage(msg *slack.Msg, raw rawMessage) {
+	msg.Blocks = restoreBlocks(msg.Blocks, raw.Blocks)
+
+	if len(msg.Attachments) != len(raw.Attachments) {
+		return
+	}
+	for i := range msg.Attachments {
+		msg.Attachments[i].Blocks = restoreBlocks(
+			msg.Attachments[i].Blocks, raw.Attachments[i].Blocks,
+		)
+	}
+}
+
+// restoreBlocks replaces the header and rich text blocks in blocks, which
+// the slack library decoded as an UnknownBlock, by decoding them from raw
+func restoreBlocks(blocks slack.Blocks, raw []json.RawMessage) slack.Blocks {
+	if len(blocks.BlockSet) != len(raw) {
+		return blocks
+	}
+
+	for i, block := range blocks.BlockSet {
+		unknown, ok := block.(*slack.UnknownBlock)
+		if !ok {
+			continue
+		}
+
+		var restored slack.Block
+		switch unknown.Type {
+		case "header":
+			restored = &headerBlock{}
+		case "rich_text":
+			restored = &richTextBlock{}
+		default:
+			continue
+		}
+
+		if err := json.Unmarshal(raw[i], restored); err == nil {
+			blocks.BlockSet[i] = restored
+		}
+	}
+
+	return blocks
+}
+
+// onlyRichText returns true when every block is a rich text block, which
+// means the blocks are the same as the text of the message
+func onlyRichText(blocks slack.Blocks) bool {
+	for _, block := range blocks.BlockSet {
+		if block.BlockType() != "rich_text" {
+			return false
+		}
+	}
+	return true
+}
+
+// richTextToMrkdwn returns the rich text elements in the message format of
+// slack, like the text of a message
+func richTextToMrkdwn(elements []richTextElement) string {
+	var parts []string
+	for _, elem := range elements {
+		var part string
+		switch elem.Type {
+		case "rich_text_section":
+			part = richTextInline(elem.Elements)
+		case "rich_text_list":
+			var style string
+			json.Unmarshal(elem.Style, &style)
+
+			var items []string
+			indent := strings.Repeat("    ", elem.Indent)
+			for n, item := range elem.Elements {
+				bullet := "•"
+				if style == "ordered" {
+					bullet = fmt.Sprintf("%d.", n+1)
+				}
+				items = append(items, fmt.Sprintf(
+					"%s%s %s", indent, bullet, richTextInline(item.Elements),
+				))
+			}
+			part = strings.Join(items, "\n")
+		case "rich_text_preformatted":
+			part = "```" + richTextInline(elem.Elements) + "```"
+		case "rich_text_quote":
+			lines := strings.Split(
+				strings.TrimRight(richTextInline(elem.Elements), "\n"), "\n",
+			)
+			part = "&gt; " + strings.Join(lines, "\n&gt; ")
+		}
+
+		parts = append(parts, strings.TrimRight(part, "\n"))
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// richTextInline returns the text, links, mentions and emoji of a rich text
+// section in the message format of slack
+func richTextInline(elements []richTextElement) string {
+	var text strings.Builder
+	for _, elem := range elements {
+		switch elem.Type {
+		case "text":
+			var style richTextStyle
+			json.Unmarshal(elem.Style, &style)
+
+			t := escaper.Replace(elem.Text)
+			switch {
+			case style.Code:
+				t = "`" + t + "`"
+			case t == "":
+			default:
+				if style.Bold {
+					t = "*" + t + "*"
+				}
+				if style.Italic {
+					t = "_" + t + "_"
+				}
+				if style.Strike {
+					t = "~" + t + "~"
+				}
+			}
+			text.WriteString(t)
+		case "link":
+			if elem.Text != "" {
+				text.WriteString("<" + elem.URL + "|" + escaper.Replace(elem.Text) + ">")
+			} else {
+				text.WriteString("<" + elem.URL + ">")
+			}
+		case "user":
+			text.WriteString("<@" + elem.UserID + ">")
+		case "channel":
+			text.WriteString("<#" + elem.ChannelID + ">")
+		case "usergroup":
+			text.WriteString("<!subteam^" + elem.UsergroupID + ">")
+		case "broadcast":
+			text.WriteString("<!" + elem.Range + ">")
+		case "emoji":
+			text.WriteString(":" + elem.Name + ":")
+		case "date":
+			text.WriteString(fmt.Sprintf(
+				"<!date^%d^%s|%s>", elem.Timestamp, elem.Format, elem.Fallback,
+			))
+		}
+	}
+
+	return text.String()
+}
+
+// rawBodyKey is the key of the context value in which the recordingClient
+// keeps the body of a response
+type rawBodyKey struct{}
+
+// recordingClient is the http client of the slack library. When the context
+// of a request has a *[]byte under rawBodyKey, the body of the response is
+// copied into it, so we can decode what the slack library can't.
+type recordingClient struct {
+	client *http.Client
+}
+
+func (c recordingClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+
+	body, ok := req.Context().Value(rawBodyKey{}).(*[]byte)
+	if !ok {
+		return resp, nil
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	*body = data
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return resp, nil
+}
+
+// getConversationHistory is Client.GetConversationHistory, with the header
+// and rich text blocks of the messages decoded
+func (s *SlackService) getConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	var body []byte
+	ctx := context.WithValue(context.Background(), rawBodyKey{}, &body)
+
+	history, err := s.Client.GetConversationHistoryContext(ctx, params)
+	if err != nil {
+		return history, err
+	}
+
+	var raw struct {
+		Messages []rawMessage `json:"messages"`
+	}
+	if json.Unmarshal(body, &raw) == nil {
+		restoreMessages(history.Messages, raw.Messages)
+	}
+
+	return history, nil
+}
+
+// getConversationReplies is Client.GetConversationReplies, with the header
+// and rich text blocks of the messages decoded
+func (s *SlackService) getConversationReplies(params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error) {
+	var body []byte
+	ctx := context.WithValue(context.Background(), rawBodyKey{}, &body)
+
+	msgs, hasMore, cursor, err := s.Client.GetConversationRepliesContext(ctx, params)
+	if err != nil {
+		return msgs, hasMore, cursor, err
+	}
+
+	var raw struct {
+		Messages []rawMessage `json:"messages"`
+	}
+	if json.Unmarshal(body, &raw) == nil {
+		restoreMessages(msgs, raw.Messages)
+	}
+
+	return msgs, hasMore, cursor, nil
+}
@@ -0,0 +1,607 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/erroneousboat/slack-term/components"
+)
+
+// Cache is the on-disk store of a workspace. It keeps the users, the
+// conversations, and the history of every channel that has been opened, so
+// that slack-term can start without downloading everything again, and can
+// show the cached channels when there is no connection.
+//
+// The files are stored as json in the cache directory of the workspace:
+//
+//	session.json
+//	users.json
+//	conversations.json
+//	input_history.json
+//	drafts.json
+//	history/<channel id>.json
+//
+// When the directory is empty the cache is disabled, nothing will be stored
+// and nothing will be found.
+//
+// The histories are kept in memory once they're loaded, changes to them are
+// written to disk by Flush, which is called a while after the first change
+// so that a burst of events only rewrites the file once.
+type Cache struct {
+	dir string
+	mu  sync.Mutex
+
+	histories map[string]*cacheHistory
+	dirty     map[string]bool
+	flush     *time.Timer
+}
+
+const (
+	// maxCachedMessages is the number of messages of a channel that is
+	// kept in the cache, the oldest messages, and their replies, are
+	// dropped
+	maxCachedMessages = 500
+
+	// flushDelay is how long changes to the histories are kept in memory
+	// before they're written to disk
+	flushDelay = 5 * time.Second
+)
+
+// cacheSession is the user that was logged in during the last session
+type cacheSession struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// cacheHistory is the history of a channel, Messages only contains the
+// messages of the channel itself, the replies are stored by the timestamp
+// of their parent. Both are sorted from old to new.
+type cacheHistory struct {
+	Messages []slack.Message            `json:"messages"`
+	Replies  map[string][]slack.Message `json:"replies"`
+}
+
+// UnmarshalJSON will decode the history, with the header and rich text
+// blocks of the messages, see restoreBlocks
+func (h *cacheHistory) UnmarshalJSON(data []byte) error {
+	type history cacheHistory
+	if err := json.Unmarshal(data, (*history)(h)); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Messages []rawMessage            `json:"messages"`
+		Replies  map[string][]rawMessage `json:"replies"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	restoreMessages(h.Messages, raw.Messages)
+	for threadID, replies := range h.Replies {
+		restoreMessages(replies, raw.Replies[threadID])
+	}
+
+	return nil
+}
+
+// NewCache is the constructor of the Cache, dir is the directory in which
+// the files are stored.
+func NewCache(dir string) *Cache {
+	return &Cache{
+		dir:       dir,
+		histories: make(map[string]*cacheHistory),
+		dirty:     make(map[string]bool),
+	}
+}
+
+// LoadSession returns the user that was logged in during the last session
+func (c *Cache) LoadSession() (cacheSession, bool) {
+	var session cacheSession
+	ok := c.load("session.json", &session)
+	return session, ok && session.UserID != ""
+}
+
+// SaveSession stores the user that is logged in
+func (c *Cache) SaveSession(userID string, username string) error {
+	return c.save("session.json", cacheSession{UserID: userID, Username: username})
+}
+
+// LoadUsers returns the names of the users by their id
+func (c *Cache) LoadUsers() map[string]string {
+	users := make(map[string]string)
+	c.load("users.json", &users)
+	return users
+}
+
+// SaveUsers stores the names of the users by their id
+func (c *Cache) SaveUsers(users map[string]string) error {
+	return c.save("users.json", users)
+}
+
+// LoadConversations returns the conversations that were stored
+func (c *Cache) LoadConversations() ([]slack.Channel, bool) {
+	var conversations []slack.Channel
+	ok := c.load("conversations.json", &conversations)
+	return conversations, ok
+}
+
+// SaveConversations stores the conversations
+func (c *Cache) SaveConversations(conversations []slack.Channel) error {
+	return c.save("conversations.json", conversations)
+}
+
+// LoadInputHistory returns the messages the user has sent, by the id of the
+// channel they were sent to
+func (c *Cache) LoadInputHistory() map[string][]string {
+	history := make(map[string][]string)
+	c.load("input_history.json", &history)
+	return history
+}
+
+// SaveInputHistory stores the messages the user has sent
+func (c *Cache) SaveInputHistory(history map[string][]string) error {
+	return c.save("input_history.json", history)
+}
+
+// LoadDrafts returns the messages that haven't been sent yet, by the key of
+// the channel or thread they were typed in
+func (c *Cache) LoadDrafts() map[string]components.Draft {
+	drafts := make(map[string]components.Draft)
+	c.load("drafts.json", &drafts)
+	return drafts
+}
+
+// SaveDrafts stores the messages that haven't been sent yet
+func (c *Cache) SaveDrafts(drafts map[string]components.Draft) error {
+	return c.save("drafts.json", drafts)
+}
+
+// LoadMessages returns the cached messages of a channel, sorted from old to
+// new
+func (c *Cache) LoadMessages(channelID string) []slack.Message {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+	return append([]slack.Message(nil), history.Messages...)
+}
+
+// SetMessages will revalidate the cached messages of a channel, messages
+// are the newest messages of the channel as they're returned by slack. The
+// cached messages that are as new as the oldest of them are replaced, so
+// edits, deletes and reactions that were missed are fixed. The older cached
+// messages are kept when they connect to messages, when complete is true
+// messages are all the messages of the channel.
+func (c *Cache) SetMessages(channelID string, messages []slack.Message, complete bool) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+	messages = mergeMessages(nil, messages)
+
+	var oldest string
+	if len(messages) > 0 {
+		oldest = messages[0].Timestamp
+	}
+
+	// The cached messages connect to messages when one of them is in the
+	// window of messages, otherwise we might have missed the messages in
+	// between
+	var kept []slack.Message
+	connected := false
+	for _, msg := range history.Messages {
+		if oldest != "" && compareTimestamps(msg.Timestamp, oldest) < 0 {
+			kept = append(kept, msg)
+		} else {
+			connected = true
+		}
+	}
+	if complete || !connected {
+		kept = nil
+	}
+
+	// The replies of the messages that are gone are dropped as well
+	current := make(map[string]bool)
+	for _, msg := range append(kept, messages...) {
+		current[msg.Timestamp] = true
+	}
+	for threadID := range history.Replies {
+		if !current[threadID] {
+			delete(history.Replies, threadID)
+		}
+	}
+
+	history.Messages = append(kept, messages...)
+	c.trimHistory(history)
+	c.markDirty(channelID)
+
+	return nil
+}
+
+// AddMessages will merge the messages into the history of a channel, the
+// messages are keyed by their timestamp so messages that are already cached
+// will be replaced. When reset is true the cached messages are dropped
+// first, this is used when the new messages don't connect to the cached
+// ones.
+func (c *Cache) AddMessages(channelID string, messages []slack.Message, reset bool) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+	if reset {
+		history.Messages = nil
+		history.Replies = make(map[string][]slack.Message)
+	}
+	history.Messages = mergeMessages(history.Messages, messages)
+	c.trimHistory(history)
+	c.markDirty(channelID)
+
+	return nil
+}
+
+// LoadReplies returns the cached replies of the thread with the timestamp
+// threadID, sorted from old to new
+func (c *Cache) LoadReplies(channelID string, threadID string) []slack.Message {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+	return append([]slack.Message(nil), history.Replies[threadID]...)
+}
+
+// SetReplies will replace the cached replies of the thread with the
+// timestamp threadID
+func (c *Cache) SetReplies(channelID string, threadID string, replies []slack.Message) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+	history.Replies[threadID] = mergeMessages(nil, replies)
+	c.markDirty(channelID)
+
+	return nil
+}
+
+// UpdateMessage will replace a message, or reply, in the history of a
+// channel. Messages that aren't cached are ignored, only SetMessages can
+// add messages to the history, otherwise we would create gaps.
+func (c *Cache) UpdateMessage(channelID string, message slack.Message) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+
+	messages := history.Messages
+	if message.ThreadTimestamp != "" && message.ThreadTimestamp != message.Timestamp {
+		messages = history.Replies[message.ThreadTimestamp]
+	}
+
+	for i := range messages {
+		if messages[i].Timestamp == message.Timestamp {
+			messages[i] = message
+			c.markDirty(channelID)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// DeleteMessage will remove a message, or a reply of the thread with the
+// timestamp threadID, from the history of a channel
+func (c *Cache) DeleteMessage(channelID string, threadID string, messageID string) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+
+	messages := history.Messages
+	if threadID != "" && threadID != messageID {
+		messages = history.Replies[threadID]
+	}
+
+	for i := range messages {
+		if messages[i].Timestamp == messageID {
+			messages = append(messages[:i], messages[i+1:]...)
+			if threadID != "" && threadID != messageID {
+				history.Replies[threadID] = messages
+			} else {
+				history.Messages = messages
+				delete(history.Replies, messageID)
+			}
+			c.markDirty(channelID)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// UpdateReaction will add, or remove, the reaction of userID on a message
+// in the history of a channel. The message can be a reply of any thread.
+func (c *Cache) UpdateReaction(channelID string, messageID string, name string, userID string, added bool) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.loadHistory(channelID)
+
+	update := func(messages []slack.Message) bool {
+		for i := range messages {
+			if messages[i].Timestamp == messageID {
+				messages[i].Reactions = updateReactions(messages[i].Reactions, name, userID, added)
+				return true
+			}
+		}
+		return false
+	}
+
+	if update(history.Messages) {
+		c.markDirty(channelID)
+		return nil
+	}
+	for _, replies := range history.Replies {
+		if update(replies) {
+			c.markDirty(channelID)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Flush will write the histories that have changed to disk, it returns the
+// first error that occurred
+func (c *Cache) Flush() error {
+	if c.dir == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.flush != nil {
+		c.flush.Stop()
+		c.flush = nil
+	}
+
+	var err error
+	for channelID := range c.dirty {
+		if e := c.save(c.historyFile(channelID), c.histories[channelID]); e != nil && err == nil {
+			err = e
+		}
+		delete(c.dirty, channelID)
+	}
+
+	return err
+}
+
+// markDirty will mark the history of a channel as changed, and schedules
+// a Flush when there isn't one already. The mutex should be held.
+func (c *Cache) markDirty(channelID string) {
+	c.dirty[channelID] = true
+	if c.flush == nil {
+		c.flush = time.AfterFunc(flushDelay, func() { c.Flush() })
+	}
+}
+
+// trimHistory will drop the oldest messages, and their replies, when there
+// are more than maxCachedMessages
+func (c *Cache) trimHistory(history *cacheHistory) {
+	if len(history.Messages) <= maxCachedMessages {
+		return
+	}
+
+	dropped := history.Messages[:len(history.Messages)-maxCachedMessages]
+	for _, msg := range dropped {
+		delete(history.Replies, msg.Timestamp)
+	}
+
+	history.Messages = append(
+		[]slack.Message(nil), history.Messages[len(dropped):]...,
+	)
+}
+
+func (c *Cache) historyFile(channelID string) string {
+	return filepath.Join("history", channelID+".json")
+}
+
+// loadHistory returns the history of a channel, it is read from disk the
+// first time. The mutex should be held.
+func (c *Cache) loadHistory(channelID string) *cacheHistory {
+	if history, ok := c.histories[channelID]; ok {
+		return history
+	}
+
+	history := &cacheHistory{}
+	c.load(c.historyFile(channelID), history)
+	if history.Replies == nil {
+		history.Replies = make(map[string][]slack.Message)
+	}
+
+	c.histories[channelID] = history
+	return history
+}
+
+// load will decode the json file name into v, it returns false when the
+// file couldn't be read
+func (c *Cache) load(name string, v interface{}) bool {
+	if c.dir == "" {
+		return false
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return false
+	}
+
+	return json.Unmarshal(data, v) == nil
+}
+
+// save will encode v as json into the file name. We write to a temporary
+// file first, and rename it afterwards so a crash won't leave a partly
+// written file behind.
+func (c *Cache) save(name string, v interface{}) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	path := filepath.Join(c.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// updateReactions returns the reactions with the reaction of userID added or
+// removed
+func updateReactions(reactions []slack.ItemReaction, name string, userID string, added bool) []slack.ItemReaction {
+	var updated []slack.ItemReaction
+	found := false
+	for _, r := range reactions {
+		if r.Name == name {
+			found = true
+
+			var users []string
+			for _, user := range r.Users {
+				if user != userID {
+					users = append(users, user)
+				}
+			}
+			if added {
+				users = append(users, userID)
+			}
+			r.Count += len(users) - len(r.Users)
+			r.Users = users
+		}
+
+		if r.Count > 0 {
+			updated = append(updated, r)
+		}
+	}
+
+	if !found && added {
+		updated = append(updated, slack.ItemReaction{
+			Name:  name,
+			Count: 1,
+			Users: []string{userID},
+		})
+	}
+
+	return updated
+}
+
+// countReplies returns the number of replies in the messages of a thread,
+// the parent isn't counted
+func countReplies(messages []slack.Message) int {
+	var count int
+	for _, msg := range messages {
+		if msg.ThreadTimestamp != msg.Timestamp {
+			count++
+		}
+	}
+	return count
+}
+
+// mergeMessages will merge the messages b into a, keyed by their timestamp,
+// and returns them sorted from old to new
+func mergeMessages(a []slack.Message, b []slack.Message) []slack.Message {
+	byTimestamp := make(map[string]slack.Message)
+	for _, msg := range a {
+		byTimestamp[msg.Timestamp] = msg
+	}
+	for _, msg := range b {
+		byTimestamp[msg.Timestamp] = msg
+	}
+
+	merged := make([]slack.Message, 0, len(byTimestamp))
+	for _, msg := range byTimestamp {
+		merged = append(merged, msg)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return compareTimestamps(merged[i].Timestamp, merged[j].Timestamp) < 0
+	})
+
+	return merged
+}
+
+// compareTimestamps compares two slack timestamps (e.g. 1503435956.000247),
+// the seconds are compared by length first, so we don't have to parse
+// them as floats and lose precision.
+func compareTimestamps(a string, b string) int {
+	aSec, aFrac := splitTimestamp(a)
+	bSec, bFrac := splitTimestamp(b)
+
+	if len(aSec) != len(bSec) {
+		if len(aSec) < len(bSec) {
+			return -1
+		}
+		return 1
+	}
+
+	if aSec != bSec {
+		return strings.Compare(aSec, bSec)
+	}
+
+	return strings.Compare(aFrac, bFrac)
+}
+
+func splitTimestamp(ts string) (string, string) {
+	parts := strings.SplitN(ts, ".", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
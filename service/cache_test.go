@@ -0,0 +1,161 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// newTestCache returns a Cache in a temporary directory, and a function that
+// removes it
+func newTestCache(t *testing.T) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "slack-term-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCache(dir)
+	done := func() {
+		cache.Flush()
+		os.RemoveAll(dir)
+	}
+
+	return cache, done
+}
+
+// testMessage returns a message with the timestamp "<n>.000000"
+func testMessage(n int, text string) slack.Message {
+	msg := slack.Message{}
+	msg.Timestamp = fmt.Sprintf("%d.000000", 1500000000+n)
+	msg.Text = text
+	return msg
+}
+
+// texts returns the text of every message
+func texts(messages []slack.Message) []string {
+	var texts []string
+	for _, msg := range messages {
+		texts = append(texts, msg.Text)
+	}
+	return texts
+}
+
+func TestCacheSetMessages(t *testing.T) {
+	cache, done := newTestCache(t)
+	defer done()
+
+	cache.SetMessages("C1", []slack.Message{
+		testMessage(1, "one"),
+		testMessage(2, "two"),
+		testMessage(3, "three"),
+		testMessage(4, "four"),
+	}, true)
+
+	// While we were away 3 was edited and 4 was deleted, slack only
+	// returns the newest messages
+	cache.SetMessages("C1", []slack.Message{
+		testMessage(5, "five"),
+		testMessage(3, "three, edited"),
+	}, false)
+
+	got := fmt.Sprint(texts(cache.LoadMessages("C1")))
+	want := "[one two three, edited five]"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// The cached messages don't connect to these, so they're dropped
+	cache.SetMessages("C1", []slack.Message{
+		testMessage(8, "eight"),
+		testMessage(9, "nine"),
+	}, false)
+
+	got = fmt.Sprint(texts(cache.LoadMessages("C1")))
+	want = "[eight nine]"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestCacheSetMessagesComplete(t *testing.T) {
+	cache, done := newTestCache(t)
+	defer done()
+
+	cache.SetMessages("C1", []slack.Message{
+		testMessage(1, "one"),
+		testMessage(2, "two"),
+	}, true)
+	cache.SetReplies("C1", testMessage(1, "").Timestamp, []slack.Message{
+		testMessage(3, "reply"),
+	})
+
+	// Every message of the channel is returned, so 1 was deleted
+	cache.SetMessages("C1", []slack.Message{testMessage(2, "two")}, true)
+
+	got := fmt.Sprint(texts(cache.LoadMessages("C1")))
+	if got != "[two]" {
+		t.Errorf("got %s, want [two]", got)
+	}
+	if replies := cache.LoadReplies("C1", testMessage(1, "").Timestamp); len(replies) != 0 {
+		t.Errorf("got %d replies of a deleted message, want none", len(replies))
+	}
+}
+
+func TestCacheTrim(t *testing.T) {
+	cache, done := newTestCache(t)
+	defer done()
+
+	var messages []slack.Message
+	for i := 0; i < maxCachedMessages+10; i++ {
+		messages = append(messages, testMessage(i, fmt.Sprint(i)))
+	}
+
+	cache.SetReplies("C1", messages[0].Timestamp, []slack.Message{testMessage(1000, "reply")})
+	cache.SetMessages("C1", messages, true)
+
+	cached := cache.LoadMessages("C1")
+	if len(cached) != maxCachedMessages {
+		t.Fatalf("got %d messages, want %d", len(cached), maxCachedMessages)
+	}
+	if cached[0].Text != "10" {
+		t.Errorf("got %q as the oldest message, want 10", cached[0].Text)
+	}
+
+	// The replies of the dropped messages are dropped as well
+	if replies := cache.LoadReplies("C1", messages[0].Timestamp); len(replies) != 0 {
+		t.Errorf("got %d replies of a dropped message, want none", len(replies))
+	}
+}
+
+func TestCacheFlush(t *testing.T) {
+	cache, done := newTestCache(t)
+	defer done()
+
+	cache.SetMessages("C1", []slack.Message{testMessage(1, "one")}, true)
+	cache.UpdateMessage("C1", testMessage(1, "one, edited"))
+	cache.UpdateReaction("C1", testMessage(1, "").Timestamp, "tada", "U1", true)
+
+	// Nothing is written until the cache is flushed
+	if got := NewCache(cache.dir).LoadMessages("C1"); len(got) != 0 {
+		t.Fatalf("got %d messages on disk before the flush, want none", len(got))
+	}
+
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewCache(cache.dir).LoadMessages("C1")
+	if len(got) != 1 || got[0].Text != "one, edited" || len(got[0].Reactions) != 1 {
+		t.Errorf("got %+v on disk, want the edited message with a reaction", got)
+	}
+
+	cache.DeleteMessage("C1", "", testMessage(1, "").Timestamp)
+	cache.Flush()
+
+	if got := NewCache(cache.dir).LoadMessages("C1"); len(got) != 0 {
+		t.Errorf("got %d messages on disk, want none after the delete", len(got))
+	}
+}
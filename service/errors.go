@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is the error that is returned by the Service when a request to the
+// backend fails. Op describes what was being done, so the error can be shown
+// to the user without further context.
+type Error struct {
+	Op  string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+// newError will wrap err in an Error, nil is returned when err is nil
+func newError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+
+	return &Error{Op: op, Err: err}
+}
+
+// AmbiguousError is returned when a mention in a message that is being sent
+// matches more than one user, Matches are the handles of those users
+type AmbiguousError struct {
+	Mention string
+	Matches []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf(
+		"%s matches more than one user, use one of @%s instead",
+		e.Mention, strings.Join(e.Matches, ", @"),
+	)
+}
+
+// IsAmbiguous returns true when err is caused by an ambiguous mention
+func IsAmbiguous(err error) bool {
+	if e, ok := err.(*Error); ok {
+		err = e.Err
+	}
+
+	_, ok := err.(*AmbiguousError)
+	return ok
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"time"
+
+	"github.com/erroneousboat/slack-term/components"
+)
+
+const (
+	EventTypeMessage    = "message"
+	EventTypeDelete     = "delete"
+	EventTypePresence   = "presence"
+	EventTypeReadState  = "read_state"
+	EventTypeReaction   = "reaction"
+	EventTypeError      = "error"
+	EventTypeConnection = "connection"
+	EventTypeLatency    = "latency"
+	EventTypeHistory    = "history"
+	EventTypeChannels   = "channels"
+)
+
+const (
+	ConnectionStateConnecting   = "connecting"
+	ConnectionStateConnected    = "connected"
+	ConnectionStateDisconnected = "disconnected"
+)
+
+// Event is a normalized event that is emitted by a Service, the Data field
+// contains one of the event structs defined below.
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// MessageEvent is emitted when a message is posted, or changed, in a
+// channel or thread
+type MessageEvent struct {
+	ChannelID string
+	UserID    string
+	Text      string
+
+	// ThreadID is the timestamp of the parent message when the message
+	// is a reply to a thread, otherwise it is empty
+	ThreadID string
+
+	// Message is the message as it should be rendered in the Chat pane
+	Message components.Message
+
+	// Edited is set when the message replaces a message that was
+	// received before
+	Edited bool
+
+	// Missed is set when the message was posted while we were
+	// disconnected, and it is only received after reconnecting
+	Missed bool
+}
+
+// DeleteEvent is emitted when a message, or a reply, has been deleted.
+// ThreadID is the timestamp of the parent when a reply was deleted.
+type DeleteEvent struct {
+	ChannelID string
+	ThreadID  string
+	MessageID string
+}
+
+// PresenceEvent is emitted when the presence of a user changes, ChannelID
+// is the id of the im channel with that user
+type PresenceEvent struct {
+	ChannelID string
+	UserID    string
+	Presence  string
+}
+
+// ReadStateEvent is emitted when a channel has been marked as read up until
+// Timestamp, for instance from another client
+type ReadStateEvent struct {
+	ChannelID string
+	Timestamp string
+}
+
+// ReactionEvent is emitted when a reaction has been added to, or removed
+// from, the message with MessageID
+type ReactionEvent struct {
+	ChannelID string
+	MessageID string
+	UserID    string
+	Reaction  string
+	Added     bool
+}
+
+// ErrorEvent is emitted when the backend encounters an error that isn't
+// the result of a call made by the user interface
+type ErrorEvent struct {
+	Err error
+}
+
+// ConnectionEvent is emitted when the state of the connection with the
+// backend changes, Err is set when connecting failed
+type ConnectionEvent struct {
+	State   string
+	Attempt int
+	Err     error
+}
+
+// LatencyEvent is emitted when the latency of the connection has been
+// measured
+type LatencyEvent struct {
+	Latency time.Duration
+}
+
+// HistoryEvent is emitted when the messages of a channel, that were shown
+// from the cache, have been synced with slack. Messages and Threads replace
+// what GetMessages returned.
+type HistoryEvent struct {
+	ChannelID string
+	Messages  []components.Message
+	Threads   []components.ChannelItem
+}
+
+// ChannelsEvent is emitted when the conversations have been refreshed,
+// after GetChannels returned the cached ones. Channels replace what
+// GetChannels returned.
+type ChannelsEvent struct {
+	Channels []components.ChannelItem
+}
+
+func newMessageEvent(ev *MessageEvent) Event {
+	return Event{Type: EventTypeMessage, Data: ev}
+}
+
+func newDeleteEvent(ev *DeleteEvent) Event {
+	return Event{Type: EventTypeDelete, Data: ev}
+}
+
+func newPresenceEvent(ev *PresenceEvent) Event {
+	return Event{Type: EventTypePresence, Data: ev}
+}
+
+func newReadStateEvent(ev *ReadStateEvent) Event {
+	return Event{Type: EventTypeReadState, Data: ev}
+}
+
+func newReactionEvent(ev *ReactionEvent) Event {
+	return Event{Type: EventTypeReaction, Data: ev}
+}
+
+func newErrorEvent(err error) Event {
+	return Event{Type: EventTypeError, Data: &ErrorEvent{Err: err}}
+}
+
+func newConnectionEvent(ev *ConnectionEvent) Event {
+	return Event{Type: EventTypeConnection, Data: ev}
+}
+
+func newLatencyEvent(ev *LatencyEvent) Event {
+	return Event{Type: EventTypeLatency, Data: ev}
+}
+
+func newHistoryEvent(ev *HistoryEvent) Event {
+	return Event{Type: EventTypeHistory, Data: ev}
+}
+
+func newChannelsEvent(ev *ChannelsEvent) Event {
+	return Event{Type: EventTypeChannels, Data: ev}
+}
@@ -0,0 +1,554 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/erroneousboat/slack-term/components"
+	"github.com/erroneousboat/slack-term/config"
+)
+
+// FakeService is an in-memory implementation of Service. It doesn't talk
+// to a backend, messages that are sent are stored and echoed back over the
+// event stream. It can be used to run the user interface without a Slack
+// workspace.
+type FakeService struct {
+	Config        *config.Config
+	CurrentUserID string
+
+	mu        sync.Mutex
+	users     map[string]string
+	presence  map[string]string
+	channels  []components.ChannelItem
+	messages  map[string][]components.Message
+	replies   map[string][]components.Message
+	commands  []string
+	timestamp int64
+
+	inputHistory map[string][]string
+	drafts       map[string]components.Draft
+
+	events chan Event
+}
+
+// NewFakeService is the constructor for the FakeService, the current user
+// will be created with the provided userID and name.
+func NewFakeService(config *config.Config, userID string, name string) *FakeService {
+	svc := &FakeService{
+		Config:        config,
+		CurrentUserID: userID,
+		users:         make(map[string]string),
+		presence:      make(map[string]string),
+		messages:      make(map[string][]components.Message),
+		replies:       make(map[string][]components.Message),
+		timestamp:     time.Now().Unix(),
+		events:        make(chan Event, 50),
+	}
+
+	svc.users[userID] = name
+	svc.presence[userID] = components.PresenceActive
+
+	return svc
+}
+
+// AddUser will add a user to the service
+func (s *FakeService) AddUser(userID string, name string, presence string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[userID] = name
+	s.presence[userID] = presence
+}
+
+// AddChannel will add a channel to the service, for im channels the
+// UserID field of the channel needs to be set.
+func (s *FakeService) AddChannel(channel components.ChannelItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel.StylePrefix = s.Config.Theme.Channel.Prefix
+	channel.StyleIcon = s.Config.Theme.Channel.Icon
+	channel.StyleText = s.Config.Theme.Channel.Text
+
+	if channel.Type == components.ChannelTypeIM {
+		channel.Name = s.users[channel.UserID]
+		channel.Presence = components.PresenceAway
+	}
+
+	s.channels = append(s.channels, channel)
+}
+
+// PostMessage will simulate a message that is posted by userID in a channel,
+// when threadID is set the message will be a reply to that thread. The
+// message is emitted on the event stream, and the timestamp of the message
+// is returned.
+func (s *FakeService) PostMessage(channelID string, threadID string, userID string, text string) string {
+	s.mu.Lock()
+	msg := s.createMessage(userID, text)
+	if threadID == "" {
+		s.messages[channelID] = append(s.messages[channelID], msg)
+	} else {
+		msg.Thread = "  "
+		s.replies[threadID] = append(s.replies[threadID], msg)
+	}
+	s.mu.Unlock()
+
+	s.events <- newMessageEvent(&MessageEvent{
+		ChannelID: channelID,
+		UserID:    userID,
+		Text:      text,
+		ThreadID:  threadID,
+		Message:   msg,
+	})
+
+	return msg.ID
+}
+
+// SetPresence will change the presence of a user and emit the change on
+// the event stream
+func (s *FakeService) SetPresence(userID string, presence string) {
+	s.mu.Lock()
+	s.presence[userID] = presence
+
+	var channelID string
+	for _, chn := range s.channels {
+		if chn.Type == components.ChannelTypeIM && chn.UserID == userID {
+			channelID = chn.ID
+		}
+	}
+	s.mu.Unlock()
+
+	if channelID == "" {
+		return
+	}
+
+	s.events <- newPresenceEvent(&PresenceEvent{
+		ChannelID: channelID,
+		UserID:    userID,
+		Presence:  presence,
+	})
+}
+
+// GetCommands returns the slash commands that have been sent
+func (s *FakeService) GetCommands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.commands...)
+}
+
+// GetChannels implements Service
+func (s *FakeService) GetChannels() ([]components.ChannelItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.channels) == 0 {
+		return nil, errors.New("no channels available")
+	}
+
+	return append([]components.ChannelItem{}, s.channels...), nil
+}
+
+// GetMessages implements Service
+func (s *FakeService) GetMessages(channelID string, count int) ([]components.Message, []components.ChannelItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := s.messages[channelID]
+	if len(msgs) > count {
+		msgs = msgs[len(msgs)-count:]
+	}
+
+	var messages []components.Message
+	var threads []components.ChannelItem
+	for _, msg := range msgs {
+		msg = s.withThread(msg)
+		messages = append(messages, msg)
+
+		if msg.Thread != "" {
+			threads = append(threads, components.ChannelItem{
+				ID:          msg.ID,
+				Name:        msg.Thread,
+				Type:        components.ChannelTypeGroup,
+				StylePrefix: s.Config.Theme.Channel.Prefix,
+				StyleIcon:   s.Config.Theme.Channel.Icon,
+				StyleText:   s.Config.Theme.Channel.Text,
+			})
+		}
+	}
+
+	return messages, threads, nil
+}
+
+// GetMessageByID implements Service
+func (s *FakeService) GetMessageByID(messageID string, channelID string) ([]components.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range s.messages[channelID] {
+		if msg.ID == messageID {
+			return []components.Message{s.withReplies(msg)}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("message %s not found in channel %s", messageID, channelID)
+}
+
+// GetReplies implements Service
+func (s *FakeService) GetReplies(channelID string, threadID string) ([]components.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]components.Message{}, s.replies[threadID]...), nil
+}
+
+// SendMessage implements Service
+func (s *FakeService) SendMessage(channelID string, message string) error {
+	s.PostMessage(channelID, "", s.CurrentUserID, message)
+	return nil
+}
+
+// SendReply implements Service
+func (s *FakeService) SendReply(channelID string, threadID string, message string) error {
+	s.PostMessage(channelID, threadID, s.CurrentUserID, message)
+	return nil
+}
+
+// EditMessage implements Service, the edited message is emitted on the
+// event stream
+func (s *FakeService) EditMessage(channelID string, messageID string, message string) error {
+	s.mu.Lock()
+
+	var threadID string
+	var edited *components.Message
+	for i, msg := range s.messages[channelID] {
+		if msg.ID == messageID {
+			edited = &s.messages[channelID][i]
+		}
+	}
+	for parentID, replies := range s.replies {
+		for i, msg := range replies {
+			if msg.ID == messageID {
+				threadID = parentID
+				edited = &s.replies[parentID][i]
+			}
+		}
+	}
+
+	if edited == nil || edited.UserID != s.CurrentUserID {
+		s.mu.Unlock()
+		return fmt.Errorf("message %s can't be edited", messageID)
+	}
+
+	edited.Content = message
+	edited.Text = message
+	msg := *edited
+	s.mu.Unlock()
+
+	s.events <- newMessageEvent(&MessageEvent{
+		ChannelID: channelID,
+		UserID:    s.CurrentUserID,
+		Text:      message,
+		ThreadID:  threadID,
+		Message:   msg,
+		Edited:    true,
+	})
+
+	return nil
+}
+
+// DeleteMessage implements Service, the deletion is emitted on the event
+// stream
+func (s *FakeService) DeleteMessage(channelID string, messageID string) error {
+	s.mu.Lock()
+
+	var found bool
+	var threadID string
+	for i, msg := range s.messages[channelID] {
+		if msg.ID == messageID && msg.UserID == s.CurrentUserID {
+			s.messages[channelID] = append(s.messages[channelID][:i], s.messages[channelID][i+1:]...)
+			found = true
+			break
+		}
+	}
+	for parentID, replies := range s.replies {
+		for i, msg := range replies {
+			if msg.ID == messageID && msg.UserID == s.CurrentUserID {
+				s.replies[parentID] = append(replies[:i], replies[i+1:]...)
+				threadID = parentID
+				found = true
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("message %s can't be deleted", messageID)
+	}
+
+	s.events <- newDeleteEvent(&DeleteEvent{
+		ChannelID: channelID,
+		ThreadID:  threadID,
+		MessageID: messageID,
+	})
+
+	return nil
+}
+
+// AddReaction implements Service, the reaction is emitted on the event
+// stream
+func (s *FakeService) AddReaction(channelID string, messageID string, name string) error {
+	s.events <- newReactionEvent(&ReactionEvent{
+		ChannelID: channelID,
+		MessageID: messageID,
+		UserID:    s.CurrentUserID,
+		Reaction:  name,
+		Added:     true,
+	})
+	return nil
+}
+
+// RemoveReaction implements Service, the removal is emitted on the event
+// stream
+func (s *FakeService) RemoveReaction(channelID string, messageID string, name string) error {
+	s.events <- newReactionEvent(&ReactionEvent{
+		ChannelID: channelID,
+		MessageID: messageID,
+		UserID:    s.CurrentUserID,
+		Reaction:  name,
+		Added:     false,
+	})
+	return nil
+}
+
+// UploadFile implements Service, a message with the name of the file is
+// posted instead
+func (s *FakeService) UploadFile(channelID string, threadID string, path string, comment string, progress func(sent int64, total int64)) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress(info.Size(), info.Size())
+	}
+
+	text := filepath.Base(path)
+	if comment != "" {
+		text = fmt.Sprintf("%s %s", comment, text)
+	}
+	s.PostMessage(channelID, threadID, s.CurrentUserID, text)
+
+	return nil
+}
+
+// UploadSnippet implements Service, the content is posted as a message
+func (s *FakeService) UploadSnippet(channelID string, threadID string, content string, title string) error {
+	s.PostMessage(channelID, threadID, s.CurrentUserID, content)
+	return nil
+}
+
+// DownloadFile implements Service, there are no files to download
+func (s *FakeService) DownloadFile(file components.File) (string, error) {
+	return "", fmt.Errorf("file %s not found", file.ID)
+}
+
+// DownloadPreview implements Service, there are no images to download
+func (s *FakeService) DownloadPreview(file components.File) ([]byte, error) {
+	return nil, fmt.Errorf("image %s not found", file.ID)
+}
+
+// SendCommand implements Service, commands are only recorded
+func (s *FakeService) SendCommand(channelID string, message string) (bool, error) {
+	r := regexp.MustCompile(`^/\w+`)
+	if !r.MatchString(message) {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	s.commands = append(s.commands, message)
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+// GetUserPresence implements Service
+func (s *FakeService) GetUserPresence(userID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	presence, ok := s.presence[userID]
+	if !ok {
+		return "", fmt.Errorf("user %s not found", userID)
+	}
+
+	return presence, nil
+}
+
+// SetUserAsActive implements Service
+func (s *FakeService) SetUserAsActive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.presence[s.CurrentUserID] = components.PresenceActive
+}
+
+// MarkAsRead implements Service
+func (s *FakeService) MarkAsRead(channelItem components.ChannelItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, chn := range s.channels {
+		if chn.ID == channelItem.ID {
+			s.channels[i].Notification = false
+		}
+	}
+}
+
+// GetUserNames implements Service
+func (s *FakeService) GetUserNames() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make(map[string]string, len(s.users))
+	for _, name := range s.users {
+		names[name] = ""
+	}
+
+	return names
+}
+
+// GetInputHistory implements Service
+func (s *FakeService) GetInputHistory() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := make(map[string][]string, len(s.inputHistory))
+	for channelID, messages := range s.inputHistory {
+		history[channelID] = append([]string(nil), messages...)
+	}
+
+	return history
+}
+
+// SaveInputHistory implements Service
+func (s *FakeService) SaveInputHistory(history map[string][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inputHistory = make(map[string][]string, len(history))
+	for channelID, messages := range history {
+		s.inputHistory[channelID] = append([]string(nil), messages...)
+	}
+
+	return nil
+}
+
+// GetDrafts implements Service
+func (s *FakeService) GetDrafts() map[string]components.Draft {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	drafts := make(map[string]components.Draft, len(s.drafts))
+	for key, draft := range s.drafts {
+		drafts[key] = draft
+	}
+
+	return drafts
+}
+
+// SaveDrafts implements Service
+func (s *FakeService) SaveDrafts(drafts map[string]components.Draft) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.drafts = make(map[string]components.Draft, len(drafts))
+	for key, draft := range drafts {
+		s.drafts[key] = draft
+	}
+
+	return nil
+}
+
+// Close implements Service
+func (s *FakeService) Close() error {
+	return nil
+}
+
+// GetCurrentUserID implements Service
+func (s *FakeService) GetCurrentUserID() string {
+	return s.CurrentUserID
+}
+
+// Events implements Service
+func (s *FakeService) Events() <-chan Event {
+	return s.events
+}
+
+// createMessage will create a components.Message with a unique timestamp
+func (s *FakeService) createMessage(userID string, text string) components.Message {
+	s.timestamp++
+
+	name, ok := s.users[userID]
+	if !ok {
+		name = "unknown"
+	}
+
+	id := fmt.Sprintf("%d.000100", s.timestamp)
+	raw, _ := json.Marshal(map[string]string{
+		"type": "message",
+		"user": userID,
+		"text": text,
+		"ts":   id,
+	})
+
+	return components.Message{
+		ID:          id,
+		UserID:      userID,
+		Messages:    make(map[string]components.Message),
+		Time:        time.Unix(s.timestamp, 0),
+		Name:        name,
+		Content:     text,
+		Text:        text,
+		StyleTime:   s.Config.Theme.Message.Time,
+		StyleThread: s.Config.Theme.Message.Thread,
+		StyleName:   s.Config.Theme.Message.Name,
+		StyleText:   s.Config.Theme.Message.Text,
+		FormatTime:  s.Config.Theme.Message.TimeFormat,
+		Raw:         raw,
+	}
+}
+
+// withReplies returns a copy of msg with the replies of its thread, when
+// there are replies the thread identifier is set in the same way as the
+// SlackService does.
+func (s *FakeService) withReplies(msg components.Message) components.Message {
+	msg = s.withThread(msg)
+
+	msg.Messages = make(map[string]components.Message)
+	for _, reply := range s.replies[msg.ID] {
+		msg.Messages[reply.ID] = reply
+	}
+
+	return msg
+}
+
+// withThread will set the thread prefix of a message when it has replies
+func (s *FakeService) withThread(msg components.Message) components.Message {
+	if _, ok := s.replies[msg.ID]; !ok {
+		return msg
+	}
+
+	f, _ := strconv.ParseFloat(msg.ID, 64)
+	msg.Thread = fmt.Sprintf("%s ", hashID(int(f)))
+
+	return msg
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/erroneousboat/slack-term/components"
+	"github.com/erroneousboat/slack-term/config"
+)
+
+// newTestFakeService returns a FakeService for alice, with the user bob, the
+// channel #general and an im channel with bob
+func newTestFakeService() *FakeService {
+	svc := NewFakeService(&config.Config{}, "U1", "alice")
+	svc.AddUser("U2", "bob", components.PresenceActive)
+	svc.AddChannel(components.ChannelItem{
+		ID:   "C1",
+		Name: "general",
+		Type: components.ChannelTypeChannel,
+	})
+	svc.AddChannel(components.ChannelItem{
+		ID:     "D1",
+		Name:   "bob",
+		Type:   components.ChannelTypeIM,
+		UserID: "U2",
+	})
+
+	return svc
+}
+
+// nextEvent returns the next event of svc, it fails when there is none
+func nextEvent(t *testing.T, svc *FakeService) Event {
+	t.Helper()
+
+	select {
+	case ev := <-svc.Events():
+		return ev
+	default:
+		t.Fatal("no event was emitted")
+		return Event{}
+	}
+}
+
+func TestFakeServiceMessages(t *testing.T) {
+	svc := newTestFakeService()
+
+	id := svc.PostMessage("C1", "", "U2", "hello")
+
+	ev, ok := nextEvent(t, svc).Data.(*MessageEvent)
+	if !ok {
+		t.Fatal("the event isn't a message")
+	}
+	if ev.ChannelID != "C1" || ev.UserID != "U2" || ev.Message.ID != id || ev.Message.Name != "bob" {
+		t.Errorf("got message %s of %s in %s, want message %s of bob", ev.Message.ID, ev.UserID, ev.ChannelID, id)
+	}
+
+	if err := svc.SendMessage("C1", "hi bob"); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, svc)
+
+	msgs, threads, err := svc.GetMessages("C1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Content != "hello" || msgs[1].Content != "hi bob" {
+		t.Errorf("got messages %v, want hello and hi bob", msgs)
+	}
+	if len(threads) != 0 {
+		t.Errorf("got threads %v, want none", threads)
+	}
+
+	msgs, _, _ = svc.GetMessages("C1", 1)
+	if len(msgs) != 1 || msgs[0].Content != "hi bob" {
+		t.Errorf("got messages %v, want only the newest", msgs)
+	}
+}
+
+func TestFakeServiceThreads(t *testing.T) {
+	svc := newTestFakeService()
+
+	parent := svc.PostMessage("C1", "", "U2", "question")
+	nextEvent(t, svc)
+
+	if err := svc.SendReply("C1", parent, "answer"); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := nextEvent(t, svc).Data.(*MessageEvent)
+	if ev.ThreadID != parent || ev.UserID != "U1" {
+		t.Errorf("got reply of %s in thread %q, want the reply of alice in %s", ev.UserID, ev.ThreadID, parent)
+	}
+
+	_, threads, _ := svc.GetMessages("C1", 10)
+	if len(threads) != 1 || threads[0].ID != parent {
+		t.Errorf("got threads %v, want the thread of %s", threads, parent)
+	}
+
+	replies, _ := svc.GetReplies("C1", parent)
+	if len(replies) != 1 || replies[0].Content != "answer" {
+		t.Errorf("got replies %v, want the answer", replies)
+	}
+
+	msgs, err := svc.GetMessageByID(parent, "C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || len(msgs[0].Messages) != 1 {
+		t.Errorf("got %v, want the parent with its reply", msgs)
+	}
+}
+
+func TestFakeServiceEditAndDelete(t *testing.T) {
+	svc := newTestFakeService()
+
+	own := svc.PostMessage("C1", "", "U1", "helo")
+	other := svc.PostMessage("C1", "", "U2", "hello")
+	nextEvent(t, svc)
+	nextEvent(t, svc)
+
+	if err := svc.EditMessage("C1", own, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	ev := nextEvent(t, svc).Data.(*MessageEvent)
+	if !ev.Edited || ev.Message.Content != "hello" {
+		t.Errorf("got %q edited %v, want the edited message", ev.Message.Content, ev.Edited)
+	}
+
+	if err := svc.EditMessage("C1", other, "bye"); err == nil {
+		t.Error("the message of another user was edited")
+	}
+	if err := svc.DeleteMessage("C1", other); err == nil {
+		t.Error("the message of another user was deleted")
+	}
+
+	if err := svc.DeleteMessage("C1", own); err != nil {
+		t.Fatal(err)
+	}
+	del, ok := nextEvent(t, svc).Data.(*DeleteEvent)
+	if !ok || del.MessageID != own {
+		t.Errorf("got %v, want the deletion of %s", del, own)
+	}
+
+	msgs, _, _ := svc.GetMessages("C1", 10)
+	if len(msgs) != 1 || msgs[0].ID != other {
+		t.Errorf("got messages %v, want only %s", msgs, other)
+	}
+}
+
+func TestFakeServicePresence(t *testing.T) {
+	svc := newTestFakeService()
+
+	svc.SetPresence("U2", components.PresenceAway)
+
+	ev, ok := nextEvent(t, svc).Data.(*PresenceEvent)
+	if !ok || ev.ChannelID != "D1" || ev.Presence != components.PresenceAway {
+		t.Errorf("got %v, want bob away in D1", ev)
+	}
+
+	presence, err := svc.GetUserPresence("U2")
+	if err != nil || presence != components.PresenceAway {
+		t.Errorf("got presence %q, want away", presence)
+	}
+}
+
+func TestFakeServiceCommands(t *testing.T) {
+	svc := newTestFakeService()
+
+	isCmd, err := svc.SendCommand("C1", "/remind me")
+	if err != nil || !isCmd {
+		t.Fatal("the command wasn't recognized")
+	}
+
+	isCmd, _ = svc.SendCommand("C1", "no command")
+	if isCmd {
+		t.Error("a message was sent as a command")
+	}
+
+	if cmds := svc.GetCommands(); len(cmds) != 1 || cmds[0] != "/remind me" {
+		t.Errorf("got commands %v, want /remind me", cmds)
+	}
+}
+
+func TestFakeServiceMarkAsRead(t *testing.T) {
+	svc := newTestFakeService()
+	svc.AddChannel(components.ChannelItem{ID: "C2", Name: "random", Notification: true})
+
+	svc.MarkAsRead(components.ChannelItem{ID: "C2"})
+
+	chans, _ := svc.GetChannels()
+	for _, chn := range chans {
+		if chn.Notification {
+			t.Errorf("channel %s is still unread", chn.Name)
+		}
+	}
+}
@@ -0,0 +1,861 @@
+// Package fakeslack implements a stand-in for the Slack Web API, the RTM
+// websocket and the Socket Mode websocket that slack-term uses. It runs on
+// an httptest.Server, so the SlackService can be pointed at it by setting
+// the `api_url` option in the config to the value of Server.APIURL().
+//
+// Events can be scripted with the Send* methods, they are pushed to every
+// RTM and Socket Mode connection that is open.
+package fakeslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+)
+
+// Command is a slash command that has been received by the Server
+type Command struct {
+	ChannelID string
+	Command   string
+	Text      string
+}
+
+// Server is the fake Slack server
+type Server struct {
+	URL string
+
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	self      slack.User
+	team      slack.Team
+	users     []slack.User
+	bots      map[string]slack.Bot
+	groups    []slack.UserGroup
+	channels  []slack.Channel
+	messages  map[string][]slack.Message
+	presence  map[string]string
+	marks     map[string]string
+	commands  []Command
+	files     map[string][]byte
+	limited   map[string]int
+	conns     map[*conn]struct{}
+	acks      []string
+	connected chan struct{}
+	timestamp int64
+	counter   int
+}
+
+// conn wraps a websocket connection, gorilla/websocket doesn't support
+// concurrent writers so they are guarded with a mutex
+type conn struct {
+	mu         sync.Mutex
+	ws         *websocket.Conn
+	socketMode bool
+	envelopes  int
+}
+
+func (c *conn) writeJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ws.WriteJSON(v)
+}
+
+// writeEvent will write the event to the connection, for Socket Mode
+// connections the event is wrapped in an envelope of the Events API
+func (c *conn) writeEvent(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.socketMode {
+		return c.ws.WriteJSON(v)
+	}
+
+	c.envelopes++
+	return c.ws.WriteJSON(map[string]interface{}{
+		"envelope_id": fmt.Sprintf("envelope-%d", c.envelopes),
+		"type":        "events_api",
+		"payload": map[string]interface{}{
+			"type":  "event_callback",
+			"event": v,
+		},
+	})
+}
+
+// NewServer creates and starts a Server, self is the user that is associated
+// with the token that is used by the client.
+func NewServer(self slack.User) *Server {
+	s := &Server{
+		self:      self,
+		team:      slack.Team{ID: "T00000001", Name: "fakeslack", Domain: "fakeslack"},
+		users:     []slack.User{self},
+		bots:      make(map[string]slack.Bot),
+		messages:  make(map[string][]slack.Message),
+		presence:  map[string]string{self.ID: "active"},
+		marks:     make(map[string]string),
+		files:     make(map[string][]byte),
+		limited:   make(map[string]int),
+		conns:     make(map[*conn]struct{}),
+		connected: make(chan struct{}, 10),
+		timestamp: time.Now().Unix(),
+	}
+
+	// The RTM client sets the origin to api.slack.com
+	s.upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth.test", s.handleAuthTest)
+	mux.HandleFunc("/api/users.list", s.handleUsersList)
+	mux.HandleFunc("/api/users.info", s.handleUsersInfo)
+	mux.HandleFunc("/api/users.getPresence", s.handleUsersGetPresence)
+	mux.HandleFunc("/api/users.setPresence", s.handleOK)
+	mux.HandleFunc("/api/bots.info", s.handleBotsInfo)
+	mux.HandleFunc("/api/usergroups.list", s.handleUserGroupsList)
+	mux.HandleFunc("/api/rtm.connect", s.handleRTMConnect)
+	mux.HandleFunc("/api/apps.connections.open", s.handleAppsConnectionsOpen)
+	mux.HandleFunc("/api/conversations.list", s.handleConversationsList)
+	mux.HandleFunc("/api/conversations.history", s.handleConversationsHistory)
+	mux.HandleFunc("/api/conversations.replies", s.handleConversationsReplies)
+	mux.HandleFunc("/api/chat.postMessage", s.handleChatPostMessage)
+	mux.HandleFunc("/api/chat.update", s.handleChatUpdate)
+	mux.HandleFunc("/api/chat.command", s.handleChatCommand)
+	mux.HandleFunc("/api/files.upload", s.handleFilesUpload)
+	mux.HandleFunc("/files/", s.handleFileDownload)
+	mux.HandleFunc("/api/channels.mark", s.handleMark)
+	mux.HandleFunc("/api/groups.mark", s.handleMark)
+	mux.HandleFunc("/api/im.mark", s.handleMark)
+	mux.HandleFunc("/ws", s.handleWebsocket)
+	mux.HandleFunc("/socket-mode", s.handleSocketMode)
+
+	s.server = httptest.NewServer(s.rateLimit(mux))
+	s.URL = s.server.URL
+
+	return s
+}
+
+// APIURL returns the url that can be used as the `api_url` in the config
+func (s *Server) APIURL() string {
+	return s.URL + "/api/"
+}
+
+// Close shuts down the server and closes all the RTM connections
+func (s *Server) Close() {
+	s.mu.Lock()
+	for c := range s.conns {
+		c.ws.Close()
+	}
+	s.mu.Unlock()
+
+	s.server.Close()
+}
+
+// WaitForConnection blocks until a client has opened an RTM or Socket Mode
+// connection,
+// it returns false when this didn't happen within the timeout.
+func (s *Server) WaitForConnection(timeout time.Duration) bool {
+	select {
+	case <-s.connected:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// AddUser adds a user to the workspace
+func (s *Server) AddUser(user slack.User, presence string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = append(s.users, user)
+	s.presence[user.ID] = presence
+}
+
+// AddBot adds a bot to the workspace
+func (s *Server) AddBot(bot slack.Bot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bots[bot.ID] = bot
+}
+
+// AddUserGroup adds a user group to the workspace
+func (s *Server) AddUserGroup(group slack.UserGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups = append(s.groups, group)
+}
+
+// AddChannel adds a conversation to the workspace
+func (s *Server) AddChannel(channel slack.Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channels = append(s.channels, channel)
+}
+
+// AddMessage adds a message to the history of a channel without sending
+// an event, when the timestamp of the message isn't set it will be
+// generated. The timestamp of the message is returned.
+func (s *Server) AddMessage(channelID string, msg slack.Message) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addMessage(channelID, msg).Timestamp
+}
+
+// SendMessage adds a message to the history of a channel, as if it was
+// posted by userID, and pushes a `message` event to the RTM connections.
+// When threadID is set, the message is a reply to that thread.
+func (s *Server) SendMessage(channelID string, threadID string, userID string, text string) string {
+	s.mu.Lock()
+	msg := s.addMessage(channelID, slack.Message{
+		Msg: slack.Msg{
+			User:            userID,
+			Text:            text,
+			ThreadTimestamp: threadID,
+		},
+	})
+	s.mu.Unlock()
+
+	s.SendEvent(msg)
+
+	return msg.Timestamp
+}
+
+// SendPresenceChange pushes a `presence_change` event to the RTM connections
+func (s *Server) SendPresenceChange(userID string, presence string) {
+	s.mu.Lock()
+	s.presence[userID] = presence
+	s.mu.Unlock()
+
+	s.SendEvent(map[string]string{
+		"type":     "presence_change",
+		"user":     userID,
+		"presence": presence,
+	})
+}
+
+// SendEvent pushes an arbitrary event to the RTM and Socket Mode
+// connections, v will be encoded as json.
+func (s *Server) SendEvent(v interface{}) {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.writeEvent(v)
+	}
+}
+
+// SendDisconnect asks the Socket Mode connections to reconnect, like slack
+// does before it refreshes a connection
+func (s *Server) SendDisconnect(reason string) {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		if c.socketMode {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.writeJSON(map[string]string{
+			"type":   "disconnect",
+			"reason": reason,
+		})
+	}
+}
+
+// GetAcks returns the ids of the envelopes that have been acknowledged by
+// the Socket Mode connections, in the order they were received
+func (s *Server) GetAcks() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.acks...)
+}
+
+// SetRateLimited will respond to the next n requests to method with a rate
+// limited error, that asks the client to retry after a second
+func (s *Server) SetRateLimited(method string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limited[method] = n
+}
+
+// GetMessages returns the messages of a channel, oldest first
+func (s *Server) GetMessages(channelID string) []slack.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]slack.Message{}, s.messages[channelID]...)
+}
+
+// GetCommands returns the slash commands that have been received
+func (s *Server) GetCommands() []Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Command{}, s.commands...)
+}
+
+// GetReadMark returns the timestamp of the last read mark of a channel
+func (s *Server) GetReadMark(channelID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.marks[channelID]
+}
+
+// addMessage stores the message in the history of a channel, s.mu needs to
+// be held by the caller.
+func (s *Server) addMessage(channelID string, msg slack.Message) slack.Message {
+	msg.Type = "message"
+	msg.Channel = channelID
+
+	if msg.Timestamp == "" {
+		msg.Timestamp = s.nextTimestamp()
+	}
+
+	// Keep track of the replies on the parent, so that clients know that
+	// a message is a thread
+	if msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp {
+		for i, m := range s.messages[channelID] {
+			if m.Timestamp == msg.ThreadTimestamp {
+				s.messages[channelID][i].ThreadTimestamp = m.Timestamp
+				s.messages[channelID][i].ReplyCount++
+				s.messages[channelID][i].Replies = append(
+					s.messages[channelID][i].Replies,
+					slack.Reply{User: msg.User, Timestamp: msg.Timestamp},
+				)
+			}
+		}
+	}
+
+	msgs := append(s.messages[channelID], msg)
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return parseTimestamp(msgs[i].Timestamp) < parseTimestamp(msgs[j].Timestamp)
+	})
+	s.messages[channelID] = msgs
+
+	return msg
+}
+
+// nextTimestamp returns a unique message timestamp, s.mu needs to be held
+// by the caller.
+func (s *Server) nextTimestamp() string {
+	s.counter++
+	return fmt.Sprintf("%d.%06d", s.timestamp, s.counter)
+}
+
+// findChannel returns the channel with channelID, s.mu needs to be held by
+// the caller.
+func (s *Server) findChannel(channelID string) (slack.Channel, bool) {
+	for _, chn := range s.channels {
+		if chn.ID == channelID {
+			return chn, true
+		}
+	}
+	return slack.Channel{}, false
+}
+
+func (s *Server) findUser(userID string) (slack.User, bool) {
+	for _, user := range s.users {
+		if user.ID == userID {
+			return user, true
+		}
+	}
+	return slack.User{}, false
+}
+
+// rateLimit will respond with http status 429 to the methods that have been
+// rate limited with SetRateLimited
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, "/api/")
+
+		s.mu.Lock()
+		limited := s.limited[method] > 0
+		if limited {
+			s.limited[method]--
+		}
+		s.mu.Unlock()
+
+		if limited {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleOK(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{"ok": true})
+}
+
+func (s *Server) handleAuthTest(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"ok":      true,
+		"url":     s.URL,
+		"team":    s.team.Name,
+		"team_id": s.team.ID,
+		"user":    s.self.Name,
+		"user_id": s.self.ID,
+	})
+}
+
+func (s *Server) handleUsersList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"ok":      true,
+		"members": s.users,
+	})
+}
+
+func (s *Server) handleUsersInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.findUser(r.FormValue("user"))
+	if !ok {
+		writeError(w, "user_not_found")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":   true,
+		"user": user,
+	})
+}
+
+func (s *Server) handleUsersGetPresence(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	presence, ok := s.presence[r.FormValue("user")]
+	if !ok {
+		writeError(w, "user_not_found")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":       true,
+		"presence": presence,
+	})
+}
+
+func (s *Server) handleBotsInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bot, ok := s.bots[r.FormValue("bot")]
+	if !ok {
+		writeError(w, "bot_not_found")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":  true,
+		"bot": bot,
+	})
+}
+
+func (s *Server) handleUserGroupsList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"ok":         true,
+		"usergroups": s.groups,
+	})
+}
+
+func (s *Server) handleRTMConnect(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"ok":  true,
+		"url": "ws" + strings.TrimPrefix(s.URL, "http") + "/ws",
+		"self": map[string]string{
+			"id":   s.self.ID,
+			"name": s.self.Name,
+		},
+		"team": s.team,
+	})
+}
+
+func (s *Server) handleAppsConnectionsOpen(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer xapp-") {
+		writeError(w, "not_allowed_token_type")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":  true,
+		"url": "ws" + strings.TrimPrefix(s.URL, "http") + "/socket-mode",
+	})
+}
+
+func (s *Server) handleConversationsList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"ok":       true,
+		"channels": s.channels,
+		"response_metadata": map[string]string{
+			"next_cursor": "",
+		},
+	})
+}
+
+func (s *Server) handleConversationsHistory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	latest := parseTimestamp(r.FormValue("latest"))
+	oldest := parseTimestamp(r.FormValue("oldest"))
+	inclusive := r.FormValue("inclusive") == "true" || r.FormValue("inclusive") == "1"
+
+	if _, ok := s.findChannel(r.FormValue("channel")); !ok {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "channel_not_found"})
+		return
+	}
+
+	// The cursor is the number of messages that have been returned on
+	// the previous pages
+	offset, _ := strconv.Atoi(r.FormValue("cursor"))
+
+	// History is returned newest first, and doesn't contain replies
+	// unless they have been broadcasted to the channel
+	msgs := s.messages[r.FormValue("channel")]
+	history := make([]slack.Message, 0)
+	hasMore := false
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msg := msgs[i]
+		if msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp {
+			continue
+		}
+
+		ts := parseTimestamp(msg.Timestamp)
+		if latest > 0 && (ts > latest || (ts == latest && !inclusive)) {
+			continue
+		}
+		if oldest > 0 && (ts < oldest || (ts == oldest && !inclusive)) {
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		if len(history) == limit {
+			hasMore = true
+			break
+		}
+		history = append(history, msg)
+	}
+
+	var cursor string
+	if hasMore {
+		current, _ := strconv.Atoi(r.FormValue("cursor"))
+		cursor = strconv.Itoa(current + len(history))
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":       true,
+		"messages": history,
+		"has_more": hasMore,
+		"response_metadata": map[string]string{
+			"next_cursor": cursor,
+		},
+	})
+}
+
+func (s *Server) handleConversationsReplies(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	threadID := r.FormValue("ts")
+
+	// Replies are returned oldest first, starting with the parent
+	replies := make([]slack.Message, 0)
+	for _, msg := range s.messages[r.FormValue("channel")] {
+		if msg.Timestamp == threadID || msg.ThreadTimestamp == threadID {
+			replies = append(replies, msg)
+		}
+	}
+
+	if len(replies) == 0 {
+		writeError(w, "thread_not_found")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":       true,
+		"messages": replies,
+		"has_more": false,
+		"response_metadata": map[string]string{
+			"next_cursor": "",
+		},
+	})
+}
+
+func (s *Server) handleChatPostMessage(w http.ResponseWriter, r *http.Request) {
+	channelID := r.FormValue("channel")
+
+	s.mu.Lock()
+	msg := s.addMessage(channelID, slack.Message{
+		Msg: slack.Msg{
+			User:            s.self.ID,
+			Text:            r.FormValue("text"),
+			ThreadTimestamp: r.FormValue("thread_ts"),
+		},
+	})
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"ok":      true,
+		"channel": channelID,
+		"ts":      msg.Timestamp,
+		"message": msg,
+	})
+
+	// Slack echoes the messages of the user over the RTM connection
+	s.SendEvent(msg)
+}
+
+func (s *Server) handleChatUpdate(w http.ResponseWriter, r *http.Request) {
+	channelID, ts := r.FormValue("channel"), r.FormValue("ts")
+
+	s.mu.Lock()
+	found := false
+	for i, m := range s.messages[channelID] {
+		if m.Timestamp == ts {
+			s.messages[channelID][i].Text = r.FormValue("text")
+			found = true
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "message_not_found"})
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":      true,
+		"channel": channelID,
+		"ts":      ts,
+		"text":    r.FormValue("text"),
+	})
+}
+
+func (s *Server) handleChatCommand(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.commands = append(s.commands, Command{
+		ChannelID: r.FormValue("channel"),
+		Command:   r.FormValue("command"),
+		Text:      r.FormValue("text"),
+	})
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{"ok": true})
+}
+
+func (s *Server) handleFilesUpload(w http.ResponseWriter, r *http.Request) {
+	file := slack.File{
+		Title:    r.FormValue("title"),
+		Filetype: r.FormValue("filetype"),
+	}
+
+	// Files are sent as multipart form, snippets as the content field
+	var content []byte
+	if err := r.ParseMultipartForm(32 << 20); err == nil {
+		f, header, err := r.FormFile("file")
+		if err == nil {
+			content, _ = ioutil.ReadAll(f)
+			f.Close()
+
+			file.Name = header.Filename
+		}
+	} else {
+		content = []byte(r.FormValue("content"))
+		file.Name = "snippet.txt"
+		file.Mimetype = "text/plain"
+	}
+	file.Size = len(content)
+
+	s.mu.Lock()
+	s.counter++
+	file.ID = fmt.Sprintf("F%d", s.counter)
+	file.URLPrivate = fmt.Sprintf("%s/files/%s/%s", s.server.URL, file.ID, file.Name)
+	s.files[file.ID] = content
+
+	var msgs []slack.Message
+	for _, channelID := range strings.Split(r.FormValue("channels"), ",") {
+		msgs = append(msgs, s.addMessage(channelID, slack.Message{
+			Msg: slack.Msg{
+				User:            s.self.ID,
+				Text:            r.FormValue("initial_comment"),
+				ThreadTimestamp: r.FormValue("thread_ts"),
+				Files:           []slack.File{file},
+			},
+		}))
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{"ok": true, "file": file})
+
+	// The messages with the file are sent over the RTM connection
+	for _, msg := range msgs {
+		s.SendEvent(msg)
+	}
+}
+
+// handleFileDownload serves the files that have been uploaded, like slack
+// it requires the token
+func (s *Server) handleFileDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, "not authenticated", http.StatusForbidden)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/files/"), "/")
+
+	s.mu.Lock()
+	content, ok := s.files[parts[0]]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Write(content)
+}
+
+func (s *Server) handleMark(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.marks[r.FormValue("channel")] = r.FormValue("ts")
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{"ok": true})
+}
+
+// handleWebsocket upgrades the connection and acts as the RTM endpoint, it
+// greets the client with `hello` and answers `ping` messages with `pong`.
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	s.serveWebsocket(w, r, false)
+}
+
+// handleSocketMode upgrades the connection and acts as the Socket Mode
+// endpoint, it greets the client with `hello` and records the
+// acknowledgements of the client, see GetAcks.
+func (s *Server) handleSocketMode(w http.ResponseWriter, r *http.Request) {
+	s.serveWebsocket(w, r, true)
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request, socketMode bool) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &conn{ws: ws, socketMode: socketMode}
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	if err := c.writeJSON(map[string]string{"type": "hello"}); err != nil {
+		return
+	}
+
+	select {
+	case s.connected <- struct{}{}:
+	default:
+	}
+
+	for {
+		var ping struct {
+			slack.Ping
+			EnvelopeID string `json:"envelope_id"`
+		}
+		if err := ws.ReadJSON(&ping); err != nil {
+			return
+		}
+
+		if socketMode && ping.EnvelopeID != "" {
+			s.mu.Lock()
+			s.acks = append(s.acks, ping.EnvelopeID)
+			s.mu.Unlock()
+		}
+
+		if !socketMode && ping.Type == "ping" {
+			c.writeJSON(slack.Pong{
+				Type:      "pong",
+				ReplyTo:   ping.ID,
+				Timestamp: ping.Timestamp,
+			})
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, msg string) {
+	writeJSON(w, map[string]interface{}{
+		"ok":    false,
+		"error": msg,
+	})
+}
+
+func parseTimestamp(ts string) float64 {
+	f, err := strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// tokenRegex matches the tokens of the message format of slack, the text of
+// a message can't contain < and > otherwise, they're escaped
+var tokenRegex = regexp.MustCompile(`<([^<>]*)>`)
+
+// parseTokens will replace the tokens of the message format of slack with
+// how they should be shown. Tokens can have a label after a |, which is
+// used when the token can't be resolved.
+//
+//	<@U12345|erroneousboat>           @erroneousboat
+//	<#C12345|general>                 #general
+//	<!here>                           @here
+//	<!subteam^S12345|@team>           @team
+//	<!date^1392734382^{date}|Feb 18>  February 18th, 2014
+//	<https://slack.com|Slack>         Slack (https://slack.com)
+//	<mailto:bob@example.com|Bob>      Bob (bob@example.com)
+//
+// https://api.slack.com/reference/surfaces/formatting#retrieving-messages
+func parseTokens(s *SlackService, msg string) string {
+	return tokenRegex.ReplaceAllStringFunc(msg, func(str string) string {
+		token := str[1 : len(str)-1]
+
+		var label string
+		if i := strings.Index(token, "|"); i >= 0 {
+			token, label = token[:i], token[i+1:]
+		}
+
+		switch {
+		case strings.HasPrefix(token, "@"):
+			return "@" + s.formatUser(token[1:], label)
+		case strings.HasPrefix(token, "#"):
+			return "#" + s.formatChannel(token[1:], label)
+		case strings.HasPrefix(token, "!subteam^"):
+			return "@" + s.formatUserGroup(strings.TrimPrefix(token, "!subteam^"), label)
+		case strings.HasPrefix(token, "!date^"):
+			return s.formatDate(strings.TrimPrefix(token, "!date^"), label)
+		case strings.HasPrefix(token, "!"):
+			// Special mentions: here, channel and everyone
+			if label != "" {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			return "@" + token[1:]
+		case token == "":
+			return str
+		default:
+			return formatLink(token, label)
+		}
+	})
+}
+
+// formatUser returns the name of the user with userID
+func (s *SlackService) formatUser(userID string, label string) string {
+	name, ok := s.getUserName(userID)
+	if !ok && !s.isOffline() {
+		// Users that can't be found are stored as well, so we won't
+		// look them up again
+		user, err := s.getUserInfo(userID)
+		if err != nil {
+			name = label
+		} else {
+			name = user.Name
+		}
+		s.setUserName(userID, name)
+	}
+
+	if name == "" {
+		name = label
+	}
+	if name == "" {
+		name = "unknown"
+	}
+
+	return name
+}
+
+// formatChannel returns the name of the channel with channelID, it is
+// looked up in the conversations of the user, because the label is the name
+// the channel had when the message was posted
+func (s *SlackService) formatChannel(channelID string, label string) string {
+	for _, chn := range s.getConversationList() {
+		if chn.ID == channelID && chn.Name != "" {
+			return chn.Name
+		}
+	}
+
+	if label != "" {
+		return label
+	}
+	return channelID
+}
+
+// formatUserGroup returns the handle of the user group with groupID, it
+// waits for the user groups when they're still being loaded
+func (s *SlackService) formatUserGroup(groupID string, label string) string {
+	s.loadUserGroups()
+
+	s.cacheMu.RLock()
+	handle, ok := s.userGroups[groupID]
+	s.cacheMu.RUnlock()
+
+	if !ok {
+		if label != "" {
+			return strings.TrimPrefix(label, "@")
+		}
+		return groupID
+	}
+
+	return handle
+}
+
+// loadUserGroups will request the user groups, only the first time it is
+// called while there is a connection. When the user groups can't be listed,
+// we won't try again for every mention, the label is shown instead.
+func (s *SlackService) loadUserGroups() {
+	if s.isOffline() {
+		return
+	}
+
+	s.userGroupsOnce.Do(func() {
+		var groups []slack.UserGroup
+		err := s.scheduler.Do("usergroups.list", PriorityBackground, func() (err error) {
+			groups, err = s.Client.GetUserGroups()
+			return err
+		})
+		if err != nil {
+			return
+		}
+
+		userGroups := make(map[string]string)
+		for _, group := range groups {
+			userGroups[group.ID] = group.Handle
+		}
+
+		s.cacheMu.Lock()
+		s.userGroups = userGroups
+		s.cacheMu.Unlock()
+	})
+}
+
+// formatDate returns the date of a date token in the time zone of the user.
+// The token is the timestamp, the format and an optional link separated by
+// a ^. The format can contain the following placeholders:
+//
+//	{date_num}           2014-02-18
+//	{date}               February 18th, 2014
+//	{date_short}         Feb 18, 2014
+//	{date_long}          Tuesday, February 18th, 2014
+//	{date_pretty}        {date}, or today, yesterday or tomorrow
+//	{date_short_pretty}  {date_short}, or today, yesterday or tomorrow
+//	{date_long_pretty}   {date_long}, or today, yesterday or tomorrow
+//	{time}               the time in the time_format of the theme
+//	{time_secs}          the time with seconds
+func (s *SlackService) formatDate(token string, label string) string {
+	parts := strings.SplitN(token, "^", 3)
+	if len(parts) < 2 {
+		return label
+	}
+
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return label
+	}
+	t := time.Unix(ts, 0)
+
+	date := func(layout string) string {
+		return strings.Replace(t.Format(layout), "{th}", ordinal(t.Day()), 1)
+	}
+	pretty := func(fallback string) string {
+		now := time.Now()
+		for days, name := range map[int]string{0: "today", -1: "yesterday", 1: "tomorrow"} {
+			d := now.AddDate(0, 0, days)
+			if d.Year() == t.Year() && d.YearDay() == t.YearDay() {
+				return name
+			}
+		}
+		return fallback
+	}
+
+	timeFormat := s.Config.Theme.Message.TimeFormat
+	if timeFormat == "" {
+		timeFormat = "15:04"
+	}
+
+	replacer := strings.NewReplacer(
+		"{date_num}", t.Format("2006-01-02"),
+		"{date}", date("January 2{th}, 2006"),
+		"{date_short}", t.Format("Jan 2, 2006"),
+		"{date_long}", date("Monday, January 2{th}, 2006"),
+		"{date_pretty}", pretty(date("January 2{th}, 2006")),
+		"{date_short_pretty}", pretty(t.Format("Jan 2, 2006")),
+		"{date_long_pretty}", pretty(date("Monday, January 2{th}, 2006")),
+		"{time}", t.Format(timeFormat),
+		"{time_secs}", t.Format(strings.Replace(timeFormat, "04", "04:05", 1)),
+	)
+	text := replacer.Replace(parts[1])
+
+	if len(parts) == 3 {
+		return formatLink(parts[2], text)
+	}
+	return text
+}
+
+// formatLink returns the label of a link followed by the url, when the
+// label is the same as the url only the url is shown
+func formatLink(url string, label string) string {
+	address := strings.TrimPrefix(url, "mailto:")
+	if label == "" || label == url || label == address ||
+		label == strings.TrimPrefix(strings.TrimPrefix(url, "http://"), "https://") {
+		return address
+	}
+
+	return fmt.Sprintf("%s (%s)", label, address)
+}
+
+// ordinal returns the suffix of the ordinal of n, like st for 1st
+func ordinal(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return "th"
+	case n%10 == 1:
+		return "st"
+	case n%10 == 2:
+		return "nd"
+	case n%10 == 3:
+		return "rd"
+	}
+	return "th"
+}
+
+// codeRegex matches code blocks and inline code, mentions in them aren't
+// encoded
+var codeRegex = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+
+// mentionRegex matches @user and #channel mentions, they need to be at the
+// start of a word so e-mail addresses and anchors of urls aren't matched
+var mentionRegex = regexp.MustCompile(`(^|[^\p{L}\p{N}_@#/:&.\-])([@#])([\p{L}\p{N}_.\-]+)`)
+
+// escaper escapes the characters that are used by the tokens of the
+// message format of slack
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// unescaper reverses escaper
+var unescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">")
+
+// keepRegex matches the tokens of the message format of slack that are sent
+// as they are, instead of being escaped. These are the tokens that can't be
+// typed otherwise, like the links and dates of a message that is edited.
+var keepRegex = regexp.MustCompile(
+	`<(?:[@#][A-Z0-9]+|![a-z][^<>|]*|(?:https?|ftp|mailto):[^<>|\s]+)(?:\|[^<>]*)?>`,
+)
+
+// encodeMessage will escape the text of a message that is being sent, and
+// encode the mentions of users and channels as tokens of the message format
+// of slack. Users are found by their handle, their display name or their
+// real name, the spaces in those names can be left out. When a mention
+// matches more than one user an AmbiguousError is returned, mentions that
+// don't match anything are sent as they are. Tokens that are already in the
+// message, see keepRegex, aren't escaped.
+//
+//	@erroneousboat  <@U12345>
+//	@here           <!here>
+//	#general        <#C12345>
+//
+// https://api.slack.com/reference/surfaces/formatting#advanced
+func (s *SlackService) encodeMessage(message string) (string, error) {
+	var encoded strings.Builder
+
+	encodeMentions := func(text string) error {
+		text = escaper.Replace(text)
+
+		last := 0
+		for _, m := range mentionRegex.FindAllStringSubmatchIndex(text, -1) {
+			prefix, name := text[m[4]:m[5]], text[m[6]:m[7]]
+
+			// Punctuation at the end of a mention belongs to the
+			// sentence, like the full stop in "thanks @bob."
+			trimmed := strings.TrimRight(name, ".-")
+			if trimmed == "" {
+				continue
+			}
+
+			var token string
+			var err error
+			if prefix == "@" {
+				token, err = s.encodeUser(trimmed)
+			} else {
+				token = s.encodeChannel(trimmed)
+			}
+			if err != nil {
+				return err
+			}
+			if token == "" {
+				continue
+			}
+
+			encoded.WriteString(text[last:m[4]])
+			encoded.WriteString(token)
+			encoded.WriteString(name[len(trimmed):])
+			last = m[1]
+		}
+		encoded.WriteString(text[last:])
+
+		return nil
+	}
+
+	// The tokens in the text are kept, mentions are only encoded when
+	// the text isn't code
+	encode := func(text string, code bool) error {
+		last := 0
+		for _, m := range keepRegex.FindAllStringIndex(text, -1) {
+			if code {
+				encoded.WriteString(escaper.Replace(text[last:m[0]]))
+			} else if err := encodeMentions(text[last:m[0]]); err != nil {
+				return err
+			}
+			encoded.WriteString(text[m[0]:m[1]])
+			last = m[1]
+		}
+
+		if code {
+			encoded.WriteString(escaper.Replace(text[last:]))
+			return nil
+		}
+		return encodeMentions(text[last:])
+	}
+
+	last := 0
+	for _, m := range codeRegex.FindAllStringIndex(message, -1) {
+		if err := encode(message[last:m[0]], false); err != nil {
+			return "", err
+		}
+		encode(message[m[0]:m[1]], true)
+		last = m[1]
+	}
+	if err := encode(message[last:], false); err != nil {
+		return "", err
+	}
+
+	return encoded.String(), nil
+}
+
+// decodeMessage returns the text of a message as it was sent, in the form
+// it can be edited in. It is the reverse of encodeMessage, the mentions of
+// users and channels are written as they're typed, and the other tokens,
+// like links and dates, are kept so they're sent again as they were.
+//
+//	<@U12345>              @erroneousboat
+//	<!here>                @here
+//	<#C12345|general>      #general
+//	&lt;b&gt;              <b>
+//	<https://slack.com>    <https://slack.com>
+func (s *SlackService) decodeMessage(text string) string {
+	var decoded strings.Builder
+
+	last := 0
+	for _, m := range keepRegex.FindAllStringIndex(text, -1) {
+		decoded.WriteString(unescaper.Replace(text[last:m[0]]))
+		decoded.WriteString(s.decodeToken(text[m[0]:m[1]]))
+		last = m[1]
+	}
+	decoded.WriteString(unescaper.Replace(text[last:]))
+
+	return decoded.String()
+}
+
+// decodeToken returns the mention of a user or a channel as it is typed,
+// other tokens, and mentions that can't be resolved, are returned as they
+// are
+func (s *SlackService) decodeToken(token string) string {
+	id := token[1 : len(token)-1]
+	if i := strings.Index(id, "|"); i >= 0 {
+		id = id[:i]
+	}
+
+	switch {
+	case id == "!here" || id == "!channel" || id == "!everyone":
+		return "@" + id[1:]
+	case strings.HasPrefix(id, "@"):
+		if name, ok := s.getUserName(id[1:]); ok && name != "" {
+			return "@" + name
+		}
+	case strings.HasPrefix(id, "#"):
+		for _, chn := range s.getConversationList() {
+			if chn.ID == id[1:] && !chn.IsIM && chn.Name != "" {
+				return "#" + chn.Name
+			}
+		}
+	}
+
+	return token
+}
+
+// encodeUser returns the token of the user, or the special mention, with
+// name. An empty token is returned when no user is found.
+func (s *SlackService) encodeUser(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "here", "channel", "everyone":
+		return "<!" + strings.ToLower(name) + ">", nil
+	}
+
+	normalize := func(name string) string {
+		return strings.ToLower(strings.Replace(name, " ", "", -1))
+	}
+
+	s.cacheMu.RLock()
+	defer s.cacheMu.RUnlock()
+
+	// Handles are unique, so they're matched first, after that the
+	// display names, and the real names last
+	for field := 0; field < 3; field++ {
+		var userIDs []string
+		for userID, handle := range s.UserCache {
+			names := append([]string{handle}, s.profileNames[userID]...)
+			if field < len(names) && names[field] != "" &&
+				normalize(names[field]) == normalize(name) {
+				userIDs = append(userIDs, userID)
+			}
+		}
+
+		switch len(userIDs) {
+		case 0:
+			continue
+		case 1:
+			return "<@" + userIDs[0] + ">", nil
+		}
+
+		handles := make([]string, 0, len(userIDs))
+		for _, userID := range userIDs {
+			handles = append(handles, s.UserCache[userID])
+		}
+		sort.Strings(handles)
+
+		return "", &AmbiguousError{Mention: "@" + name, Matches: handles}
+	}
+
+	return "", nil
+}
+
+// encodeChannel returns the token of the channel with name, an empty token
+// is returned when the user isn't a member of such a channel
+func (s *SlackService) encodeChannel(name string) string {
+	for _, chn := range s.getConversationList() {
+		if !chn.IsIM && strings.EqualFold(chn.Name, name) {
+			return "<#" + chn.ID + ">"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/erroneousboat/slack-term/config"
+)
+
+// newTestFormatService returns a SlackService that knows the users bob and
+// carol, and the channel #general
+func newTestFormatService() *SlackService {
+	general := slack.Channel{}
+	general.ID = "C1"
+	general.Name = "general"
+
+	return &SlackService{
+		Conversations: []slack.Channel{general},
+		UserCache:     map[string]string{"U1": "bob", "U2": "carol"},
+		profileNames: map[string][]string{
+			"U1": {"Bobby", "Bob Builder"},
+			"U2": {"Carol", "Carol Singer"},
+		},
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	s := newTestFormatService()
+	s.Config = &config.Config{}
+	s.userGroups = map[string]string{"S1": "team"}
+
+	// Users that aren't known aren't looked up while offline
+	s.setOffline(true)
+
+	date := time.Unix(1392734382, 0)
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"hi <@U1>", "hi @bob"},
+		{"hi <@U9|dave> and <@U8>", "hi @dave and @unknown"},
+		{"see <#C1|old-name> and <#C9|random>", "see #general and #random"},
+		{"<!here>, <!channel> and <!everyone|@all>", "@here, @channel and @all"},
+		{"<!subteam^S1|@ops> <!subteam^S9|@devs>", "@team @devs"},
+		{"<!date^1392734382^{date_num} {time}|Feb 18>", date.Format("2006-01-02 15:04")},
+		{"<!date^1392734382^{date_short}^https://x.com|Feb 18>", date.Format("Jan 2, 2006") + " (https://x.com)"},
+		{"<!date^nope^{date}|Feb 18>", "Feb 18"},
+		{"<https://slack.com|Slack> <https://slack.com>", "Slack (https://slack.com) https://slack.com"},
+		{"<mailto:bob@example.com|Bob> <mailto:bob@example.com|bob@example.com>", "Bob (bob@example.com) bob@example.com"},
+		{"<>", "<>"},
+	}
+
+	for _, tt := range tests {
+		if got := parseTokens(s, tt.text); got != tt.want {
+			t.Errorf("parseTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, want := range map[int]string{1: "st", 2: "nd", 3: "rd", 4: "th", 11: "th", 12: "th", 13: "th", 21: "st", 22: "nd", 23: "rd"} {
+		if got := ordinal(n); got != want {
+			t.Errorf("ordinal(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	s := newTestFormatService()
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"hi @bob.", "hi <@U1>."},
+		{"hi @BobBuilder", "hi <@U1>"},
+		{"@here see #general", "<!here> see <#C1>"},
+		{"a & <b>", "a &amp; &lt;b&gt;"},
+		{"@nobody #nowhere", "@nobody #nowhere"},
+		{"`@bob <b>`", "`@bob &lt;b&gt;`"},
+		{"see <https://x.com|x> @bob", "see <https://x.com|x> <@U1>"},
+		{"<!date^1392734382^{date}|Feb 18> <!subteam^S1>", "<!date^1392734382^{date}|Feb 18> <!subteam^S1>"},
+		{"`<@U2>`", "`<@U2>`"},
+	}
+
+	for _, tt := range tests {
+		got, err := s.encodeMessage(tt.message)
+		if err != nil {
+			t.Errorf("encodeMessage(%q): %v", tt.message, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("encodeMessage(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	s := newTestFormatService()
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"hi <@U1>", "hi @bob"},
+		{"<!here> see <#C1>", "@here see #general"},
+		{"a &amp; &lt;b&gt;", "a & <b>"},
+		{"<@U9> in <#C9>", "<@U9> in <#C9>"},
+		{"see <https://x.com|x &amp; y>", "see <https://x.com|x &amp; y>"},
+		{"<!subteam^S1|@team>", "<!subteam^S1|@team>"},
+	}
+
+	for _, tt := range tests {
+		if got := s.decodeMessage(tt.text); got != tt.want {
+			t.Errorf("decodeMessage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+
+		// What is decoded is sent as it was received
+		if got, err := s.encodeMessage(s.decodeMessage(tt.text)); err != nil || got != tt.text {
+			t.Errorf("encodeMessage(decodeMessage(%q)) = %q, %v", tt.text, got, err)
+		}
+	}
+}
+
+func TestEncodeMessageAmbiguous(t *testing.T) {
+	s := newTestFormatService()
+	s.UserCache["U3"] = "robert"
+	s.profileNames["U3"] = []string{"Bobby", "Robert Builder"}
+
+	_, err := s.encodeMessage("hi @Bobby")
+	if !IsAmbiguous(err) {
+		t.Fatalf("got %v, want an ambiguous mention", err)
+	}
+
+	want := "@Bobby matches more than one user, use one of @bob, @robert instead"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+
+	// Handles are matched before the display names
+	if got, err := s.encodeMessage("hi @robert"); err != nil || got != "hi <@U3>" {
+		t.Errorf("got %q, %v, want the handle of robert", got, err)
+	}
+}
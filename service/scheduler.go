@@ -0,0 +1,260 @@
+package service
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Priority is the priority of a request made by the Scheduler
+type Priority int
+
+const (
+	// PriorityInteractive is used for requests the user interface is
+	// waiting on, e.g. loading the messages of a channel
+	PriorityInteractive Priority = iota
+
+	// PriorityBackground is used for requests the user isn't waiting on,
+	// e.g. updating the presence of users
+	PriorityBackground
+)
+
+const (
+	schedulerMaxAttempts = 5
+	schedulerMinBackoff  = 500 * time.Millisecond
+	schedulerMaxBackoff  = 30 * time.Second
+)
+
+// Requests per minute of the rate limit tiers of the web api, see:
+// https://api.slack.com/docs/rate-limits
+const (
+	tier1 = 1
+	tier2 = 20
+	tier3 = 50
+	tier4 = 100
+
+	// Methods like chat.postMessage have a special rate limit of 1 message
+	// per second per channel, with short bursts allowed
+	tierPostMessage = 60
+)
+
+// methodTiers contains the rate limit tier of the methods we use, methods
+// that aren't listed are considered to be in tier 3
+var methodTiers = map[string]int{
+	"auth.test":             tier4,
+	"bots.info":             tier3,
+	"channels.mark":         tier3,
+	"chat.command":          tier2,
+	"chat.delete":           tier3,
+	"chat.postMessage":      tierPostMessage,
+	"chat.update":           tier3,
+	"conversations.history": tier3,
+	"conversations.list":    tier2,
+	"conversations.replies": tier3,
+	"files.upload":          tier2,
+	"groups.mark":           tier3,
+	"im.mark":               tier3,
+	"reactions.add":         tier3,
+	"reactions.remove":      tier2,
+	"users.getPresence":     tier3,
+	"users.info":            tier4,
+	"users.list":            tier2,
+	"users.setPresence":     tier2,
+	"usergroups.list":       tier2,
+}
+
+// nonIdempotent contains the methods that have an effect every time they're
+// called, e.g. posting a message. A request to them that failed because of a
+// transient error may have reached slack anyway, so it isn't retried.
+var nonIdempotent = map[string]bool{
+	"chat.command":     true,
+	"chat.postMessage": true,
+	"files.upload":     true,
+}
+
+// Scheduler will make the requests to the slack web api. It makes sure we
+// stay within the rate limits of every method, it waits when slack tells
+// us we've hit a rate limit anyway, and it retries requests that failed
+// because of a transient error.
+//
+// Every method has a bucket of tokens that is refilled at the rate of its
+// tier. Requests with PriorityBackground wait as long as there are requests
+// with PriorityInteractive waiting for the same method, and they leave part
+// of the bucket for those requests.
+type Scheduler struct {
+	mu      sync.Mutex
+	methods map[string]*methodLimit
+}
+
+// methodLimit is the rate limit state of a single method
+type methodLimit struct {
+	capacity float64
+	reserve  float64
+	rate     float64 // tokens per second
+	tokens   float64
+	updated  time.Time
+
+	// blockedUntil is set when slack has responded with a rate limited
+	// error, no requests are made for this method before that time
+	blockedUntil time.Time
+
+	// waiting is the number of requests waiting for a token by priority
+	waiting map[Priority]int
+}
+
+// NewScheduler is the constructor of the Scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		methods: make(map[string]*methodLimit),
+	}
+}
+
+// Do will call fn, which should make a single request to method, once the
+// rate limit of method allows it. When fn fails because of a rate limit,
+// or a transient error, it will be called again after waiting. Methods that
+// are in nonIdempotent are only retried after a rate limit. The error of the
+// last attempt is returned.
+func (s *Scheduler) Do(method string, priority Priority, fn func() error) error {
+	backoff := schedulerMinBackoff
+
+	var err error
+	for attempt := 1; attempt <= schedulerMaxAttempts; attempt++ {
+		s.acquire(method, priority)
+
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		switch e := err.(type) {
+		case *slack.RateLimitedError:
+			s.block(method, e.RetryAfter)
+			continue
+		}
+
+		if nonIdempotent[method] || !isTransient(err) {
+			return err
+		}
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > schedulerMaxBackoff {
+			backoff = schedulerMaxBackoff
+		}
+	}
+
+	return err
+}
+
+// acquire will block until a request to method can be made
+func (s *Scheduler) acquire(method string, priority Priority) {
+	s.mu.Lock()
+	m := s.method(method)
+	m.waiting[priority]++
+
+	for {
+		now := time.Now()
+		m.refill(now)
+
+		var wait time.Duration
+		switch {
+		case now.Before(m.blockedUntil):
+			wait = m.blockedUntil.Sub(now)
+		case priority == PriorityBackground && m.waiting[PriorityInteractive] > 0:
+			wait = m.timeUntil(1)
+		case priority == PriorityBackground && m.tokens < 1+m.reserve:
+			wait = m.timeUntil(1 + m.reserve)
+		case m.tokens < 1:
+			wait = m.timeUntil(1)
+		default:
+			m.tokens--
+			m.waiting[priority]--
+			s.mu.Unlock()
+			return
+		}
+
+		// Wake up regularly, so background requests notice when
+		// interactive requests are done
+		if wait < 10*time.Millisecond {
+			wait = 10 * time.Millisecond
+		} else if wait > time.Second {
+			wait = time.Second
+		}
+
+		s.mu.Unlock()
+		time.Sleep(wait)
+		s.mu.Lock()
+	}
+}
+
+// block will hold off all requests to method for the duration
+func (s *Scheduler) block(method string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.method(method)
+	m.blockedUntil = time.Now().Add(d)
+	m.tokens = 0
+}
+
+// method returns the rate limit state of a method, s.mu should be held
+func (s *Scheduler) method(method string) *methodLimit {
+	m, ok := s.methods[method]
+	if ok {
+		return m
+	}
+
+	tier, ok := methodTiers[method]
+	if !ok {
+		tier = tier3
+	}
+
+	// We allow bursts of a fifth of the requests per minute, of which
+	// a fifth is reserved for interactive requests
+	capacity := float64(tier) / 5
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	m = &methodLimit{
+		capacity: capacity,
+		reserve:  float64(int(capacity / 5)),
+		rate:     float64(tier) / 60,
+		tokens:   capacity,
+		updated:  time.Now(),
+		waiting:  make(map[Priority]int),
+	}
+	s.methods[method] = m
+
+	return m
+}
+
+func (m *methodLimit) refill(now time.Time) {
+	m.tokens += now.Sub(m.updated).Seconds() * m.rate
+	if m.tokens > m.capacity {
+		m.tokens = m.capacity
+	}
+	m.updated = now
+}
+
+// timeUntil returns how long it will take until there are n tokens
+func (m *methodLimit) timeUntil(n float64) time.Duration {
+	return time.Duration((n - m.tokens) / m.rate * float64(time.Second))
+}
+
+// isTransient returns true when err is an error that is likely to go away
+// when the request is retried, like a timeout or a 5xx response
+func isTransient(err error) bool {
+	if e, ok := err.(interface{ Retryable() bool }); ok {
+		return e.Retryable()
+	}
+
+	if e, ok := err.(net.Error); ok {
+		return e.Timeout() || e.Temporary()
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// timeoutError is a transient error, like the timeout of a request
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// failing returns a function that fails with err the first n times it is
+// called, and the number of calls
+func failing(n int, err error) (func() error, *int) {
+	calls := 0
+	return func() error {
+		calls++
+		if calls <= n {
+			return err
+		}
+		return nil
+	}, &calls
+}
+
+func TestSchedulerRetriesTransientErrors(t *testing.T) {
+	s := NewScheduler()
+
+	fn, calls := failing(1, timeoutError{})
+	if err := s.Do("conversations.history", PriorityInteractive, fn); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("got %d calls, want 2", *calls)
+	}
+}
+
+func TestSchedulerDoesNotRetryNonIdempotent(t *testing.T) {
+	s := NewScheduler()
+
+	for method := range nonIdempotent {
+		fn, calls := failing(1, timeoutError{})
+		if err := s.Do(method, PriorityInteractive, fn); err == nil {
+			t.Errorf("%s: the error wasn't returned", method)
+		}
+		if *calls != 1 {
+			t.Errorf("%s: got %d calls, want 1", method, *calls)
+		}
+	}
+}
+
+func TestSchedulerRetriesRateLimited(t *testing.T) {
+	s := NewScheduler()
+
+	limited := &slack.RateLimitedError{RetryAfter: 10 * time.Millisecond}
+	fn, calls := failing(1, limited)
+	if err := s.Do("chat.postMessage", PriorityInteractive, fn); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("got %d calls, want 2", *calls)
+	}
+}
+
+func TestSchedulerPermanentErrors(t *testing.T) {
+	s := NewScheduler()
+
+	fn, calls := failing(1, errors.New("channel_not_found"))
+	if err := s.Do("conversations.history", PriorityInteractive, fn); err == nil {
+		t.Error("the error wasn't returned")
+	}
+	if *calls != 1 {
+		t.Errorf("got %d calls, want 1", *calls)
+	}
+}
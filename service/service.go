@@ -0,0 +1,117 @@
+package service
+
+import (
+	"github.com/erroneousboat/slack-term/components"
+)
+
+var (
+	_ Service = &SlackService{}
+	_ Service = &FakeService{}
+)
+
+// Service is the definition of a chat backend. The user interface only
+// talks to the backend through this interface, SlackService is the
+// implementation that talks to Slack, FakeService is an in-memory
+// implementation that can be used to run the user interface without a
+// Slack workspace.
+type Service interface {
+	// GetChannels returns the channels, groups and im channels of the
+	// current user
+	GetChannels() ([]components.ChannelItem, error)
+
+	// GetMessages returns the messages of a channel delimited by count,
+	// together with the thread identifiers of that channel. The replies
+	// of the threads aren't included, see GetReplies.
+	GetMessages(channelID string, count int) ([]components.Message, []components.ChannelItem, error)
+
+	// GetMessageByID returns the message, including its replies, with
+	// the messageID (timestamp) in channelID
+	GetMessageByID(messageID string, channelID string) ([]components.Message, error)
+
+	// GetReplies returns the replies of the thread with the timestamp
+	// threadID in channelID
+	GetReplies(channelID string, threadID string) ([]components.Message, error)
+
+	// SendMessage sends a message to a channel
+	SendMessage(channelID string, message string) error
+
+	// SendReply sends a message to the thread threadID in a channel
+	SendReply(channelID string, threadID string, message string) error
+
+	// EditMessage replaces the text of the message with the timestamp
+	// messageID in a channel, only messages of the current user can be
+	// edited
+	EditMessage(channelID string, messageID string, message string) error
+
+	// DeleteMessage deletes the message with the timestamp messageID in a
+	// channel, only messages of the current user can be deleted
+	DeleteMessage(channelID string, messageID string) error
+
+	// AddReaction adds the reaction with the emoji name, without colons,
+	// to the message with the timestamp messageID in a channel
+	AddReaction(channelID string, messageID string, name string) error
+
+	// RemoveReaction removes the reaction with the emoji name from the
+	// message with the timestamp messageID in a channel
+	RemoveReaction(channelID string, messageID string, name string) error
+
+	// UploadFile uploads the file at path to a channel, or to the thread
+	// threadID when it is set. Progress is called with the number of bytes
+	// that have been sent.
+	UploadFile(channelID string, threadID string, path string, comment string, progress func(sent int64, total int64)) error
+
+	// UploadSnippet uploads content as a text snippet to a channel, or to
+	// the thread threadID when it is set
+	UploadSnippet(channelID string, threadID string, content string, title string) error
+
+	// DownloadFile downloads a file that is shared in a message, and
+	// returns the path of the downloaded file
+	DownloadFile(file components.File) (string, error)
+
+	// DownloadPreview downloads an image to preview, the thumbnail is
+	// used when the image is larger than the configured maximum size
+	DownloadPreview(file components.File) ([]byte, error)
+
+	// SendCommand sends a slash command to a channel, it returns false
+	// when the message isn't a command
+	SendCommand(channelID string, message string) (bool, error)
+
+	// GetUserPresence returns the presence of the user
+	GetUserPresence(userID string) (string, error)
+
+	// SetUserAsActive sets the presence of the current user to active
+	SetUserAsActive()
+
+	// MarkAsRead sets the read mark of the channel to now
+	MarkAsRead(channelItem components.ChannelItem)
+
+	// GetUserNames returns the handles of the users, mapped to their
+	// display names
+	GetUserNames() map[string]string
+
+	// GetInputHistory returns the messages the user has sent, by the id
+	// of the channel they were sent to, from old to new
+	GetInputHistory() map[string][]string
+
+	// SaveInputHistory stores the messages the user has sent, so they can
+	// be recalled in the next session
+	SaveInputHistory(history map[string][]string) error
+
+	// GetDrafts returns the messages that haven't been sent yet, by the
+	// key of the channel or thread they were typed in
+	GetDrafts() map[string]components.Draft
+
+	// SaveDrafts stores the messages that haven't been sent yet, so they
+	// can be restored in the next session
+	SaveDrafts(drafts map[string]components.Draft) error
+
+	// Close is called when slack-term quits, it stores what hasn't been
+	// stored yet
+	Close() error
+
+	// GetCurrentUserID returns the id of the user that is logged in
+	GetCurrentUserID() string
+
+	// Events returns the stream of events coming from the backend
+	Events() <-chan Event
+}
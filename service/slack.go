@@ -1,11 +1,16 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html"
-	"log"
+	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -13,6 +18,7 @@ import (
 	"sync"
 	"time"
 
+	runewidth "github.com/mattn/go-runewidth"
 	"github.com/slack-go/slack"
 
 	"github.com/erroneousboat/slack-term/components"
@@ -22,104 +28,260 @@ import (
 type SlackService struct {
 	Config          *config.Config
 	Client          *slack.Client
-	RTM             *slack.RTM
+	Transport       Transport
 	Conversations   []slack.Channel
 	UserCache       map[string]string
 	ThreadCache     map[string]string
 	CurrentUserID   string
 	CurrentUsername string
+
+	cache     *Cache
+	scheduler *Scheduler
+	events    chan Event
+
+	// cacheMu guards Conversations, UserCache, ThreadCache, replyCounts,
+	// userGroups and profileNames, because messages are created
+	// concurrently when the replies of threads are loaded, and when the
+	// events are handled
+	cacheMu sync.RWMutex
+
+	// profileNames contains the display name and the real name of the
+	// users by their id, they're used to find the user of a mention
+	profileNames map[string][]string
+
+	// userGroups contains the handles of the user groups by their id,
+	// they're loaded once, in the background when the service starts,
+	// see loadUserGroups
+	userGroups     map[string]string
+	userGroupsOnce sync.Once
+
+	// replyCounts contains the reply count of the thread parents we've
+	// seen, by their timestamp. It is used to check whether the cached
+	// replies of a thread are up to date.
+	replyCounts map[string]int
+
+	// usersRefreshed is closed when the users have been refreshed, the
+	// conversations are refreshed afterwards so the names of the im
+	// channels are known
+	usersRefreshed chan struct{}
+
+	// offline is set when there is no connection with slack, the service
+	// will then only serve what is in the cache
+	offlineMu sync.RWMutex
+	offline   bool
+
+	// syncMu guards lastSeen, unsynced and opened. lastSeen is the
+	// timestamp of the newest message we've received from the Transport,
+	// after reconnecting we request the messages that were posted since.
+	// unsynced is the timestamp a resync started from, while it hasn't
+	// caught up every conversation. opened contains the ids of the
+	// conversations that have been opened, the most recent last.
+	syncMu   sync.Mutex
+	lastSeen string
+	unsynced string
+	opened   []string
 }
 
+// errOffline is returned when trying to change something while there is no
+// connection with slack
+var errOffline = errors.New("there is no connection with slack, slack-term is read-only until it reconnects")
+
+// errTooLarge is returned when an image is larger than the configured
+// maximum size
+var errTooLarge = errors.New("the image is too large to preview")
+
+// externalClient is used to download files that aren't hosted by slack,
+// like the images of link unfurls. The token isn't sent to other hosts.
+var externalClient = &http.Client{Timeout: 30 * time.Second}
+
 // NewSlackService is the constructor for the SlackService and will initialize
-// the RTM and a Client
+// the Transport and a Client
 func NewSlackService(config *config.Config) (*SlackService, error) {
+	// The bodies of the responses are kept for the blocks the library
+	// can't decode, see recordingClient
+	options := []slack.Option{
+		slack.OptionHTTPClient(recordingClient{client: &http.Client{}}),
+	}
+
+	// The api url can be changed, for instance to point the client to a
+	// fake server when testing
+	if config.APIURL != "" {
+		options = append(options, slack.OptionAPIURL(config.APIURL))
+	}
+
 	svc := &SlackService{
-		Config:      config,
-		Client:      slack.New(config.SlackToken),
-		UserCache:   make(map[string]string),
-		ThreadCache: make(map[string]string),
+		Config:       config,
+		Client:       slack.New(config.SlackToken, options...),
+		UserCache:    make(map[string]string),
+		ThreadCache:  make(map[string]string),
+		replyCounts:  make(map[string]int),
+		profileNames: make(map[string][]string),
+		cache:        NewCache(config.CacheDir),
+		scheduler:    NewScheduler(),
+		events:       make(chan Event, 50),
+
+		usersRefreshed: make(chan struct{}),
 	}
 
 	// Get user associated with token, mainly
 	// used to identify user when new messages
-	// arrives
-	authTest, err := svc.Client.AuthTest()
+	// arrives. When we can't reach slack, we use the user of the
+	// previous session, and only show what is in the cache.
+	var authTest *slack.AuthTestResponse
+	err := svc.scheduler.Do("auth.test", PriorityInteractive, func() (err error) {
+		authTest, err = svc.Client.AuthTest()
+		return err
+	})
 	if err != nil {
-		return nil, errors.New("not able to authorize client, check your connection and if your slack-token is set correctly")
+		session, ok := svc.cache.LoadSession()
+		if _, isNetErr := err.(*url.Error); !isNetErr || !ok {
+			return nil, errors.New("not able to authorize client, check your connection and if your slack-token is set correctly")
+		}
+
+		svc.offline = true
+		svc.CurrentUserID = session.UserID
+		svc.CurrentUsername = session.Username
+		svc.events <- newErrorEvent(
+			errors.New("not able to connect to slack, showing cached conversations (read-only)"),
+		)
+	} else {
+		svc.CurrentUserID = authTest.UserID
 	}
-	svc.CurrentUserID = authTest.UserID
 
-	// Create RTM
-	svc.RTM = svc.Client.NewRTM()
-	go svc.RTM.ManageConnection()
+	// Create the transport over which the events are received, RTM or
+	// socket mode
+	svc.Transport, err = NewTransport(config, svc.Client)
+	if err != nil {
+		return nil, err
+	}
 
 	// Creation of user cache this speeds up
-	// the uncovering of usernames of messages
-	users, _ := svc.Client.GetUsers()
+	// the uncovering of usernames of messages. When the users are
+	// cached, they're refreshed in the background.
+	svc.UserCache = svc.cache.LoadUsers()
+	if svc.offline {
+		close(svc.usersRefreshed)
+		svc.start()
+		return svc, nil
+	}
+
+	if len(svc.UserCache) > 0 {
+		go func() {
+			svc.refreshUsers(PriorityBackground)
+			close(svc.usersRefreshed)
+		}()
+	} else {
+		svc.refreshUsers(PriorityInteractive)
+		close(svc.usersRefreshed)
+	}
+
+	// Get name of current user, the name of the previous session is used
+	// when it's the same user
+	if session, ok := svc.cache.LoadSession(); ok &&
+		session.UserID == svc.CurrentUserID && session.Username != "" {
+		svc.CurrentUsername = session.Username
+	} else {
+		currentUser, err := svc.getUserInfo(svc.CurrentUserID)
+		if err != nil {
+			svc.CurrentUsername = "slack-term"
+		} else {
+			svc.CurrentUsername = currentUser.Name
+		}
+		svc.cache.SaveSession(svc.CurrentUserID, svc.CurrentUsername)
+	}
+
+	// Set presence to active
+	go svc.SetUserAsActive()
+
+	svc.start()
+	return svc, nil
+}
+
+// refreshUsers will request the users, and replace the UserCache with them
+func (s *SlackService) refreshUsers(priority Priority) {
+	var users []slack.User
+	err := s.scheduler.Do("users.list", priority, func() (err error) {
+		users, err = s.Client.GetUsers()
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	userCache := make(map[string]string)
+	profileNames := make(map[string][]string)
 	for _, user := range users {
 		// only add non-deleted users
 		if !user.Deleted {
-			svc.UserCache[user.ID] = user.Name
+			userCache[user.ID] = user.Name
+			profileNames[user.ID] = []string{
+				user.Profile.DisplayName, user.Profile.RealName,
+			}
 		}
 	}
 
-	// Get name of current user, and set presence to active
-	currentUser, err := svc.Client.GetUserInfo(svc.CurrentUserID)
-	if err != nil {
-		svc.CurrentUsername = "slack-term"
-	}
-	svc.CurrentUsername = currentUser.Name
-	svc.SetUserAsActive()
+	s.cacheMu.Lock()
+	s.UserCache = userCache
+	s.profileNames = profileNames
+	s.cacheMu.Unlock()
 
-	return svc, nil
+	s.cache.SaveUsers(userCache)
+}
+
+// start will connect the Transport, and handle its events. The events are
+// handled concurrently, so the caches should be populated before.
+// hasPresence returns false when the Transport doesn't deliver presence
+// events, which is the case for Socket Mode
+func (s *SlackService) hasPresence() bool {
+	return s.Config.Transport != config.TransportSocketMode
 }
 
+func (s *SlackService) start() {
+	go s.Transport.ManageConnection()
+	go s.handleIncomingEvents()
+	go s.loadUserGroups()
+}
+
+// GetChannels returns the channels of the user. When the conversations are
+// cached, the cached channels are returned, and the conversations are
+// refreshed in the background. The channels are emitted with a
+// ChannelsEvent afterwards.
 func (s *SlackService) GetChannels() ([]components.ChannelItem, error) {
-	slackChans := make([]slack.Channel, 0)
+	slackChans, ok := s.cache.LoadConversations()
+	if ok && len(slackChans) > 0 {
+		if !s.isOffline() {
+			go s.refreshConversations()
+		}
+		return s.createChannelItems(slackChans), nil
+	}
 
-	// Initial request
-	initChans, initCur, err := s.Client.GetConversations(
-		&slack.GetConversationsParameters{
-			ExcludeArchived: "true",
-			Limit:           1000,
-			Types: []string{
-				"public_channel",
-				"private_channel",
-				"im",
-				"mpim",
-			},
-		},
-	)
+	slackChans, err := s.getConversations(PriorityInteractive)
 	if err != nil {
-		return nil, err
+		return nil, newError("loading channels", err)
 	}
 
-	slackChans = append(slackChans, initChans...)
+	return s.createChannelItems(slackChans), nil
+}
 
-	// Paginate over additional channels
-	nextCur := initCur
-	for nextCur != "" {
-		channels, cursor, err := s.Client.GetConversations(
-			&slack.GetConversationsParameters{
-				Cursor:          nextCur,
-				ExcludeArchived: "true",
-				Limit:           1000,
-				Types: []string{
-					"public_channel",
-					"private_channel",
-					"im",
-					"mpim",
-				},
-			},
-		)
-		if err != nil {
-			return nil, err
-		}
+// refreshConversations will request the conversations, after the users are
+// refreshed, and emits the channels with a ChannelsEvent
+func (s *SlackService) refreshConversations() {
+	<-s.usersRefreshed
 
-		slackChans = append(slackChans, channels...)
-		nextCur = cursor
+	slackChans, err := s.getConversations(PriorityBackground)
+	if err != nil {
+		s.events <- newErrorEvent(newError("loading channels", err))
+		return
 	}
 
+	s.events <- newChannelsEvent(&ChannelsEvent{
+		Channels: s.createChannelItems(slackChans),
+	})
+}
+
+// createChannelItems will create the channels that are shown from the
+// conversations, the conversations that are shown become the Conversations
+func (s *SlackService) createChannelItems(slackChans []slack.Channel) []components.ChannelItem {
 	// We're creating tempChan, because we want to be able to
 	// sort the types of channels into buckets
 	type tempChan struct {
@@ -192,18 +354,22 @@ func (s *SlackService) GetChannels() ([]components.ChannelItem, error) {
 		}
 
 		// NOTE: user presence is set in the event handler by the function
-		// `actionSetPresenceAll`, that is why we set the presence to away
+		// `actionSetPresenceAll`, that is why we set the presence to away.
+		// Without presence events it is left empty, so no presence is
+		// shown instead of one that isn't updated.
 		if chn.IsIM {
 			// Check if user is deleted, we do this by checking the user id,
 			// and see if we have the user in the UserCache
-			name, ok := s.UserCache[chn.User]
+			name, ok := s.getUserName(chn.User)
 			if !ok {
 				continue
 			}
 
 			chanItem.Name = name
 			chanItem.Type = components.ChannelTypeIM
-			chanItem.Presence = "away"
+			if s.hasPresence() {
+				chanItem.Presence = components.PresenceAway
+			}
 
 			if chn.UnreadCount > 0 {
 				chanItem.Notification = true
@@ -226,6 +392,7 @@ func (s *SlackService) GetChannels() ([]components.ChannelItem, error) {
 	sort.Ints(keys)
 
 	var chans []components.ChannelItem
+	var conversations []slack.Channel
 	for _, k := range keys {
 
 		bucket := buckets[k]
@@ -243,16 +410,97 @@ func (s *SlackService) GetChannels() ([]components.ChannelItem, error) {
 		// Add ChannelItem and SlackChannel to the SlackService struct
 		for _, tc := range tcArr {
 			chans = append(chans, tc.channelItem)
-			s.Conversations = append(s.Conversations, tc.slackChannel)
+			conversations = append(conversations, tc.slackChannel)
+		}
+	}
+
+	s.cacheMu.Lock()
+	s.Conversations = conversations
+	s.cacheMu.Unlock()
+
+	return chans
+}
+
+// getConversations returns the conversations of the current user. They are
+// stored in the cache, and when there is no connection, the cached
+// conversations are returned.
+func (s *SlackService) getConversations(priority Priority) ([]slack.Channel, error) {
+	if s.isOffline() {
+		slackChans, ok := s.cache.LoadConversations()
+		if !ok {
+			return nil, errOffline
+		}
+		return slackChans, nil
+	}
+
+	slackChans := make([]slack.Channel, 0)
+
+	// Initial request
+	var initChans []slack.Channel
+	var initCur string
+	err := s.scheduler.Do("conversations.list", priority, func() (err error) {
+		initChans, initCur, err = s.Client.GetConversations(
+			&slack.GetConversationsParameters{
+				ExcludeArchived: "true",
+				Limit:           1000,
+				Types: []string{
+					"public_channel",
+					"private_channel",
+					"im",
+					"mpim",
+				},
+			},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slackChans = append(slackChans, initChans...)
+
+	// Paginate over additional channels
+	nextCur := initCur
+	for nextCur != "" {
+		var channels []slack.Channel
+		var cursor string
+		err := s.scheduler.Do("conversations.list", priority, func() (err error) {
+			channels, cursor, err = s.Client.GetConversations(
+				&slack.GetConversationsParameters{
+					Cursor:          nextCur,
+					ExcludeArchived: "true",
+					Limit:           1000,
+					Types: []string{
+						"public_channel",
+						"private_channel",
+						"im",
+						"mpim",
+					},
+				},
+			)
+			return err
+		})
+		if err != nil {
+			return nil, err
 		}
+
+		slackChans = append(slackChans, channels...)
+		nextCur = cursor
 	}
 
-	return chans, nil
+	s.cache.SaveConversations(slackChans)
+
+	return slackChans, nil
 }
 
 // GetUserPresence will get the presence of a specific user
 func (s *SlackService) GetUserPresence(userID string) (string, error) {
-	presence, err := s.Client.GetUserPresence(userID)
+	// Presence is updated in the background, see actionSetPresenceAll
+	var presence *slack.UserPresence
+	err := s.scheduler.Do("users.getPresence", PriorityBackground, func() (err error) {
+		presence, err = s.Client.GetUserPresence(userID)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -262,51 +510,79 @@ func (s *SlackService) GetUserPresence(userID string) (string, error) {
 
 // Set current user presence to active
 func (s *SlackService) SetUserAsActive() {
-	s.Client.SetUserPresence("auto")
+	if s.isOffline() {
+		return
+	}
+
+	s.scheduler.Do("users.setPresence", PriorityBackground, func() error {
+		return s.Client.SetUserPresence("auto")
+	})
 }
 
 // MarkAsRead will set the channel as read
 func (s *SlackService) MarkAsRead(channelItem components.ChannelItem) {
+	if s.isOffline() {
+		return
+	}
+
 	switch channelItem.Type {
 	case components.ChannelTypeChannel:
-		s.Client.SetChannelReadMark(
-			channelItem.ID, fmt.Sprintf("%f",
-				float64(time.Now().Unix())),
-		)
+		s.scheduler.Do("channels.mark", PriorityInteractive, func() error {
+			return s.Client.SetChannelReadMark(
+				channelItem.ID, fmt.Sprintf("%f",
+					float64(time.Now().Unix())),
+			)
+		})
 	case components.ChannelTypeGroup:
-		s.Client.SetGroupReadMark(
-			channelItem.ID, fmt.Sprintf("%f",
-				float64(time.Now().Unix())),
-		)
+		s.scheduler.Do("groups.mark", PriorityInteractive, func() error {
+			return s.Client.SetGroupReadMark(
+				channelItem.ID, fmt.Sprintf("%f",
+					float64(time.Now().Unix())),
+			)
+		})
 	case components.ChannelTypeMpIM:
-		s.Client.MarkIMChannel(
-			channelItem.ID, fmt.Sprintf("%f",
-				float64(time.Now().Unix())),
-		)
+		s.scheduler.Do("im.mark", PriorityInteractive, func() error {
+			return s.Client.MarkIMChannel(
+				channelItem.ID, fmt.Sprintf("%f",
+					float64(time.Now().Unix())),
+			)
+		})
 	case components.ChannelTypeIM:
-		s.Client.MarkIMChannel(
-			channelItem.ID, fmt.Sprintf("%f",
-				float64(time.Now().Unix())),
-		)
+		s.scheduler.Do("im.mark", PriorityInteractive, func() error {
+			return s.Client.MarkIMChannel(
+				channelItem.ID, fmt.Sprintf("%f",
+					float64(time.Now().Unix())),
+			)
+		})
 	}
 }
 
 // SendMessage will send a message to a particular channel
 func (s *SlackService) SendMessage(channelID string, message string) error {
+	if s.isOffline() {
+		return newError("sending message", errOffline)
+	}
 
 	// https://godoc.org/github.com/nlopes/slack#PostMessageParameters
 	postParams := slack.MsgOptionPostMessageParameters(slack.PostMessageParameters{
-		AsUser:    true,
-		Username:  s.CurrentUsername,
-		LinkNames: 1,
+		AsUser:   true,
+		Username: s.CurrentUsername,
 	})
 
-	text := slack.MsgOptionText(message, true)
+	// Mentions are encoded by us, so the text is escaped by us as well
+	message, err := s.encodeMessage(message)
+	if err != nil {
+		return newError("sending message", err)
+	}
+	text := slack.MsgOptionText(message, false)
 
 	// https://godoc.org/github.com/nlopes/slack#Client.PostMessage
-	_, _, err := s.Client.PostMessage(channelID, text, postParams)
-	if err != nil {
+	err = s.scheduler.Do("chat.postMessage", PriorityInteractive, func() error {
+		_, _, err := s.Client.PostMessage(channelID, text, postParams)
 		return err
+	})
+	if err != nil {
+		return newError("sending message", err)
 	}
 
 	return nil
@@ -316,141 +592,531 @@ func (s *SlackService) SendMessage(channelID string, message string) error {
 // ThreadTimestamp will make it reply to that specific thread. (see:
 // https://api.slack.com/docs/message-threading, 'Posting replies')
 func (s *SlackService) SendReply(channelID string, threadID string, message string) error {
+	if s.isOffline() {
+		return newError("sending message", errOffline)
+	}
+
 	// https://godoc.org/github.com/nlopes/slack#PostMessageParameters
 	postParams := slack.MsgOptionPostMessageParameters(slack.PostMessageParameters{
 		AsUser:          true,
 		Username:        s.CurrentUsername,
-		LinkNames:       1,
 		ThreadTimestamp: threadID,
 	})
 
-	text := slack.MsgOptionText(message, true)
+	// Mentions are encoded by us, so the text is escaped by us as well
+	message, err := s.encodeMessage(message)
+	if err != nil {
+		return newError("sending message", err)
+	}
+	text := slack.MsgOptionText(message, false)
 
 	// https://godoc.org/github.com/nlopes/slack#Client.PostMessage
-	_, _, err := s.Client.PostMessage(channelID, text, postParams)
-	if err != nil {
+	err = s.scheduler.Do("chat.postMessage", PriorityInteractive, func() error {
+		_, _, err := s.Client.PostMessage(channelID, text, postParams)
 		return err
+	})
+	if err != nil {
+		return newError("sending message", err)
 	}
 
 	return nil
 }
 
-// SendCommand will send a specific command to slack. First we check
-// wether we are dealing with a command, and if it is one of the supported
-// ones.
-//
-// NOTE: slack slash commands that are sent to the slack api are undocumented,
-// and as such we need to update the message option that direct it to the
-// correct api endpoint.
-//
-// https://github.com/ErikKalkoken/slackApiDoc/blob/master/chat.command.md
-func (s *SlackService) SendCommand(channelID string, message string) (bool, error) {
-	// First check if it begins with slash and a command
-	r, err := regexp.Compile(`^/\w+`)
-	if err != nil {
-		return false, err
+// EditMessage will replace the text of the message with the timestamp
+// messageID, this is only allowed for messages of the current user
+func (s *SlackService) EditMessage(channelID string, messageID string, message string) error {
+	if s.isOffline() {
+		return newError("editing message", errOffline)
 	}
 
-	match := r.MatchString(message)
-	if !match {
-		return false, nil
+	// Mentions are encoded by us, so the text is escaped by us as well
+	message, err := s.encodeMessage(message)
+	if err != nil {
+		return newError("editing message", err)
 	}
+	text := slack.MsgOptionText(message, false)
 
-	// Execute the the command when supported
-	switch r.FindString(message) {
-	case "/thread":
-		r := regexp.MustCompile(`(?P<cmd>^/\w+) (?P<id>\w+) (?P<msg>.*)`)
-		subMatch := r.FindStringSubmatch(message)
-
-		if len(subMatch) < 4 {
-			return false, errors.New("'/thread' command malformed")
-		}
-
-		threadID := s.ThreadCache[subMatch[2]]
-		msg := subMatch[3]
-
-		err := s.SendReply(channelID, threadID, msg)
-		if err != nil {
-			return false, err
-		}
+	// https://godoc.org/github.com/nlopes/slack#Client.UpdateMessage
+	err = s.scheduler.Do("chat.update", PriorityInteractive, func() error {
+		_, _, _, err := s.Client.UpdateMessage(channelID, messageID, text)
+		return err
+	})
+	if err != nil {
+		return newError("editing message", err)
+	}
 
-		return true, nil
-	default:
-		r := regexp.MustCompile(`(?P<cmd>^/\w+) (?P<text>.*)`)
-		subMatch := r.FindStringSubmatch(message)
+	return nil
+}
 
-		if len(subMatch) < 3 {
-			return false, errors.New("slash command malformed")
-		}
+// DeleteMessage will delete the message with the timestamp messageID, this
+// is only allowed for messages of the current user
+func (s *SlackService) DeleteMessage(channelID string, messageID string) error {
+	if s.isOffline() {
+		return newError("deleting message", errOffline)
+	}
 
-		cmd := subMatch[1]
-		text := subMatch[2]
+	// https://godoc.org/github.com/nlopes/slack#Client.DeleteMessage
+	err := s.scheduler.Do("chat.delete", PriorityInteractive, func() error {
+		_, _, err := s.Client.DeleteMessage(channelID, messageID)
+		return err
+	})
+	if err != nil {
+		return newError("deleting message", err)
+	}
 
-		msgOption := slack.UnsafeMsgOptionEndpoint(
-			fmt.Sprintf("%s%s", slack.APIURL, "chat.command"),
-			func(urlValues url.Values) {
-				urlValues.Add("command", cmd)
-				urlValues.Add("text", text)
-			},
-		)
+	return nil
+}
 
-		_, _, err := s.Client.PostMessage(channelID, msgOption)
-		if err != nil {
-			return false, err
-		}
+// AddReaction will add the reaction with the emoji name to a message
+func (s *SlackService) AddReaction(channelID string, messageID string, name string) error {
+	if s.isOffline() {
+		return newError("adding reaction", errOffline)
+	}
 
-		return true, nil
+	// https://godoc.org/github.com/nlopes/slack#Client.AddReaction
+	err := s.scheduler.Do("reactions.add", PriorityInteractive, func() error {
+		return s.Client.AddReaction(name, slack.NewRefToMessage(channelID, messageID))
+	})
+	if err != nil {
+		return newError("adding reaction", err)
 	}
 
-	return false, nil
+	return nil
 }
 
-// GetMessages will get messages for a channel, group or im channel delimited
-// by a count. It will return the messages, the thread identifiers
-// (as ChannelItem), and and error.
-func (s *SlackService) GetMessages(channelID string, count int) ([]components.Message, []components.ChannelItem, error) {
-
-	// https://godoc.org/github.com/nlopes/slack#GetConversationHistoryParameters
-	historyParams := slack.GetConversationHistoryParameters{
-		ChannelID: channelID,
-		Limit:     count,
-		Inclusive: false,
+// RemoveReaction will remove the reaction with the emoji name from a
+// message
+func (s *SlackService) RemoveReaction(channelID string, messageID string, name string) error {
+	if s.isOffline() {
+		return newError("removing reaction", errOffline)
 	}
 
-	history, err := s.Client.GetConversationHistory(&historyParams)
+	// https://godoc.org/github.com/nlopes/slack#Client.RemoveReaction
+	err := s.scheduler.Do("reactions.remove", PriorityInteractive, func() error {
+		return s.Client.RemoveReaction(name, slack.NewRefToMessage(channelID, messageID))
+	})
 	if err != nil {
-		return nil, nil, err
+		return newError("removing reaction", err)
 	}
 
-	// Construct the messages
-	var messages []components.Message
-	var threads []components.ChannelItem
-	for _, message := range history.Messages {
-		msg := s.CreateMessage(message, channelID)
-		messages = append(messages, msg)
+	return nil
+}
 
-		// FIXME: create boolean isThread
-		if msg.Thread != "" {
-			threads = append(threads, components.ChannelItem{
-				ID:          msg.ID,
-				Name:        msg.Thread,
-				Type:        components.ChannelTypeGroup,
-				StylePrefix: s.Config.Theme.Channel.Prefix,
-				StyleIcon:   s.Config.Theme.Channel.Icon,
-				StyleText:   s.Config.Theme.Channel.Text,
-			})
-		}
+// UploadFile will upload the file at path to a channel, or a thread. The
+// file is streamed to slack, progress is called while it is being sent.
+func (s *SlackService) UploadFile(channelID string, threadID string, path string, comment string, progress func(sent int64, total int64)) error {
+	if s.isOffline() {
+		return newError("uploading file", errOffline)
 	}
 
-	// Reverse the order of the messages, we want the newest in
-	// the last place
-	var messagesReversed []components.Message
-	for i := len(messages) - 1; i >= 0; i-- {
-		messagesReversed = append(messagesReversed, messages[i])
+	info, err := os.Stat(path)
+	if err != nil {
+		return newError("uploading file", err)
+	}
+	if info.IsDir() {
+		return newError("uploading file", fmt.Errorf("%s is a directory", path))
 	}
 
-	return messagesReversed, threads, nil
-}
+	// https://godoc.org/github.com/nlopes/slack#Client.UploadFile
+	err = s.scheduler.Do("files.upload", PriorityInteractive, func() error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = s.Client.UploadFile(slack.FileUploadParameters{
+			Reader: &progressReader{
+				r:        file,
+				total:    info.Size(),
+				progress: progress,
+			},
+			Filename:        filepath.Base(path),
+			Title:           filepath.Base(path),
+			InitialComment:  comment,
+			Channels:        []string{channelID},
+			ThreadTimestamp: threadID,
+		})
+		return err
+	})
+	if err != nil {
+		return newError("uploading file", err)
+	}
+
+	return nil
+}
+
+// UploadSnippet will upload content as a text snippet to a channel, or a
+// thread
+func (s *SlackService) UploadSnippet(channelID string, threadID string, content string, title string) error {
+	if s.isOffline() {
+		return newError("uploading snippet", errOffline)
+	}
+
+	// https://godoc.org/github.com/nlopes/slack#Client.UploadFile
+	err := s.scheduler.Do("files.upload", PriorityInteractive, func() error {
+		_, err := s.Client.UploadFile(slack.FileUploadParameters{
+			Content:         content,
+			Filetype:        "text",
+			Title:           title,
+			Channels:        []string{channelID},
+			ThreadTimestamp: threadID,
+		})
+		return err
+	})
+	if err != nil {
+		return newError("uploading snippet", err)
+	}
+
+	return nil
+}
+
+// DownloadFile will download a file that is shared in a message into the
+// download directory, the request is authenticated with the token. Files
+// that have been downloaded before aren't downloaded again.
+func (s *SlackService) DownloadFile(file components.File) (string, error) {
+	if s.Config.DownloadDir == "" {
+		return "", newError("downloading file", errors.New("download_dir isn't set"))
+	}
+
+	if err := os.MkdirAll(s.Config.DownloadDir, 0700); err != nil {
+		return "", newError("downloading file", err)
+	}
+
+	// Files are stored by their id, plenty of files share a name like
+	// image.png
+	name := file.ID
+	if base := filepath.Base(file.Name); base != "" && base != "." && base != "/" {
+		name = fmt.Sprintf("%s-%s", file.ID, base)
+	}
+
+	path := filepath.Join(s.Config.DownloadDir, name)
+	if info, err := os.Stat(path); err == nil && info.Size() == int64(file.Size) {
+		return path, nil
+	}
+
+	if s.isOffline() {
+		return "", newError("downloading file", errOffline)
+	}
+
+	// We download to a temporary file, so we won't leave a partly
+	// downloaded file behind when it fails
+	tmp := path + ".part"
+	err := s.scheduler.Do("files.download", PriorityInteractive, func() error {
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// https://godoc.org/github.com/nlopes/slack#Client.GetFile
+		return s.Client.GetFile(file.URL, f)
+	})
+	if err != nil {
+		os.Remove(tmp)
+		return "", newError("downloading file", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return "", newError("downloading file", err)
+	}
+
+	return path, nil
+}
+
+// DownloadPreview will download an image to preview in memory. When the image
+// is larger than image_max_size the thumbnail is downloaded instead.
+func (s *SlackService) DownloadPreview(file components.File) ([]byte, error) {
+	if s.isOffline() {
+		return nil, newError("downloading preview", errOffline)
+	}
+
+	url := file.URL
+	if file.Size > s.Config.ImageMaxSize && file.Thumb != "" {
+		url = file.Thumb
+	}
+
+	data, err := s.downloadImage(url, file.External)
+
+	// The size of external images isn't known up front
+	if err == errTooLarge && url != file.Thumb && file.Thumb != "" {
+		data, err = s.downloadImage(file.Thumb, file.External)
+	}
+	if err != nil {
+		return nil, newError("downloading preview", err)
+	}
+
+	return data, nil
+}
+
+// downloadImage will download the image at url, it stops when the image is
+// larger than image_max_size
+func (s *SlackService) downloadImage(url string, external bool) ([]byte, error) {
+	w := &limitWriter{limit: s.Config.ImageMaxSize}
+
+	if external {
+		resp, err := externalClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+		}
+
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			return nil, err
+		}
+
+		return w.buf, nil
+	}
+
+	err := s.scheduler.Do("files.download", PriorityBackground, func() error {
+		w.buf = nil
+
+		// https://godoc.org/github.com/nlopes/slack#Client.GetFile
+		return s.Client.GetFile(url, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return w.buf, nil
+}
+
+// limitWriter keeps what is written to it in memory, and returns
+// errTooLarge when more than limit bytes are written
+type limitWriter struct {
+	buf   []byte
+	limit int
+}
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if len(w.buf)+len(b) > w.limit {
+		return 0, errTooLarge
+	}
+
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+// progressReader will call progress with the number of bytes that have
+// been read from r so far
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	total    int64
+	progress func(read int64, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+
+	if p.progress != nil {
+		p.progress(p.read, p.total)
+	}
+
+	return n, err
+}
+
+// SendCommand will send a specific command to slack. First we check
+// wether we are dealing with a command, and if it is one of the supported
+// ones.
+//
+// NOTE: slack slash commands that are sent to the slack api are undocumented,
+// and as such we need to update the message option that direct it to the
+// correct api endpoint.
+//
+// https://github.com/ErikKalkoken/slackApiDoc/blob/master/chat.command.md
+func (s *SlackService) SendCommand(channelID string, message string) (bool, error) {
+	// First check if it begins with slash and a command
+	r, err := regexp.Compile(`^/\w+`)
+	if err != nil {
+		return false, err
+	}
+
+	match := r.MatchString(message)
+	if !match {
+		return false, nil
+	}
+
+	if s.isOffline() {
+		return false, newError("sending command", errOffline)
+	}
+
+	// Execute the the command when supported
+	switch r.FindString(message) {
+	case "/thread":
+		r := regexp.MustCompile(`(?P<cmd>^/\w+) (?P<id>\w+) (?P<msg>.*)`)
+		subMatch := r.FindStringSubmatch(message)
+
+		if len(subMatch) < 4 {
+			return false, errors.New("'/thread' command malformed")
+		}
+
+		s.cacheMu.RLock()
+		threadID := s.ThreadCache[subMatch[2]]
+		s.cacheMu.RUnlock()
+		msg := subMatch[3]
+
+		err := s.SendReply(channelID, threadID, msg)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	default:
+		r := regexp.MustCompile(`(?P<cmd>^/\w+) (?P<text>.*)`)
+		subMatch := r.FindStringSubmatch(message)
+
+		if len(subMatch) < 3 {
+			return false, errors.New("slash command malformed")
+		}
+
+		cmd := subMatch[1]
+		text := subMatch[2]
+
+		msgOption := slack.UnsafeMsgOptionEndpoint(
+			fmt.Sprintf("%s%s", s.getAPIURL(), "chat.command"),
+			func(urlValues url.Values) {
+				urlValues.Add("command", cmd)
+				urlValues.Add("text", text)
+			},
+		)
+
+		err := s.scheduler.Do("chat.command", PriorityInteractive, func() error {
+			_, _, err := s.Client.PostMessage(channelID, msgOption)
+			return err
+		})
+		if err != nil {
+			return false, newError("sending command", err)
+		}
+
+		return true, nil
+	}
+}
+
+// GetMessages will get messages for a channel, group or im channel delimited
+// by a count. It will return the messages, the thread identifiers
+// (as ChannelItem), and and error.
+//
+// The cached messages are returned right away, the messages that are newer
+// than the newest cached message are requested in the background, and are
+// emitted with a HistoryEvent. Only when nothing is cached, the messages
+// are requested from slack before they're returned. When there is no
+// connection, only the cached messages are returned.
+func (s *SlackService) GetMessages(channelID string, count int) ([]components.Message, []components.ChannelItem, error) {
+	s.setOpened(channelID)
+
+	cached := s.cache.LoadMessages(channelID)
+
+	if len(cached) > 0 || s.isOffline() {
+		if !s.isOffline() {
+			go s.syncMessages(channelID, cached[len(cached)-1].Timestamp, count)
+		}
+
+		messages, threads := s.createMessages(cached, channelID, count)
+		return messages, threads, nil
+	}
+
+	// https://godoc.org/github.com/nlopes/slack#GetConversationHistoryParameters
+	historyParams := slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Limit:     count,
+		Inclusive: false,
+	}
+
+	var history *slack.GetConversationHistoryResponse
+	err := s.scheduler.Do("conversations.history", PriorityInteractive, func() (err error) {
+		history, err = s.getConversationHistory(&historyParams)
+		return err
+	})
+	if err != nil {
+		return nil, nil, newError("loading messages", err)
+	}
+
+	s.cache.SetMessages(channelID, history.Messages, !history.HasMore)
+
+	messages, threads := s.createMessages(mergeMessages(nil, history.Messages), channelID, count)
+	return messages, threads, nil
+}
+
+// syncMessages will request the messages of a channel that are newer than
+// the timestamp oldest, which is the newest cached message. They're merged
+// into the cache, and when there are any the messages of the channel are
+// emitted with a HistoryEvent.
+func (s *SlackService) syncMessages(channelID string, oldest string, count int) {
+	// https://godoc.org/github.com/nlopes/slack#GetConversationHistoryParameters
+	historyParams := slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Limit:     count,
+		Inclusive: false,
+		Oldest:    oldest,
+	}
+
+	var history *slack.GetConversationHistoryResponse
+	err := s.scheduler.Do("conversations.history", PriorityInteractive, func() (err error) {
+		history, err = s.getConversationHistory(&historyParams)
+		return err
+	})
+	if err != nil {
+		s.events <- newErrorEvent(newError("loading messages", err))
+		return
+	}
+
+	if len(history.Messages) == 0 {
+		return
+	}
+
+	// When there are more messages than we've requested, the new messages
+	// don't connect to the cached ones, so we start over
+	s.cache.AddMessages(channelID, history.Messages, history.HasMore)
+
+	messages, threads := s.createMessages(s.cache.LoadMessages(channelID), channelID, count)
+
+	s.events <- newHistoryEvent(&HistoryEvent{
+		ChannelID: channelID,
+		Messages:  messages,
+		Threads:   threads,
+	})
+}
+
+// createMessages will create the messages of a channel, and the thread
+// identifiers (as ChannelItem), from the newest messages delimited by count.
+// The messages should be sorted from old to new.
+func (s *SlackService) createMessages(sorted []slack.Message, channelID string, count int) ([]components.Message, []components.ChannelItem) {
+	if len(sorted) > count {
+		sorted = sorted[len(sorted)-count:]
+	}
+
+	var messages []components.Message
+	var threads []components.ChannelItem
+	for _, message := range sorted {
+		msg := s.CreateMessage(message, channelID)
+		messages = append(messages, msg)
+
+		// FIXME: create boolean isThread
+		if msg.Thread != "" {
+			threads = append(threads, components.ChannelItem{
+				ID:          msg.ID,
+				Name:        msg.Thread,
+				Type:        components.ChannelTypeGroup,
+				StylePrefix: s.Config.Theme.Channel.Prefix,
+				StyleIcon:   s.Config.Theme.Channel.Icon,
+				StyleText:   s.Config.Theme.Channel.Text,
+			})
+		}
+	}
+
+	// The threads are listed from new to old
+	for i, j := 0, len(threads)-1; i < j; i, j = i+1, j-1 {
+		threads[i], threads[j] = threads[j], threads[i]
+	}
+
+	return messages, threads
+}
 
 // CreateMessageByID will construct an array of components.Message with only
 // 1 message, using the message ID (Timestamp).
@@ -469,366 +1135,1267 @@ func (s *SlackService) GetMessageByID(messageID string, channelID string) ([]com
 		Latest:    messageID,
 	}
 
-	history, err := s.Client.GetConversationHistory(&historyParams)
-	if err != nil {
-		return msgs, err
-	}
+	// When there is no connection, look for the message in the cache
+	if s.isOffline() {
+		for _, message := range s.cache.LoadMessages(channelID) {
+			if message.Timestamp == messageID {
+				msg, _ := s.createMessageWithReplies(message, channelID)
+				msgs = append(msgs, msg)
+				break
+			}
+		}
+		return msgs, nil
+	}
+
+	var history *slack.GetConversationHistoryResponse
+	err := s.scheduler.Do("conversations.history", PriorityInteractive, func() (err error) {
+		history, err = s.getConversationHistory(&historyParams)
+		return err
+	})
+	if err != nil {
+		return msgs, newError("loading thread", err)
+	}
+
+	// We break because we're only asking for 1 message
+	for _, message := range history.Messages {
+		msg, err := s.createMessageWithReplies(message, channelID)
+		if err != nil {
+			return msgs, newError("loading thread", err)
+		}
+
+		msgs = append(msgs, msg)
+		break
+	}
+
+	return msgs, nil
+}
+
+// createMessageWithReplies will create a message, and when it is the parent
+// of a thread, add the replies to it
+func (s *SlackService) createMessageWithReplies(message slack.Message, channelID string) (components.Message, error) {
+	msg := s.CreateMessage(message, channelID)
+
+	if message.ThreadTimestamp != "" && message.ThreadTimestamp == message.Timestamp {
+		replies, err := s.CreateMessageFromReplies(message.ThreadTimestamp, channelID)
+		if err != nil {
+			return msg, err
+		}
+
+		for _, reply := range replies {
+			msg.Messages[reply.ID] = reply
+		}
+	}
+
+	return msg, nil
+}
+
+// CreateMessage will create a string formatted message that can be rendered
+// in the Chat pane.
+//
+// [23:59] <erroneousboat> Hello world!
+func (s *SlackService) CreateMessage(message slack.Message, channelID string) components.Message {
+	var name string
+
+	// Get username from cache
+	name, ok := s.getUserName(message.User)
+
+	// Name not in cache, and we can't look it up without a connection
+	if !ok && s.isOffline() {
+		name = "unknown"
+	} else if !ok {
+		if message.BotID != "" {
+			name, ok = s.getUserName(message.BotID)
+			if !ok {
+				if message.Username != "" {
+					name = message.Username
+					s.setUserName(message.BotID, message.Username)
+				} else {
+					var bot *slack.Bot
+					err := s.scheduler.Do("bots.info", PriorityInteractive, func() (err error) {
+						bot, err = s.Client.GetBotInfo(message.BotID)
+						return err
+					})
+					if err != nil {
+						name = "unkown"
+						s.setUserName(message.BotID, name)
+					} else {
+						name = bot.Name
+						s.setUserName(message.BotID, bot.Name)
+					}
+				}
+			}
+		} else {
+			// Not a bot, not in cache, get user info
+			user, err := s.getUserInfo(message.User)
+			if err != nil {
+				name = "unknown"
+				s.setUserName(message.User, name)
+			} else {
+				name = user.Name
+				s.setUserName(message.User, user.Name)
+			}
+		}
+	}
+
+	if name == "" {
+		name = "unknown"
+	}
+
+	// Parse time
+	floatTime, err := strconv.ParseFloat(message.Timestamp, 64)
+	if err != nil {
+		floatTime = 0.0
+	}
+	intTime := int64(floatTime)
+
+	// Keep the message as it was decoded, so it can be inspected
+	raw, _ := json.Marshal(message)
+
+	// Format message
+	msg := components.Message{
+		ID:          message.Timestamp,
+		UserID:      message.User,
+		Messages:    make(map[string]components.Message),
+		Time:        time.Unix(intTime, 0),
+		Name:        name,
+		Content:     parseMessage(s, message.Text),
+		Text:        s.decodeMessage(message.Text),
+		StyleTime:   s.Config.Theme.Message.Time,
+		StyleThread: s.Config.Theme.Message.Thread,
+		StyleName:   s.Config.Theme.Message.Name,
+		StyleText:   s.Config.Theme.Message.Text,
+		FormatTime:  s.Config.Theme.Message.TimeFormat,
+		Raw:         raw,
+	}
+
+	for _, f := range message.Files {
+		msg.Files = append(msg.Files, createFile(f))
+	}
+
+	for _, r := range message.Reactions {
+		msg.Reactions = append(msg.Reactions, components.Reaction{
+			Name:  r.Name,
+			Count: r.Count,
+			Users: r.Users,
+		})
+	}
+
+	// When there are blocks, add them to Messages. The blocks are the body
+	// of the message, the text is only used for notifications. Except when
+	// there are only rich text blocks, these are the same as the text. When
+	// none of the blocks can be shown, the text is shown instead.
+	//
+	// NOTE: blocks are keyed by their index as well, prefixed by a '+' so
+	// they're sorted before the attachments and files.
+	if !onlyRichText(message.Blocks) || message.Text == "" {
+		if blocks := s.CreateMessageFromBlocks(message.Blocks); len(blocks) > 0 {
+			msg.Content = ""
+			for i, b := range blocks {
+				msg.Messages[fmt.Sprintf("+%03d", i)] = b
+			}
+		}
+	}
+
+	// When there are attachments, add them to Messages
+	//
+	// NOTE: attachments don't have an id or a timestamp that we can
+	// use as a key value for the Messages field, so we use the index
+	// of the returned array. It is padded, so the lines stay in order
+	// when they're sorted.
+	if len(message.Attachments) > 0 {
+		atts := s.CreateMessageFromAttachments(message.Attachments)
+
+		for i, a := range atts {
+			msg.Messages[fmt.Sprintf("%03d", i)] = a
+		}
+	}
+
+	// When there are files, add them to Messages
+	if len(message.Files) > 0 {
+		files := s.CreateMessageFromFiles(message.Files)
+		for i, file := range files {
+			msg.Messages[message.Files[i].ID] = file
+		}
+	}
+
+	// When the message timestamp and thread timestamp are the same, we
+	// have a parent message. This means it contains a thread with replies.
+	//
+	// Additionally, we set the thread timestamp in the s.ThreadCache with
+	// the base62 representation of the timestamp. We do this because
+	// we if we want to reply to a thread, we need to reference this
+	// timestamp. Which is too long to type, we shorten it and remember the
+	// reference in the cache.
+	//
+	// The replies aren't added here, they're loaded separately with
+	// GetReplies, otherwise we would make a request for every thread
+	// before we're able to show the messages of a channel.
+	if message.ThreadTimestamp != "" && message.ThreadTimestamp == message.Timestamp {
+
+		// Set the thread identifier for thread cache
+		f, _ := strconv.ParseFloat(message.ThreadTimestamp, 64)
+		threadID := hashID(int(f))
+
+		s.cacheMu.Lock()
+		s.ThreadCache[threadID] = message.ThreadTimestamp
+		s.replyCounts[message.ThreadTimestamp] = message.ReplyCount
+		s.cacheMu.Unlock()
+
+		// Set thread prefix for message
+		msg.Thread = fmt.Sprintf("%s ", threadID)
+	}
+
+	return msg
+}
+
+// GetReplies will get the replies of the thread with the timestamp threadID.
+// The cached replies are used when they are up to date with the reply count
+// of the parent message, otherwise they're requested from slack.
+func (s *SlackService) GetReplies(channelID string, threadID string) ([]components.Message, error) {
+	cached := s.cache.LoadReplies(channelID, threadID)
+	if s.isOffline() {
+		return s.createReplies(cached, channelID), nil
+	}
+
+	s.cacheMu.RLock()
+	replyCount, ok := s.replyCounts[threadID]
+	s.cacheMu.RUnlock()
+
+	if ok && len(cached) > 0 && countReplies(cached) == replyCount {
+		return s.createReplies(cached, channelID), nil
+	}
+
+	msgs, err := s.getReplies(channelID, threadID, PriorityBackground)
+	if err != nil {
+		return nil, newError("loading replies", err)
+	}
+
+	return s.createReplies(msgs, channelID), nil
+}
+
+// CreateMessageFromReplies will create components.Message struct from
+// the conversation replies from slack.
+//
+// Useful documentation:
+//
+// https://api.slack.com/docs/message-threading
+// https://api.slack.com/methods/conversations.replies
+// https://godoc.org/github.com/nlopes/slack#Client.GetConversationReplies
+// https://godoc.org/github.com/nlopes/slack#GetConversationRepliesParameters
+func (s *SlackService) CreateMessageFromReplies(messageID string, channelID string) ([]components.Message, error) {
+	// When there is no connection use the cached replies
+	if s.isOffline() {
+		return s.createReplies(s.cache.LoadReplies(channelID, messageID), channelID), nil
+	}
+
+	msgs, err := s.getReplies(channelID, messageID, PriorityInteractive)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createReplies(msgs, channelID), nil
+}
+
+// getReplies will request all the messages of a thread, including the parent,
+// and store them in the cache
+func (s *SlackService) getReplies(channelID string, messageID string, priority Priority) ([]slack.Message, error) {
+	msgs := make([]slack.Message, 0)
+
+	var initReplies []slack.Message
+	var initCur string
+	err := s.scheduler.Do("conversations.replies", priority, func() (err error) {
+		initReplies, _, initCur, err = s.getConversationReplies(
+			&slack.GetConversationRepliesParameters{
+				ChannelID: channelID,
+				Timestamp: messageID,
+				Limit:     200,
+			},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msgs = append(msgs, initReplies...)
+
+	nextCur := initCur
+	for nextCur != "" {
+		var conversationReplies []slack.Message
+		var cursor string
+		err := s.scheduler.Do("conversations.replies", priority, func() (err error) {
+			conversationReplies, _, cursor, err = s.getConversationReplies(&slack.GetConversationRepliesParameters{
+				ChannelID: channelID,
+				Timestamp: messageID,
+				Cursor:    nextCur,
+				Limit:     200,
+			})
+			return err
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		msgs = append(msgs, conversationReplies...)
+		nextCur = cursor
+	}
+
+	s.cache.SetReplies(channelID, messageID, msgs)
+
+	return msgs, nil
+}
+
+// createReplies will create components.Message structs from the messages of
+// a thread
+func (s *SlackService) createReplies(msgs []slack.Message, channelID string) []components.Message {
+	var replies []components.Message
+	for _, reply := range msgs {
+		// Because the conversations api returns an entire thread (a
+		// message plus all the messages in reply), we need to check if
+		// one of the replies isn't the parent that we started with.
+		//
+		// Keep in mind that the api returns the replies with the latest
+		// as the first element.
+		if reply.ThreadTimestamp != "" && reply.ThreadTimestamp == reply.Timestamp {
+			continue
+		}
+
+		msg := s.CreateMessage(reply, channelID)
+
+		// Set the thread separator
+		msg.Thread = "  "
+
+		replies = append(replies, msg)
+	}
+
+	return replies
+}
+
+// CreateMessageFromAttachments will construct an array of messages from the
+// Attachments of a Message, link unfurls are attachments as well. Every line
+// of an attachment is a message, they're shown as a block with a bar in the
+// color of the attachment:
+//
+//	pretext
+//	▌ author
+//	▌ *title* (title link)
+//	▌ text
+//	▌ *short field*  *short field*
+//	▌ value          value
+//	▌ [image]
+//	▌ footer | Jan 2 15:04
+func (s *SlackService) CreateMessageFromAttachments(atts []slack.Attachment) []components.Message {
+	var msgs []components.Message
+	for _, att := range atts {
+		bar := attachmentColor(att.Color)
+
+		add := func(content string, styleBar string, image *components.File) {
+			msgs = append(msgs, components.Message{
+				Content:     parseMessage(s, content),
+				Image:       image,
+				StyleTime:   s.Config.Theme.Message.Time,
+				StyleThread: s.Config.Theme.Message.Thread,
+				StyleName:   s.Config.Theme.Message.Name,
+				StyleText:   s.Config.Theme.Message.Text,
+				StyleBar:    styleBar,
+				FormatTime:  s.Config.Theme.Message.TimeFormat,
+			})
+		}
+
+		// The pretext is shown above the attachment
+		if att.Pretext != "" {
+			add(att.Pretext, "", nil)
+		}
+
+		if att.AuthorName != "" {
+			author := att.AuthorName
+			if att.AuthorSubname != "" {
+				author = fmt.Sprintf("%s %s", author, att.AuthorSubname)
+			}
+			add(author, bar, nil)
+		}
+
+		if att.Title != "" {
+			title := fmt.Sprintf("*%s*", att.Title)
+			if att.TitleLink != "" {
+				title = fmt.Sprintf("%s (%s)", title, att.TitleLink)
+			}
+			add(title, bar, nil)
+		}
+
+		if att.Text != "" {
+			add(att.Text, bar, nil)
+		}
+
+		// Short fields are shown two per row
+		var fields []string
+		var short []bool
+		for _, field := range att.Fields {
+			fields = append(fields, fmt.Sprintf("*%s*\n%s", field.Title, field.Value))
+			short = append(short, field.Short)
+		}
+		for _, line := range layoutFields(fields, short) {
+			add(line, bar, nil)
+		}
+
+		for _, b := range s.CreateMessageFromBlocks(att.Blocks) {
+			b.StyleBar = bar
+			msgs = append(msgs, b)
+		}
+
+		var actions []string
+		for _, action := range att.Actions {
+			actions = append(actions, fmt.Sprintf("[%s]", action.Text))
+		}
+		if len(actions) > 0 {
+			add(strings.Join(actions, " "), bar, nil)
+		}
+
+		// Images aren't hosted by slack, the thumbnail is shown when
+		// there is no image
+		if url := att.ImageURL; url != "" || att.ThumbURL != "" {
+			if url == "" {
+				url = att.ThumbURL
+			}
+			add(url, bar, &components.File{
+				ID:       url,
+				Name:     path.Base(url),
+				URL:      url,
+				Thumb:    att.ThumbURL,
+				External: true,
+			})
+		}
+
+		var footer []string
+		if att.Footer != "" {
+			footer = append(footer, att.Footer)
+		}
+		if ts, err := att.Ts.Float64(); err == nil && ts > 0 {
+			footer = append(footer, time.Unix(int64(ts), 0).Format(
+				"Jan 2 "+s.Config.Theme.Message.TimeFormat,
+			))
+		}
+		if len(footer) > 0 {
+			add(strings.Join(footer, " | "), bar, nil)
+		}
+	}
+
+	return msgs
+}
+
+// attachmentColor returns the style of the bar of an attachment, the color
+// of the attachment is one of good, warning and danger or a hex color. Hex
+// colors are shown in the closest of the 8 terminal colors.
+func attachmentColor(color string) string {
+	switch color {
+	case "good":
+		return "fg-green"
+	case "warning":
+		return "fg-yellow"
+	case "danger":
+		return "fg-red"
+	}
+
+	var r, g, b int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(color, "#"), "%02x%02x%02x", &r, &g, &b); err != nil {
+		return "fg-default"
+	}
+
+	colors := []struct {
+		name    string
+		r, g, b int
+	}{
+		{"black", 0, 0, 0},
+		{"red", 205, 0, 0},
+		{"green", 0, 205, 0},
+		{"yellow", 205, 205, 0},
+		{"blue", 0, 0, 238},
+		{"magenta", 205, 0, 205},
+		{"cyan", 0, 205, 205},
+		{"white", 229, 229, 229},
+	}
+
+	closest, min := "default", -1
+	for _, c := range colors {
+		d := (c.r-r)*(c.r-r) + (c.g-g)*(c.g-g) + (c.b-b)*(c.b-b)
+		if min < 0 || d < min {
+			closest, min = c.name, d
+		}
+	}
+
+	return "fg-" + closest
+}
+
+// layoutFields returns the lines of fields, two short fields that follow each
+// other are shown next to each other. The lines of the left field are padded
+// to the widest line of the left column.
+func layoutFields(fields []string, short []bool) []string {
+	type row struct {
+		left  []string
+		right []string
+	}
+
+	var rows []row
+	width := 0
+	for i := 0; i < len(fields); i++ {
+		r := row{left: strings.Split(fields[i], "\n")}
+		if short[i] && i+1 < len(fields) && short[i+1] {
+			r.right = strings.Split(fields[i+1], "\n")
+			for _, line := range r.left {
+				if w := textWidth(line); w > width {
+					width = w
+				}
+			}
+			i++
+		}
+		rows = append(rows, r)
+	}
+
+	var lines []string
+	for _, r := range rows {
+		for j := 0; j < len(r.left) || j < len(r.right); j++ {
+			var line string
+			if j < len(r.left) {
+				line = r.left[j]
+			}
+			if j < len(r.right) {
+				line += strings.Repeat(" ", width+2-textWidth(line)) + r.right[j]
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// CreateMessageFromBlocks will construct an array of messages from the
+// Block Kit blocks of a message, every line of a block is a message. Blocks
+// are shown as follows:
+//
+//	header        *Title*
+//	rich_text     the formatted text, lists and quotes
+//	section       text, then the fields two per row, and the accessory
+//	context       the texts and the alt texts of the images on one line
+//	divider       ────────
+//	image         [image: alt text], previewed like files
+//	actions       [Approve] [Reject]
+//
+// Header and rich text blocks are only shown when they've been decoded by
+// restoreBlocks, the slack library can't decode them.
+//
+// https://api.slack.com/reference/block-kit/blocks
+func (s *SlackService) CreateMessageFromBlocks(blocks slack.Blocks) []components.Message {
+	var msgs []components.Message
+
+	add := func(content string, image *components.File) {
+		msgs = append(msgs, components.Message{
+			Content:     parseMessage(s, content),
+			Image:       image,
+			StyleTime:   s.Config.Theme.Message.Time,
+			StyleThread: s.Config.Theme.Message.Thread,
+			StyleName:   s.Config.Theme.Message.Name,
+			StyleText:   s.Config.Theme.Message.Text,
+			FormatTime:  s.Config.Theme.Message.TimeFormat,
+		})
+	}
+
+	for _, block := range blocks.BlockSet {
+		switch b := block.(type) {
+		case *headerBlock:
+			if b.Text != nil && b.Text.Text != "" {
+				add("*"+escaper.Replace(b.Text.Text)+"*", nil)
+			}
+		case *richTextBlock:
+			if text := richTextToMrkdwn(b.Elements); text != "" {
+				add(text, nil)
+			}
+		case *slack.SectionBlock:
+			if b.Text != nil {
+				add(b.Text.Text, nil)
+			}
+
+			// Fields are shown two per row
+			var fields []string
+			var short []bool
+			for _, field := range b.Fields {
+				fields = append(fields, field.Text)
+				short = append(short, true)
+			}
+			for _, line := range layoutFields(fields, short) {
+				add(line, nil)
+			}
+
+			if b.Accessory != nil {
+				if label := accessoryLabel(b.Accessory); label != "" {
+					add(label, nil)
+				}
+			}
+		case *slack.ContextBlock:
+			var parts []string
+			for _, elem := range b.ContextElements.Elements {
+				switch e := elem.(type) {
+				case *slack.TextBlockObject:
+					parts = append(parts, e.Text)
+				case *slack.ImageBlockElement:
+					if e.AltText != "" {
+						parts = append(parts, fmt.Sprintf("[%s]", e.AltText))
+					}
+				}
+			}
+			add(strings.Join(parts, "  "), nil)
+		case *slack.DividerBlock:
+			add(strings.Repeat("─", 40), nil)
+		case *slack.ImageBlock:
+			if b.Title != nil && b.Title.Text != "" {
+				add(b.Title.Text, nil)
+			}
+			add(
+				fmt.Sprintf("[image: %s]", b.AltText),
+				&components.File{
+					ID:       b.ImageURL,
+					Name:     path.Base(b.ImageURL),
+					URL:      b.ImageURL,
+					External: true,
+				},
+			)
+		case *slack.ActionBlock:
+			var labels []string
+			for _, elem := range b.Elements.ElementSet {
+				if label := elementLabel(elem); label != "" {
+					labels = append(labels, label)
+				}
+			}
+			add(strings.Join(labels, " "), nil)
+		case *slack.FileBlock:
+			add(fmt.Sprintf("[file: %s]", b.ExternalID), nil)
+		case *slack.InputBlock:
+			if b.Label != nil {
+				add(b.Label.Text, nil)
+			}
+		}
+	}
+
+	return msgs
+}
+
+// textWidth returns the width of a line of mrkdwn when it is shown, without
+// the markers of the formatting
+func textWidth(line string) int {
+	return runewidth.StringWidth(mrkdwnMarkers.Replace(line))
+}
+
+var mrkdwnMarkers = strings.NewReplacer("*", "", "_", "", "~", "", "`", "")
+
+// accessoryLabel returns the label of the element that is shown next to the
+// text of a section
+func accessoryLabel(a *slack.Accessory) string {
+	switch {
+	case a.ButtonElement != nil:
+		return elementLabel(a.ButtonElement)
+	case a.ImageElement != nil:
+		return elementLabel(a.ImageElement)
+	case a.OverflowElement != nil:
+		return elementLabel(a.OverflowElement)
+	case a.DatePickerElement != nil:
+		return elementLabel(a.DatePickerElement)
+	case a.SelectElement != nil:
+		return elementLabel(a.SelectElement)
+	case a.MultiSelectElement != nil:
+		return elementLabel(a.MultiSelectElement)
+	case a.RadioButtonsElement != nil:
+		return elementLabel(a.RadioButtonsElement)
+	}
+	return ""
+}
+
+// elementLabel returns the label of an interactive element, they can't be
+// used in slack-term so they're shown as labels
+func elementLabel(elem slack.BlockElement) string {
+	text := func(t *slack.TextBlockObject) string {
+		if t == nil {
+			return ""
+		}
+		return t.Text
+	}
+
+	switch e := elem.(type) {
+	case *slack.ButtonBlockElement:
+		return fmt.Sprintf("[%s]", text(e.Text))
+	case *slack.ImageBlockElement:
+		return fmt.Sprintf("[image: %s]", e.AltText)
+	case *slack.OverflowBlockElement:
+		return "[…]"
+	case *slack.DatePickerBlockElement:
+		if e.InitialDate != "" {
+			return fmt.Sprintf("[%s ▾]", e.InitialDate)
+		}
+		return fmt.Sprintf("[%s ▾]", text(e.Placeholder))
+	case *slack.SelectBlockElement:
+		if e.InitialOption != nil {
+			return fmt.Sprintf("[%s ▾]", text(e.InitialOption.Text))
+		}
+		return fmt.Sprintf("[%s ▾]", text(e.Placeholder))
+	case *slack.MultiSelectBlockElement:
+		return fmt.Sprintf("[%s ▾]", text(e.Placeholder))
+	case *slack.RadioButtonsBlockElement:
+		var options []string
+		for _, o := range e.Options {
+			mark := "( )"
+			if e.InitialOption != nil && e.InitialOption.Value == o.Value {
+				mark = "(•)"
+			}
+			options = append(options, fmt.Sprintf("%s %s", mark, text(o.Text)))
+		}
+		return strings.Join(options, " ")
+	case *slack.PlainTextInputBlockElement:
+		return fmt.Sprintf("[%s]", text(e.Placeholder))
+	}
+	return ""
+}
+
+// CreateMessageFromFiles will create components.Message struct from
+// conversation attached files
+func (s *SlackService) CreateMessageFromFiles(files []slack.File) []components.Message {
+	var msgs []components.Message
+
+	for _, file := range files {
+		msg := components.Message{
+			Content: fmt.Sprintf(
+				"%s %s", file.Title, file.URLPrivate,
+			),
+			StyleTime:   s.Config.Theme.Message.Time,
+			StyleThread: s.Config.Theme.Message.Thread,
+			StyleName:   s.Config.Theme.Message.Name,
+			StyleText:   s.Config.Theme.Message.Text,
+			FormatTime:  s.Config.Theme.Message.TimeFormat,
+		}
+
+		// Images are previewed under the title
+		if f := createFile(file); f.IsImage() {
+			msg.Image = &f
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs
+}
+
+// createFile will create a components.File struct from a file that is shared
+// in a message
+func createFile(f slack.File) components.File {
+	url := f.URLPrivateDownload
+	if url == "" {
+		url = f.URLPrivate
+	}
+
+	thumb := f.Thumb360
+	if thumb == "" {
+		thumb = f.Thumb160
+	}
+
+	return components.File{
+		ID:       f.ID,
+		Name:     f.Name,
+		Title:    f.Title,
+		Mimetype: f.Mimetype,
+		Filetype: f.Filetype,
+		Size:     f.Size,
+		URL:      url,
+		Thumb:    thumb,
+	}
+}
+
+// CreateMessageFromMessageEvent will create a components.Message struct
+// from a message event that is received from the Transport
+func (s *SlackService) CreateMessageFromMessageEvent(message *slack.MessageEvent, channelID string) (components.Message, error) {
+	msg := slack.Message{Msg: message.Msg}
+
+	switch message.SubType {
+	case "message_changed":
+		// The edited message replaces the message that has the same
+		// timestamp
+		msg = slack.Message{Msg: *message.SubMessage}
+	case "message_replied":
+		return components.Message{}, errors.New("ignoring reply events")
+	case "message_deleted":
+		return components.Message{}, errors.New("ignoring delete events")
+	}
+
+	return s.CreateMessage(msg, channelID), nil
+}
+
+// GetUserNames returns the handles of the users in the UserCache, mapped to
+// their display names, these are used to complete mentions
+func (s *SlackService) GetUserNames() map[string]string {
+	s.cacheMu.RLock()
+	defer s.cacheMu.RUnlock()
+
+	names := make(map[string]string, len(s.UserCache))
+	for userID, name := range s.UserCache {
+		if name == "" {
+			continue
+		}
+
+		var displayName string
+		if profile := s.profileNames[userID]; len(profile) > 0 {
+			displayName = profile[0]
+			if displayName == "" {
+				displayName = profile[1]
+			}
+		}
+		names[name] = displayName
+	}
+
+	return names
+}
+
+// GetInputHistory returns the messages the user has sent from the cache
+func (s *SlackService) GetInputHistory() map[string][]string {
+	return s.cache.LoadInputHistory()
+}
+
+// SaveInputHistory stores the messages the user has sent in the cache
+func (s *SlackService) SaveInputHistory(history map[string][]string) error {
+	return s.cache.SaveInputHistory(history)
+}
+
+// GetDrafts returns the messages that haven't been sent yet from the cache
+func (s *SlackService) GetDrafts() map[string]components.Draft {
+	return s.cache.LoadDrafts()
+}
+
+// SaveDrafts stores the messages that haven't been sent yet in the cache
+func (s *SlackService) SaveDrafts(drafts map[string]components.Draft) error {
+	return s.cache.SaveDrafts(drafts)
+}
+
+// Close writes the changes to the histories of the channels, which are
+// kept in memory for a while, to the cache
+func (s *SlackService) Close() error {
+	return s.cache.Flush()
+}
 
-	// We break because we're only asking for 1 message
-	for _, message := range history.Messages {
-		msgs = append(msgs, s.CreateMessage(message, channelID))
-		break
-	}
+// GetCurrentUserID returns the id of the user associated with the token
+func (s *SlackService) GetCurrentUserID() string {
+	return s.CurrentUserID
+}
 
-	return msgs, nil
+// Events returns the channel on which the events of the Transport,
+// translated to service events, are emitted
+func (s *SlackService) Events() <-chan Event {
+	return s.events
 }
 
-// CreateMessage will create a string formatted message that can be rendered
-// in the Chat pane.
-//
-// [23:59] <erroneousboat> Hello world!
-func (s *SlackService) CreateMessage(message slack.Message, channelID string) components.Message {
-	var name string
+// handleIncomingEvents will translate the events that are received from the
+// Transport into events that the user interface can handle
+func (s *SlackService) handleIncomingEvents() {
+	for rtmEvent := range s.Transport.IncomingEvents() {
+		switch ev := rtmEvent.Data.(type) {
+		case *slack.ConnectingEvent:
+			s.events <- newConnectionEvent(&ConnectionEvent{
+				State:   ConnectionStateConnecting,
+				Attempt: ev.Attempt,
+			})
+		case *slack.ConnectedEvent:
+			s.setOffline(false)
+			s.events <- newConnectionEvent(&ConnectionEvent{
+				State: ConnectionStateConnected,
+			})
 
-	// Get username from cache
-	name, ok := s.UserCache[message.User]
+			// When we've been connected before, get the messages
+			// that we've missed in the meantime
+			if since, ok := s.startResync(); ok {
+				go s.resync(since)
+			}
+		case *slack.DisconnectedEvent:
+			if !ev.Intentional {
+				s.setOffline(true)
+			}
+			s.events <- newConnectionEvent(&ConnectionEvent{
+				State: ConnectionStateDisconnected,
+				Err:   ev.Cause,
+			})
+		case *slack.ConnectionErrorEvent:
+			s.events <- newConnectionEvent(&ConnectionEvent{
+				State:   ConnectionStateDisconnected,
+				Attempt: ev.Attempt,
+				Err:     ev,
+			})
+		case *slack.LatencyReport:
+			s.events <- newLatencyEvent(&LatencyEvent{
+				Latency: ev.Value,
+			})
+		case *slack.MessageEvent:
+			s.setLastSeen(ev.Timestamp)
 
-	// Name not in cache
-	if !ok {
-		if message.BotID != "" {
-			name, ok = s.UserCache[message.BotID]
-			if !ok {
-				if message.Username != "" {
-					name = message.Username
-					s.UserCache[message.BotID] = message.Username
-				} else {
-					bot, err := s.Client.GetBotInfo(message.BotID)
-					if err != nil {
-						name = "unkown"
-						s.UserCache[message.BotID] = name
-					} else {
-						name = bot.Name
-						s.UserCache[message.BotID] = bot.Name
-					}
+			// Edits of messages that we've already cached are stored,
+			// new messages are picked up by GetMessages
+			if ev.SubType == "message_changed" && ev.SubMessage != nil {
+				s.cache.UpdateMessage(ev.Channel, slack.Message{Msg: *ev.SubMessage})
+			}
+
+			// When a reply is posted we receive the parent with the
+			// updated reply count, the cached replies of the thread
+			// are then no longer up to date
+			if ev.SubType == "message_replied" && ev.SubMessage != nil {
+				s.cacheMu.Lock()
+				s.replyCounts[ev.SubMessage.Timestamp] = ev.SubMessage.ReplyCount
+				s.cacheMu.Unlock()
+
+				s.cache.UpdateMessage(ev.Channel, slack.Message{Msg: *ev.SubMessage})
+			}
+
+			// Deleted messages don't have content, only the timestamp
+			// of the message, and the message itself as it was before
+			if ev.SubType == "message_deleted" {
+				var threadID string
+				if ev.PreviousMessage != nil {
+					threadID = ev.PreviousMessage.ThreadTimestamp
 				}
+
+				s.cache.DeleteMessage(ev.Channel, threadID, ev.DeletedTimestamp)
+				s.events <- newDeleteEvent(&DeleteEvent{
+					ChannelID: ev.Channel,
+					ThreadID:  threadID,
+					MessageID: ev.DeletedTimestamp,
+				})
+				continue
 			}
-		} else {
-			// Not a bot, not in cache, get user info
-			user, err := s.Client.GetUserInfo(message.User)
+
+			msg, err := s.CreateMessageFromMessageEvent(ev, ev.Channel)
 			if err != nil {
-				name = "unknown"
-				s.UserCache[message.User] = name
-			} else {
-				name = user.Name
-				s.UserCache[message.User] = user.Name
+				continue
 			}
-		}
-	}
-
-	if name == "" {
-		name = "unknown"
-	}
 
-	// Parse time
-	floatTime, err := strconv.ParseFloat(message.Timestamp, 64)
-	if err != nil {
-		floatTime = 0.0
-	}
-	intTime := int64(floatTime)
+			// Get the thread timestamp of the event, we need to check the
+			// previous message as well, because edited message don't have
+			// the thread timestamp
+			var threadTimestamp string
+			if ev.ThreadTimestamp != "" {
+				threadTimestamp = ev.ThreadTimestamp
+			} else if ev.PreviousMessage != nil && ev.PreviousMessage.ThreadTimestamp != "" {
+				threadTimestamp = ev.PreviousMessage.ThreadTimestamp
+			}
 
-	// Format message
-	msg := components.Message{
-		ID:          message.Timestamp,
-		Messages:    make(map[string]components.Message),
-		Time:        time.Unix(intTime, 0),
-		Name:        name,
-		Content:     parseMessage(s, message.Text),
-		StyleTime:   s.Config.Theme.Message.Time,
-		StyleThread: s.Config.Theme.Message.Thread,
-		StyleName:   s.Config.Theme.Message.Name,
-		StyleText:   s.Config.Theme.Message.Text,
-		FormatTime:  s.Config.Theme.Message.TimeFormat,
-	}
+			// Edited messages are sent by slack, the user and the
+			// text are those of the message that has been changed
+			if ev.SubType == "message_changed" {
+				s.events <- newMessageEvent(&MessageEvent{
+					ChannelID: ev.Channel,
+					UserID:    msg.UserID,
+					Text:      ev.SubMessage.Text,
+					ThreadID:  threadTimestamp,
+					Message:   msg,
+					Edited:    true,
+				})
+				continue
+			}
 
-	// When there are attachments, add them to Messages
-	//
-	// NOTE: attachments don't have an id or a timestamp that we can
-	// use as a key value for the Messages field, so we use the index
-	// of the returned array.
-	if len(message.Attachments) > 0 {
-		atts := s.CreateMessageFromAttachments(message.Attachments)
+			s.events <- newMessageEvent(&MessageEvent{
+				ChannelID: ev.Channel,
+				UserID:    ev.User,
+				Text:      ev.Text,
+				ThreadID:  threadTimestamp,
+				Message:   msg,
+			})
+		case *slack.PresenceChangeEvent:
+			channelID, ok := s.getIMChannelID(ev.User)
+			if !ok {
+				continue
+			}
 
-		for i, a := range atts {
-			msg.Messages[strconv.Itoa(i)] = a
+			s.events <- newPresenceEvent(&PresenceEvent{
+				ChannelID: channelID,
+				UserID:    ev.User,
+				Presence:  ev.Presence,
+			})
+		case *slack.ChannelMarkedEvent:
+			s.events <- newReadStateEvent(&ReadStateEvent{
+				ChannelID: ev.Channel,
+				Timestamp: ev.Timestamp,
+			})
+		case *slack.GroupMarkedEvent:
+			s.events <- newReadStateEvent(&ReadStateEvent{
+				ChannelID: ev.Channel,
+				Timestamp: ev.Timestamp,
+			})
+		case *slack.IMMarkedEvent:
+			s.events <- newReadStateEvent(&ReadStateEvent{
+				ChannelID: ev.Channel,
+				Timestamp: ev.Timestamp,
+			})
+		case *slack.ReactionAddedEvent:
+			s.cache.UpdateReaction(ev.Item.Channel, ev.Item.Timestamp, ev.Reaction, ev.User, true)
+			s.events <- newReactionEvent(&ReactionEvent{
+				ChannelID: ev.Item.Channel,
+				MessageID: ev.Item.Timestamp,
+				UserID:    ev.User,
+				Reaction:  ev.Reaction,
+				Added:     true,
+			})
+		case *slack.ReactionRemovedEvent:
+			s.cache.UpdateReaction(ev.Item.Channel, ev.Item.Timestamp, ev.Reaction, ev.User, false)
+			s.events <- newReactionEvent(&ReactionEvent{
+				ChannelID: ev.Item.Channel,
+				MessageID: ev.Item.Timestamp,
+				UserID:    ev.User,
+				Reaction:  ev.Reaction,
+				Added:     false,
+			})
+		case *slack.RTMError:
+			s.events <- newErrorEvent(ev)
 		}
 	}
+}
 
-	// When there are files, add them to Messages
-	if len(message.Files) > 0 {
-		files := s.CreateMessageFromFiles(message.Files)
-		for _, file := range files {
-			msg.Messages[file.ID] = file
-		}
+// startResync returns the timestamp from which the messages that were
+// missed while we were disconnected should be requested. It returns false
+// when we haven't been connected before, the current time is then used as
+// the timestamp for the next time.
+func (s *SlackService) startResync() (string, bool) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	if s.lastSeen == "" {
+		now := time.Now()
+		s.lastSeen = fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+		return "", false
 	}
 
-	// When the message timestamp and thread timestamp are the same, we
-	// have a parent message. This means it contains a thread with replies.
-	//
-	// Additionally, we set the thread timestamp in the s.ThreadCache with
-	// the base62 representation of the timestamp. We do this because
-	// we if we want to reply to a thread, we need to reference this
-	// timestamp. Which is too long to type, we shorten it and remember the
-	// reference in the cache.
-	if message.ThreadTimestamp != "" && message.ThreadTimestamp == message.Timestamp {
+	// A resync that was interrupted, or that failed for some of the
+	// conversations, is started again from where it started
+	since := s.lastSeen
+	if s.unsynced != "" && compareTimestamps(s.unsynced, since) < 0 {
+		since = s.unsynced
+	}
+	s.unsynced = since
 
-		// Set the thread identifier for thread cache
-		f, _ := strconv.ParseFloat(message.ThreadTimestamp, 64)
-		threadID := hashID(int(f))
-		s.ThreadCache[threadID] = message.ThreadTimestamp
+	return since, true
+}
 
-		// Set thread prefix for message
-		msg.Thread = fmt.Sprintf("%s ", threadID)
+// setLastSeen will set the timestamp of the newest message that has been
+// received, when ts is newer
+func (s *SlackService) setLastSeen(ts string) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
 
-		// Create the message replies from the thread
-		replies := s.CreateMessageFromReplies(message.ThreadTimestamp, channelID)
-		for _, reply := range replies {
-			msg.Messages[reply.ID] = reply
-		}
+	if compareTimestamps(ts, s.lastSeen) > 0 {
+		s.lastSeen = ts
 	}
+}
 
-	return msg
+// setOpened will make the conversation with channelID the one that has
+// been opened most recently
+func (s *SlackService) setOpened(channelID string) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	for i, id := range s.opened {
+		if id == channelID {
+			s.opened = append(s.opened[:i], s.opened[i+1:]...)
+			break
+		}
+	}
+	s.opened = append(s.opened, channelID)
 }
 
-// CreateMessageFromReplies will create components.Message struct from
-// the conversation replies from slack.
-//
-// Useful documentation:
-//
-// https://api.slack.com/docs/message-threading
-// https://api.slack.com/methods/conversations.replies
-// https://godoc.org/github.com/nlopes/slack#Client.GetConversationReplies
-// https://godoc.org/github.com/nlopes/slack#GetConversationRepliesParameters
-func (s *SlackService) CreateMessageFromReplies(messageID string, channelID string) []components.Message {
-	msgs := make([]slack.Message, 0)
+// getResyncOrder returns the conversations in the order they're caught up
+// after reconnecting: the conversations that have been opened, the most
+// recent first, then the unread conversations and the direct messages, and
+// then the rest.
+func (s *SlackService) getResyncOrder() []slack.Channel {
+	s.syncMu.Lock()
+	opened := make(map[string]int)
+	for i, id := range s.opened {
+		opened[id] = len(s.opened) - i
+	}
+	s.syncMu.Unlock()
 
-	initReplies, _, initCur, err := s.Client.GetConversationReplies(
-		&slack.GetConversationRepliesParameters{
-			ChannelID: channelID,
-			Timestamp: messageID,
-			Limit:     200,
-		},
-	)
-	if err != nil {
-		log.Fatal(err) // FIXME
+	rank := func(chn slack.Channel) int {
+		if n, ok := opened[chn.ID]; ok {
+			return n
+		}
+		if chn.UnreadCount > 0 || chn.IsIM || chn.IsMpIM {
+			return len(opened) + 1
+		}
+		return len(opened) + 2
 	}
 
-	msgs = append(msgs, initReplies...)
+	chans := append([]slack.Channel{}, s.getConversationList()...)
+	sort.SliceStable(chans, func(i, j int) bool {
+		return rank(chans[i]) < rank(chans[j])
+	})
 
-	nextCur := initCur
-	for nextCur != "" {
-		conversationReplies, _, cursor, err := s.Client.GetConversationReplies(&slack.GetConversationRepliesParameters{
-			ChannelID: channelID,
-			Timestamp: messageID,
-			Cursor:    nextCur,
-			Limit:     200,
-		})
+	return chans
+}
 
-		if err != nil {
-			log.Fatal(err) // FIXME
+// resync will request the messages that were posted in the conversations of
+// the current user since the timestamp since, they are emitted as missed
+// message events. We're only looking for the top level messages, replies
+// will be loaded with their threads. Conversations that fail are skipped,
+// they're tried again after the next reconnect.
+func (s *SlackService) resync(since string) {
+	var failed int
+	var lastErr error
+	newest := since
+
+	for _, chn := range s.getResyncOrder() {
+		// When the connection drops again the next resync will
+		// start over
+		if s.isOffline() {
+			return
 		}
 
-		msgs = append(msgs, conversationReplies...)
-		nextCur = cursor
-	}
-
-	var replies []components.Message
-	for _, reply := range msgs {
-		// Because the conversations api returns an entire thread (a
-		// message plus all the messages in reply), we need to check if
-		// one of the replies isn't the parent that we started with.
-		//
-		// Keep in mind that the api returns the replies with the latest
-		// as the first element.
-		if reply.ThreadTimestamp != "" && reply.ThreadTimestamp == reply.Timestamp {
+		messages, err := s.getMissedMessages(chn.ID, since)
+		if err != nil {
+			failed++
+			lastErr = err
 			continue
 		}
 
-		msg := s.CreateMessage(reply, channelID)
+		// Messages are returned from new to old
+		for i := len(messages) - 1; i >= 0; i-- {
+			message := messages[i]
+			if compareTimestamps(message.Timestamp, newest) > 0 {
+				newest = message.Timestamp
+			}
 
-		// Set the thread separator
-		msg.Thread = "  "
+			s.events <- newMessageEvent(&MessageEvent{
+				ChannelID: chn.ID,
+				UserID:    message.User,
+				Text:      message.Text,
+				Message:   s.CreateMessage(message, chn.ID),
+				Missed:    true,
+			})
+		}
+	}
 
-		replies = append(replies, msg)
+	if failed > 0 {
+		s.events <- newErrorEvent(newError(
+			fmt.Sprintf("loading missed messages of %d conversations", failed), lastErr,
+		))
+		return
 	}
 
-	return replies
+	// Every conversation has caught up, the messages we've found don't
+	// have to be requested again
+	s.syncMu.Lock()
+	if s.unsynced == since {
+		s.unsynced = ""
+	}
+	s.syncMu.Unlock()
+
+	s.setLastSeen(newest)
 }
 
-// CreateMessageFromAttachments will construct an array of strings from the
-// Field values of Attachments of a Message.
-func (s *SlackService) CreateMessageFromAttachments(atts []slack.Attachment) []components.Message {
-	var msgs []components.Message
-	for _, att := range atts {
-		for _, field := range att.Fields {
-			msgs = append(msgs, components.Message{
-				Content: fmt.Sprintf(
-					"%s %s",
-					field.Title,
-					field.Value,
-				),
-				StyleTime:   s.Config.Theme.Message.Time,
-				StyleThread: s.Config.Theme.Message.Thread,
-				StyleName:   s.Config.Theme.Message.Name,
-				StyleText:   s.Config.Theme.Message.Text,
-				FormatTime:  s.Config.Theme.Message.TimeFormat,
-			},
-			)
-		}
+// getConversationList returns the Conversations that are listed
+func (s *SlackService) getConversationList() []slack.Channel {
+	s.cacheMu.RLock()
+	defer s.cacheMu.RUnlock()
 
-		if att.Pretext != "" {
-			msgs = append(
-				msgs,
-				components.Message{
-					Content:     fmt.Sprintf("%s", att.Pretext),
-					StyleTime:   s.Config.Theme.Message.Time,
-					StyleThread: s.Config.Theme.Message.Thread,
-					StyleName:   s.Config.Theme.Message.Name,
-					StyleText:   s.Config.Theme.Message.Text,
-					FormatTime:  s.Config.Theme.Message.TimeFormat,
-				},
-			)
-		}
+	return s.Conversations
+}
 
-		if att.Text != "" {
-			msgs = append(
-				msgs,
-				components.Message{
-					Content:     fmt.Sprintf("%s", att.Text),
-					StyleTime:   s.Config.Theme.Message.Time,
-					StyleThread: s.Config.Theme.Message.Thread,
-					StyleName:   s.Config.Theme.Message.Name,
-					StyleText:   s.Config.Theme.Message.Text,
-					FormatTime:  s.Config.Theme.Message.TimeFormat,
+// getMissedMessages returns the messages of a channel that are newer than
+// since, from new to old. Every page is requested, so we won't miss the
+// older messages when many have been posted.
+func (s *SlackService) getMissedMessages(channelID string, since string) ([]slack.Message, error) {
+	var messages []slack.Message
+	var cursor string
+	for {
+		var history *slack.GetConversationHistoryResponse
+		err := s.scheduler.Do("conversations.history", PriorityBackground, func() (err error) {
+			history, err = s.getConversationHistory(
+				&slack.GetConversationHistoryParameters{
+					ChannelID: channelID,
+					Oldest:    since,
+					Limit:     100,
+					Cursor:    cursor,
 				},
 			)
+			return err
+		})
+		if err != nil {
+			return nil, err
 		}
 
-		if att.Title != "" {
-			msgs = append(
-				msgs,
-				components.Message{
-					Content:     fmt.Sprintf("%s", att.Title),
-					StyleTime:   s.Config.Theme.Message.Time,
-					StyleThread: s.Config.Theme.Message.Thread,
-					StyleName:   s.Config.Theme.Message.Name,
-					StyleText:   s.Config.Theme.Message.Text,
-					FormatTime:  s.Config.Theme.Message.TimeFormat,
-				},
-			)
+		messages = append(messages, history.Messages...)
+
+		cursor = history.ResponseMetaData.NextCursor
+		if !history.HasMore || cursor == "" {
+			return messages, nil
 		}
 	}
+}
 
-	return msgs
+// getUserName returns the name of a user, or bot, from the UserCache
+func (s *SlackService) getUserName(userID string) (string, bool) {
+	s.cacheMu.RLock()
+	defer s.cacheMu.RUnlock()
+
+	name, ok := s.UserCache[userID]
+	return name, ok
 }
 
-// CreateMessageFromFiles will create components.Message struct from
-// conversation attached files
-func (s *SlackService) CreateMessageFromFiles(files []slack.File) []components.Message {
-	var msgs []components.Message
+// setUserName stores the name of a user, or bot, in the UserCache
+func (s *SlackService) setUserName(userID string, name string) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
 
-	for _, file := range files {
-		msgs = append(msgs, components.Message{
-			Content: fmt.Sprintf(
-				"%s %s", file.Title, file.URLPrivate,
-			),
-			StyleTime:   s.Config.Theme.Message.Time,
-			StyleThread: s.Config.Theme.Message.Thread,
-			StyleName:   s.Config.Theme.Message.Name,
-			StyleText:   s.Config.Theme.Message.Text,
-			FormatTime:  s.Config.Theme.Message.TimeFormat,
-		})
+	s.UserCache[userID] = name
+}
 
-	}
+// getUserInfo will get the information of a user by its id
+func (s *SlackService) getUserInfo(userID string) (*slack.User, error) {
+	var user *slack.User
+	err := s.scheduler.Do("users.info", PriorityInteractive, func() (err error) {
+		user, err = s.Client.GetUserInfo(userID)
+		return err
+	})
+	return user, err
+}
 
-	return msgs
+// isOffline returns true when there is no connection with slack
+func (s *SlackService) isOffline() bool {
+	s.offlineMu.RLock()
+	defer s.offlineMu.RUnlock()
+	return s.offline
 }
 
-func (s *SlackService) CreateMessageFromMessageEvent(message *slack.MessageEvent, channelID string) (components.Message, error) {
-	msg := slack.Message{Msg: message.Msg}
+func (s *SlackService) setOffline(offline bool) {
+	s.offlineMu.Lock()
+	defer s.offlineMu.Unlock()
+	s.offline = offline
+}
 
-	switch message.SubType {
-	case "message_changed":
-		// Append (edited) when an edited message is received
-		msg = slack.Message{Msg: *message.SubMessage}
-		msg.Text = fmt.Sprintf("%s (edited)", msg.Text)
-	case "message_replied":
-		return components.Message{}, errors.New("ignoring reply events")
+// getIMChannelID returns the id of the im channel with the user
+func (s *SlackService) getIMChannelID(userID string) (string, bool) {
+	for _, chn := range s.getConversationList() {
+		if chn.IsIM && chn.User == userID {
+			return chn.ID, true
+		}
 	}
-
-	return s.CreateMessage(msg, channelID), nil
+	return "", false
 }
 
 // parseMessage will parse a message string and find and replace:
-//	- emoji's
-//	- mentions
-//	- html unescape
+//   - emoji's
+//   - mentions, channels, links and dates
+//   - html unescape
 func parseMessage(s *SlackService, msg string) string {
 	if s.Config.Emoji {
 		msg = parseEmoji(msg)
 	}
 
-	msg = parseMentions(s, msg)
+	msg = parseTokens(s, msg)
 
 	msg = html.UnescapeString(msg)
 
 	return msg
 }
 
-// parseMentions will try to find mention placeholders in the message
-// string and replace them with the correct username with and @ symbol
-//
-// Mentions have the following format:
-//	<@U12345|erroneousboat>
-// 	<@U12345>
-func parseMentions(s *SlackService, msg string) string {
-	r := regexp.MustCompile(`\<@(\w+\|*\w+)\>`)
-
-	return r.ReplaceAllStringFunc(
-		msg, func(str string) string {
-			rs := r.FindStringSubmatch(str)
-			if len(rs) < 1 {
-				return str
-			}
-
-			var userID string
-			split := strings.Split(rs[1], "|")
-			if len(split) > 0 {
-				userID = split[0]
-			} else {
-				userID = rs[1]
-			}
-
-			name, ok := s.UserCache[userID]
-			if !ok {
-				user, err := s.Client.GetUserInfo(userID)
-				if err != nil {
-					name = "unknown"
-					s.UserCache[userID] = name
-				} else {
-					name = user.Name
-					s.UserCache[userID] = user.Name
-				}
-			}
-
-			if name == "" {
-				name = "unknown"
-			}
-
-			return "@" + name
-		},
-	)
-}
-
 // parseEmoji will try to find emoji placeholders in the message
 // string and replace them with the correct unicode equivalent
 func parseEmoji(msg string) string {
@@ -857,6 +2424,14 @@ func (s *SlackService) createChannelItem(chn slack.Channel) components.ChannelIt
 	}
 }
 
+// getAPIURL returns the url of the slack api that is used by the client
+func (s *SlackService) getAPIURL() string {
+	if s.Config.APIURL != "" {
+		return s.Config.APIURL
+	}
+	return slack.APIURL
+}
+
 func hashID(input int) string {
 	const base62Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
 
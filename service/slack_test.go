@@ -0,0 +1,807 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/erroneousboat/slack-term/config"
+	"github.com/erroneousboat/slack-term/service/fakeslack"
+)
+
+var (
+	testSelf = slack.User{ID: "U00000001", Name: "alice"}
+	testBob  = slack.User{
+		ID:   "U00000002",
+		Name: "bob",
+		Profile: slack.UserProfile{
+			DisplayName: "Bobby",
+			RealName:    "Bob Builder",
+		},
+	}
+)
+
+// newTestConfig returns the config of a workspace at apiURL, the cache and
+// the downloads are stored in the directory dir
+func newTestConfig(t *testing.T, dir string, apiURL string) *config.Config {
+	path := filepath.Join(dir, "config")
+	data := fmt.Sprintf(
+		`{"slack_token": "xoxp-test", "api_url": %q, "cache_dir": %q, "download_dir": %q}`,
+		apiURL, filepath.Join(dir, "cache"), filepath.Join(dir, "downloads"),
+	)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.NewConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+// newTestService starts a fake slack server with the users alice and bob,
+// the channel #general and an im channel with bob. It returns a
+// SlackService for alice that is connected to it, and a function that
+// stops the server and removes the cache.
+func newTestService(t *testing.T) (*SlackService, *fakeslack.Server, func()) {
+	dir, err := ioutil.TempDir("", "slack-term-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := fakeslack.NewServer(testSelf)
+	done := func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+
+	server.AddUser(testBob, "active")
+
+	general := slack.Channel{IsChannel: true, IsMember: true}
+	general.ID = "C00000001"
+	general.Name = "general"
+	server.AddChannel(general)
+
+	im := slack.Channel{}
+	im.ID = "D00000001"
+	im.IsIM = true
+	im.User = testBob.ID
+	server.AddChannel(im)
+
+	svc, err := NewSlackService(newTestConfig(t, dir, server.APIURL()))
+	if err != nil {
+		done()
+		t.Fatal(err)
+	}
+
+	if _, err := svc.GetChannels(); err != nil {
+		done()
+		t.Fatal(err)
+	}
+
+	if !server.WaitForConnection(5 * time.Second) {
+		done()
+		t.Fatal("the service didn't connect to the server")
+	}
+
+	// The service has handled the connection when it says so
+	waitForEvent(t, svc, func(ev Event) bool {
+		conn, ok := ev.Data.(*ConnectionEvent)
+		return ok && conn.State == ConnectionStateConnected
+	})
+
+	return svc, server, done
+}
+
+// waitForEvent returns the first event of svc for which match returns true,
+// the other events are skipped
+func waitForEvent(t *testing.T, svc Service, match func(Event) bool) Event {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-svc.Events():
+			if match(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for an event")
+			return Event{}
+		}
+	}
+}
+
+func TestSlackServiceGetChannels(t *testing.T) {
+	svc, _, done := newTestService(t)
+	defer done()
+
+	chans, err := svc.GetChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chans) != 2 {
+		t.Fatalf("got %d channels, want 2", len(chans))
+	}
+	if chans[0].ID != "C00000001" || chans[0].Name != "general" {
+		t.Errorf("first channel is %s %s, want #general", chans[0].ID, chans[0].Name)
+	}
+	if chans[1].ID != "D00000001" || chans[1].Name != "bob" {
+		t.Errorf("second channel is %s %s, want the im with bob", chans[1].ID, chans[1].Name)
+	}
+}
+
+func TestSlackServiceGetMessages(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "first"}})
+	parent := server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testSelf.ID, Text: "second"}})
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "reply", ThreadTimestamp: parent}})
+
+	msgs, threads, err := svc.GetMessages("C00000001", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	if msgs[0].Content != "first" || msgs[0].Name != "bob" {
+		t.Errorf("first message is <%s> %s, want <bob> first", msgs[0].Name, msgs[0].Content)
+	}
+	if msgs[1].Content != "second" || msgs[1].Name != "alice" {
+		t.Errorf("second message is <%s> %s, want <alice> second", msgs[1].Name, msgs[1].Content)
+	}
+
+	if len(threads) != 1 || threads[0].ID != parent {
+		t.Fatalf("got threads %v, want the thread of %s", threads, parent)
+	}
+
+	replies, err := svc.GetReplies("C00000001", parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0].Content != "reply" {
+		t.Errorf("got replies %v, want the reply of bob", replies)
+	}
+}
+
+func TestSlackServiceGetMessagesCached(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "first"}})
+	if _, _, err := svc.GetMessages("C00000001", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached messages are returned right away, the new message is
+	// synced in the background
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "second"}})
+
+	msgs, _, err := svc.GetMessages("C00000001", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Content != "first" {
+		t.Fatalf("got %d messages, want the cached message", len(msgs))
+	}
+
+	ev := waitForEvent(t, svc, func(ev Event) bool {
+		_, ok := ev.Data.(*HistoryEvent)
+		return ok
+	})
+	history := ev.Data.(*HistoryEvent)
+	if history.ChannelID != "C00000001" || len(history.Messages) != 2 ||
+		history.Messages[1].Content != "second" {
+		t.Errorf("got %d messages in %s, want the new message", len(history.Messages), history.ChannelID)
+	}
+
+	if cached := svc.cache.LoadMessages("C00000001"); len(cached) != 2 {
+		t.Errorf("got %d cached messages, want 2", len(cached))
+	}
+}
+
+func TestSlackServiceCachedStart(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	random := slack.Channel{IsChannel: true, IsMember: true}
+	random.ID = "C00000002"
+	random.Name = "random"
+	server.AddChannel(random)
+
+	// The next session starts with the cached users and channels
+	next, err := NewSlackService(svc.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := next.getUserName(testBob.ID); !ok || name != "bob" {
+		t.Errorf("got user %q, want the cached bob", name)
+	}
+
+	chans, err := next.GetChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chans) != 2 {
+		t.Errorf("got %d channels, want the 2 cached channels", len(chans))
+	}
+
+	// The refreshed channels follow
+	ev := waitForEvent(t, next, func(ev Event) bool {
+		_, ok := ev.Data.(*ChannelsEvent)
+		return ok
+	})
+	if chans := ev.Data.(*ChannelsEvent).Channels; len(chans) != 3 {
+		t.Errorf("got %d refreshed channels, want 3", len(chans))
+	}
+}
+
+func TestSlackServiceSendMessage(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	if err := svc.SendMessage("C00000001", "hello @bob & <everyone>"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := server.GetMessages("C00000001")
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+
+	want := "hello <@U00000002> &amp; &lt;everyone&gt;"
+	if msgs[0].Text != want {
+		t.Errorf("sent %q, want %q", msgs[0].Text, want)
+	}
+
+	// The message is echoed by slack
+	ev := waitForEvent(t, svc, func(ev Event) bool {
+		_, ok := ev.Data.(*MessageEvent)
+		return ok
+	})
+	msg := ev.Data.(*MessageEvent)
+	if msg.ChannelID != "C00000001" || msg.UserID != testSelf.ID {
+		t.Errorf("got message of %s in %s, want the message of alice", msg.UserID, msg.ChannelID)
+	}
+}
+
+func TestSlackServiceSendReply(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	parent := server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "question"}})
+
+	if err := svc.SendReply("C00000001", parent, "answer"); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := waitForEvent(t, svc, func(ev Event) bool {
+		_, ok := ev.Data.(*MessageEvent)
+		return ok
+	})
+	msg := ev.Data.(*MessageEvent)
+	if msg.ThreadID != parent || msg.Text != "answer" {
+		t.Errorf("got %q in thread %q, want the answer in thread %s", msg.Text, msg.ThreadID, parent)
+	}
+
+	replies, err := svc.GetReplies("C00000001", parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0].Content != "answer" {
+		t.Errorf("got replies %v, want the answer", replies)
+	}
+}
+
+func TestSlackServiceIncomingMessage(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	ts := server.SendMessage("C00000001", "", testBob.ID, "hi <@U00000001>")
+
+	ev := waitForEvent(t, svc, func(ev Event) bool {
+		_, ok := ev.Data.(*MessageEvent)
+		return ok
+	})
+	msg := ev.Data.(*MessageEvent)
+
+	if msg.ChannelID != "C00000001" || msg.UserID != testBob.ID || msg.Message.ID != ts {
+		t.Errorf("got message %s of %s in %s, want message %s of bob", msg.Message.ID, msg.UserID, msg.ChannelID, ts)
+	}
+
+	// The raw text is used to find mentions for the notifications, the
+	// message is shown with the name of the user
+	if !strings.Contains(msg.Text, "<@U00000001>") {
+		t.Errorf("text %q doesn't contain the mention", msg.Text)
+	}
+	if msg.Message.Content != "hi @alice" {
+		t.Errorf("content is %q, want %q", msg.Message.Content, "hi @alice")
+	}
+}
+
+func TestSlackServiceIncomingReply(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	parent := server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testSelf.ID, Text: "question"}})
+	server.SendMessage("C00000001", parent, testBob.ID, "answer")
+
+	ev := waitForEvent(t, svc, func(ev Event) bool {
+		_, ok := ev.Data.(*MessageEvent)
+		return ok
+	})
+	msg := ev.Data.(*MessageEvent)
+
+	if msg.ThreadID != parent {
+		t.Errorf("got thread %q, want %s", msg.ThreadID, parent)
+	}
+}
+
+func TestSlackServicePresence(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	server.SendPresenceChange(testBob.ID, "away")
+
+	ev := waitForEvent(t, svc, func(ev Event) bool {
+		_, ok := ev.Data.(*PresenceEvent)
+		return ok
+	})
+	presence := ev.Data.(*PresenceEvent)
+
+	if presence.ChannelID != "D00000001" || presence.Presence != "away" {
+		t.Errorf("got presence %s of %s, want bob away in D00000001", presence.Presence, presence.ChannelID)
+	}
+}
+
+func TestSlackServiceSendCommand(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	isCmd, err := svc.SendCommand("C00000001", "/remind me tomorrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isCmd {
+		t.Fatal("the command wasn't recognized")
+	}
+
+	cmds := server.GetCommands()
+	if len(cmds) != 1 || cmds[0].Command != "/remind" || cmds[0].Text != "me tomorrow" {
+		t.Errorf("got commands %v, want /remind me tomorrow", cmds)
+	}
+
+	isCmd, err = svc.SendCommand("C00000001", "not a command")
+	if err != nil || isCmd {
+		t.Errorf("a message was sent as a command")
+	}
+}
+
+func TestSlackServiceUserGroups(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	// The user groups are loaded when the service starts
+	server.AddUserGroup(slack.UserGroup{ID: "S00000001", Handle: "ops"})
+	next, err := NewSlackService(svc.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The messages of several threads are created at the same time, while
+	// the user groups are being loaded
+	var wg sync.WaitGroup
+	handles := make([]string, 5)
+	for i := range handles {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			handles[i] = next.formatUserGroup("S00000001", "@team")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, handle := range handles {
+		if handle != "ops" {
+			t.Errorf("got %q, want ops", handle)
+		}
+	}
+}
+
+func TestSlackServiceRateLimited(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "first"}})
+	server.SetRateLimited("conversations.history", 1)
+
+	msgs, _, err := svc.GetMessages("C00000001", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Errorf("got %d messages, want 1", len(msgs))
+	}
+}
+
+func TestSlackServiceEditMessage(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	text := "see <https://example.com|the docs> &amp; ask <@U00000002>"
+	ts := server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testSelf.ID, Text: text}})
+
+	msgs, _, err := svc.GetMessages("C00000001", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The message is edited as it was typed, the link is kept as it is
+	want := "see <https://example.com|the docs> & ask @bob"
+	if len(msgs) != 1 || msgs[0].Text != want {
+		t.Fatalf("got messages %v, want the text %q", msgs, want)
+	}
+
+	if err := svc.EditMessage("C00000001", ts, msgs[0].Text+" @bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := server.GetMessages("C00000001")[0].Text
+	if edited != text+" <@U00000002>" {
+		t.Errorf("edited to %q, want %q", edited, text+" <@U00000002>")
+	}
+}
+
+func TestSlackServiceBlocks(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	header := &headerBlock{
+		Type: "header",
+		Text: slack.NewTextBlockObject("plain_text", "Incident", false, false),
+	}
+	richText := &richTextBlock{
+		Type: "rich_text",
+		Elements: []richTextElement{
+			{Type: "rich_text_section", Elements: []richTextElement{
+				{Type: "text", Text: "see "},
+				{Type: "link", URL: "https://example.com", Text: "the docs"},
+			}},
+		},
+	}
+
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{
+		User:   testBob.ID,
+		Text:   "fallback",
+		Blocks: slack.Blocks{BlockSet: []slack.Block{header, richText}},
+	}})
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{
+		User:   testBob.ID,
+		Text:   "only rich text",
+		Blocks: slack.Blocks{BlockSet: []slack.Block{richText}},
+	}})
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{
+		User:   testBob.ID,
+		Text:   "nothing to show",
+		Blocks: slack.Blocks{BlockSet: []slack.Block{&slack.UnknownBlock{Type: "unknown"}}},
+	}})
+
+	msgs, _, err := svc.GetMessages("C00000001", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want 3", len(msgs))
+	}
+
+	blocks := msgs[0].Messages
+	if msgs[0].Content != "" || blocks["+000"].Content != "*Incident*" ||
+		blocks["+001"].Content != "see the docs (https://example.com)" {
+		t.Errorf("got %q with blocks %q and %q, want the header and the rich text",
+			msgs[0].Content, blocks["+000"].Content, blocks["+001"].Content)
+	}
+
+	if msgs[1].Content != "only rich text" || len(msgs[1].Messages) != 0 {
+		t.Errorf("got %q with %d blocks, want only the text", msgs[1].Content, len(msgs[1].Messages))
+	}
+
+	if msgs[2].Content != "nothing to show" {
+		t.Errorf("got %q, want the text when no block is shown", msgs[2].Content)
+	}
+
+	// The blocks are decoded from the cache as well
+	if err := svc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cached := NewCache(svc.cache.dir).LoadMessages("C00000001")
+	if len(cached) != 3 {
+		t.Fatalf("got %d cached messages, want 3", len(cached))
+	}
+	if _, ok := cached[0].Blocks.BlockSet[0].(*headerBlock); !ok {
+		t.Errorf("cached block is %T, want a header", cached[0].Blocks.BlockSet[0])
+	}
+}
+
+func TestRichTextToMrkdwn(t *testing.T) {
+	bold := json.RawMessage(`{"bold": true}`)
+	ordered := json.RawMessage(`"ordered"`)
+
+	elements := []richTextElement{
+		{Type: "rich_text_section", Elements: []richTextElement{
+			{Type: "text", Text: "hi ", Style: bold},
+			{Type: "user", UserID: "U1"},
+			{Type: "text", Text: " a<b\n"},
+		}},
+		{Type: "rich_text_list", Style: ordered, Elements: []richTextElement{
+			{Type: "rich_text_section", Elements: []richTextElement{{Type: "text", Text: "one"}}},
+			{Type: "rich_text_section", Elements: []richTextElement{{Type: "emoji", Name: "tada"}}},
+		}},
+		{Type: "rich_text_quote", Elements: []richTextElement{{Type: "text", Text: "said"}}},
+		{Type: "rich_text_preformatted", Elements: []richTextElement{{Type: "text", Text: "code"}}},
+	}
+
+	want := "*hi *<@U1> a&lt;b\n1. one\n2. :tada:\n&gt; said\n```code```"
+	if got := richTextToMrkdwn(elements); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSlackServiceResync(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	seen := server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "seen"}})
+	server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "missed in general"}})
+	server.AddMessage("D00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "missed in im"}})
+
+	// A conversation that fails doesn't stop the others from catching up
+	missing := slack.Channel{}
+	missing.ID = "C00000009"
+	svc.cacheMu.Lock()
+	svc.Conversations = append([]slack.Channel{missing}, svc.Conversations...)
+	svc.cacheMu.Unlock()
+
+	// The conversation that has been opened is caught up first
+	svc.setOpened("D00000001")
+
+	// The last message that was received before disconnecting
+	svc.syncMu.Lock()
+	svc.lastSeen = seen
+	svc.syncMu.Unlock()
+
+	since, ok := svc.startResync()
+	if !ok || since != seen {
+		t.Fatalf("got resync from %q, want %q", since, seen)
+	}
+	go svc.resync(since)
+
+	var missed []string
+	waitForEvent(t, svc, func(ev Event) bool {
+		if msg, ok := ev.Data.(*MessageEvent); ok && msg.Missed {
+			missed = append(missed, msg.Text)
+		}
+		_, ok := ev.Data.(*ErrorEvent)
+		return ok
+	})
+
+	if len(missed) != 2 || missed[0] != "missed in im" || missed[1] != "missed in general" {
+		t.Errorf("got missed messages %v, want the im first and then general", missed)
+	}
+
+	// The failed conversation is tried again from the same timestamp
+	svc.setLastSeen(server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "live"}}))
+	if since, ok = svc.startResync(); !ok || since != seen {
+		t.Errorf("got resync from %q, want %q", since, seen)
+	}
+}
+
+func TestSlackServiceDownloadFile(t *testing.T) {
+	svc, _, done := newTestService(t)
+	defer done()
+
+	dir, err := ioutil.TempDir("", "slack-term-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two files with the same name and size
+	for _, content := range []string{"first", "other"} {
+		path := filepath.Join(dir, content, "image.png")
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		err := svc.UploadFile("C00000001", "", path, "", func(int64, int64) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, _, err := svc.GetMessages("C00000001", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+
+	for i, want := range []string{"first", "other"} {
+		path, err := svc.DownloadFile(msgs[i].Files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("downloaded %q from %s, want %q", data, path, want)
+		}
+	}
+}
+
+func TestSlackServiceResyncPages(t *testing.T) {
+	svc, server, done := newTestService(t)
+	defer done()
+
+	seen := server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: "seen"}})
+
+	// More messages than fit on one page
+	for i := 0; i < 250; i++ {
+		server.AddMessage("C00000001", slack.Message{Msg: slack.Msg{User: testBob.ID, Text: fmt.Sprint(i)}})
+	}
+
+	svc.syncMu.Lock()
+	svc.lastSeen = seen
+	svc.syncMu.Unlock()
+
+	since, ok := svc.startResync()
+	if !ok {
+		t.Fatal("no resync was started")
+	}
+	go svc.resync(since)
+
+	var missed []string
+	waitForEvent(t, svc, func(ev Event) bool {
+		if msg, ok := ev.Data.(*MessageEvent); ok && msg.Missed {
+			missed = append(missed, msg.Text)
+		}
+		return len(missed) == 250
+	})
+
+	if missed[0] != "0" || missed[249] != "249" {
+		t.Errorf("got missed messages from %s to %s, want 0 to 249", missed[0], missed[249])
+	}
+}
+
+func TestLayoutFields(t *testing.T) {
+	tests := []struct {
+		fields []string
+		short  []bool
+		want   []string
+	}{
+		{
+			[]string{"*Priority*\nHigh", "*Status*\nOpen"},
+			[]bool{true, true},
+			[]string{"*Priority*  *Status*", "High      Open"},
+		},
+		{
+			[]string{"*Description*\nA long text", "*Status*\nOpen"},
+			[]bool{false, true},
+			[]string{"*Description*", "A long text", "*Status*", "Open"},
+		},
+		{
+			[]string{"*A*\n1", "*B*\n2", "*Owner*\nbob"},
+			[]bool{true, true, true},
+			[]string{"*A*  *B*", "1  2", "*Owner*", "bob"},
+		},
+		{
+			[]string{"*Status*\nOpen\nsince Monday", "*Owner*\nbob"},
+			[]bool{true, true},
+			[]string{"*Status*        *Owner*", "Open          bob", "since Monday"},
+		},
+		{nil, nil, nil},
+	}
+
+	for _, test := range tests {
+		got := layoutFields(test.fields, test.short)
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("layoutFields(%q) = %q, want %q", test.fields, got, test.want)
+		}
+	}
+}
+
+func TestAttachmentColor(t *testing.T) {
+	tests := []struct {
+		color string
+		want  string
+	}{
+		{"good", "fg-green"},
+		{"warning", "fg-yellow"},
+		{"danger", "fg-red"},
+		{"#ff0000", "fg-red"},
+		{"00cc00", "fg-green"},
+		{"#439FE0", "fg-cyan"},
+		{"#111111", "fg-black"},
+		{"", "fg-default"},
+		{"purple", "fg-default"},
+	}
+
+	for _, test := range tests {
+		if got := attachmentColor(test.color); got != test.want {
+			t.Errorf("attachmentColor(%q) = %q, want %q", test.color, got, test.want)
+		}
+	}
+}
+
+func TestCreateMessageFromAttachments(t *testing.T) {
+	s := newTestFormatService()
+	s.Config = &config.Config{}
+	s.Config.Theme.Message.TimeFormat = "15:04"
+	s.setOffline(true)
+
+	ts := time.Date(2020, time.January, 2, 15, 4, 0, 0, time.Local)
+
+	msgs := s.CreateMessageFromAttachments([]slack.Attachment{{
+		Color:      "danger",
+		Pretext:    "New incident",
+		AuthorName: "pagerbot",
+		Title:      "Database down",
+		TitleLink:  "https://status.example.com",
+		Text:       "paged <@U1>",
+		Fields: []slack.AttachmentField{
+			{Title: "Priority", Value: "P1", Short: true},
+			{Title: "Status", Value: "Open", Short: true},
+		},
+		ImageURL: "https://example.com/graph.png",
+		Footer:   "pagerbot",
+		Ts:       json.Number(fmt.Sprint(ts.Unix())),
+	}})
+
+	want := []struct {
+		content string
+		bar     string
+		image   bool
+	}{
+		{"New incident", "", false},
+		{"pagerbot", "fg-red", false},
+		{"*Database down* (https://status.example.com)", "fg-red", false},
+		{"paged @bob", "fg-red", false},
+		{"*Priority*  *Status*", "fg-red", false},
+		{"P1        Open", "fg-red", false},
+		{"https://example.com/graph.png", "fg-red", true},
+		{"pagerbot | Jan 2 15:04", "fg-red", false},
+	}
+
+	if len(msgs) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(msgs), len(want))
+	}
+	for i, w := range want {
+		if msgs[i].Content != w.content || msgs[i].StyleBar != w.bar || (msgs[i].Image != nil) != w.image {
+			t.Errorf(
+				"line %d: got %q with bar %q and image %v, want %q with bar %q and image %v",
+				i, msgs[i].Content, msgs[i].StyleBar, msgs[i].Image != nil, w.content, w.bar, w.image,
+			)
+		}
+	}
+	if img := msgs[6].Image; img != nil && (!img.External || img.Name != "graph.png") {
+		t.Errorf("got image %+v, want the external graph.png", img)
+	}
+}
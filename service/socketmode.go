@@ -0,0 +1,332 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+)
+
+const (
+	socketModePingInterval = 30 * time.Second
+	socketModeReadTimeout  = 2 * socketModePingInterval
+	socketModeMaxBackoff   = 5 * time.Minute
+)
+
+// socketModeTransport is the Transport that uses Socket Mode, the events of
+// the Events API are received over a websocket that is opened with an
+// app-level token, see: https://api.slack.com/apis/connections/socket
+//
+// NOTE: the Events API doesn't deliver presence and read-state events, those
+// are only available over the RTM connection.
+type socketModeTransport struct {
+	appToken   string
+	apiURL     string
+	httpClient *http.Client
+
+	events chan slack.RTMEvent
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+	done chan struct{}
+}
+
+// socketModeEnvelope is the definition of a message that is received over
+// the Socket Mode websocket
+type socketModeEnvelope struct {
+	EnvelopeID string `json:"envelope_id"`
+	Type       string `json:"type"`
+	Reason     string `json:"reason"`
+	Payload    struct {
+		Event json.RawMessage `json:"event"`
+	} `json:"payload"`
+}
+
+// socketModeAck is send back for every envelope that has been received
+type socketModeAck struct {
+	EnvelopeID string `json:"envelope_id"`
+}
+
+func newSocketModeTransport(appToken string, apiURL string) *socketModeTransport {
+	return &socketModeTransport{
+		appToken:   appToken,
+		apiURL:     apiURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		events:     make(chan slack.RTMEvent, 50),
+		done:       make(chan struct{}),
+	}
+}
+
+// ManageConnection implements Transport, it mirrors the behaviour of
+// slack.RTM.ManageConnection and emits the same connection events.
+func (t *socketModeTransport) ManageConnection() {
+	var connectionCount int
+	for {
+		conn, err := t.connectWithBackoff(connectionCount)
+		if err != nil {
+			return
+		}
+
+		connectionCount++
+		t.events <- slack.RTMEvent{
+			Type: "connected",
+			Data: &slack.ConnectedEvent{ConnectionCount: connectionCount},
+		}
+
+		err = t.handleConnection(conn)
+
+		select {
+		case <-t.done:
+			t.events <- slack.RTMEvent{
+				Type: "disconnected",
+				Data: &slack.DisconnectedEvent{Intentional: true, Cause: err},
+			}
+			return
+		default:
+			t.events <- slack.RTMEvent{
+				Type: "disconnected",
+				Data: &slack.DisconnectedEvent{Intentional: false, Cause: err},
+			}
+		}
+	}
+}
+
+// IncomingEvents implements Transport
+func (t *socketModeTransport) IncomingEvents() <-chan slack.RTMEvent {
+	return t.events
+}
+
+// Disconnect implements Transport
+func (t *socketModeTransport) Disconnect() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return errors.New("socket mode connection already closed")
+	default:
+		close(t.done)
+	}
+
+	if t.conn != nil {
+		return t.conn.Close()
+	}
+
+	return nil
+}
+
+// connectWithBackoff will try to connect until it succeeds, the time
+// between the attempts is increased exponentially. It only returns an
+// error when Disconnect has been called.
+func (t *socketModeTransport) connectWithBackoff(connectionCount int) (*websocket.Conn, error) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		t.events <- slack.RTMEvent{
+			Type: "connecting",
+			Data: &slack.ConnectingEvent{
+				Attempt:         attempt,
+				ConnectionCount: connectionCount,
+			},
+		}
+
+		conn, err := t.connect()
+		if err == nil {
+			return conn, nil
+		}
+
+		t.events <- slack.RTMEvent{
+			Type: "connection_error",
+			Data: &slack.ConnectionErrorEvent{
+				Attempt:  attempt,
+				Backoff:  backoff,
+				ErrorObj: err,
+			},
+		}
+
+		select {
+		case <-t.done:
+			return nil, errors.New("socket mode connection closed")
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > socketModeMaxBackoff {
+			backoff = socketModeMaxBackoff
+		}
+	}
+}
+
+// connect will request a websocket url with `apps.connections.open` and dial
+// it, see: https://api.slack.com/methods/apps.connections.open
+func (t *socketModeTransport) connect() (*websocket.Conn, error) {
+	req, err := http.NewRequest("POST", t.apiURL+"apps.connections.open", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.appToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("apps.connections.open: %s", resp.Status)
+	}
+
+	var open struct {
+		slack.SlackResponse
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&open); err != nil {
+		return nil, err
+	}
+	if err := open.Err(); err != nil {
+		return nil, err
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(open.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.conn = conn
+	t.mu.Unlock()
+
+	// Disconnect could have been called while we were dialing
+	select {
+	case <-t.done:
+		conn.Close()
+		return nil, errors.New("socket mode connection closed")
+	default:
+	}
+
+	return conn, nil
+}
+
+// handleConnection will read from the websocket until the connection is
+// closed, or slack asks us to reconnect.
+func (t *socketModeTransport) handleConnection(conn *websocket.Conn) error {
+	defer conn.Close()
+
+	// We use websocket pings to measure the latency of the connection, the
+	// payload of the ping contains the time it was sent.
+	conn.SetPongHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(socketModeReadTimeout))
+
+		sent, err := strconv.ParseInt(appData, 10, 64)
+		if err == nil {
+			t.events <- slack.RTMEvent{
+				Type: "latency_report",
+				Data: &slack.LatencyReport{
+					Value: time.Since(time.Unix(0, sent)),
+				},
+			}
+		}
+		return nil
+	})
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go t.ping(conn, stopPing)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(socketModeReadTimeout))
+
+		var envelope socketModeEnvelope
+		if err := conn.ReadJSON(&envelope); err != nil {
+			return err
+		}
+
+		// Every envelope needs to be acknowledged, otherwise slack will
+		// send it again
+		if envelope.EnvelopeID != "" {
+			err := conn.WriteJSON(socketModeAck{EnvelopeID: envelope.EnvelopeID})
+			if err != nil {
+				return err
+			}
+		}
+
+		switch envelope.Type {
+		case "hello":
+			t.events <- slack.RTMEvent{Type: "hello", Data: &slack.HelloEvent{}}
+		case "disconnect":
+			return fmt.Errorf("disconnect requested: %s", envelope.Reason)
+		case "events_api":
+			t.handleEvent(envelope.Payload.Event)
+		}
+	}
+}
+
+// ping will send a websocket ping on every interval, until stop is closed
+func (t *socketModeTransport) ping(conn *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(socketModePingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			payload := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+			deadline := time.Now().Add(socketModePingInterval)
+			if err := conn.WriteControl(websocket.PingMessage, payload, deadline); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleEvent will unmarshal an event of the Events API into the struct
+// that the RTM connection uses for the same event type, by using
+// slack.EventMapping.
+func (t *socketModeTransport) handleEvent(raw json.RawMessage) {
+	var event slack.Event
+	if err := json.Unmarshal(raw, &event); err != nil {
+		t.events <- slack.RTMEvent{
+			Type: "unmarshalling_error",
+			Data: &slack.UnmarshallingErrorEvent{ErrorObj: err},
+		}
+		return
+	}
+
+	v, ok := slack.EventMapping[event.Type]
+	if !ok {
+		return
+	}
+
+	data := reflect.New(reflect.TypeOf(v)).Interface()
+	if err := json.Unmarshal(raw, data); err != nil {
+		t.events <- slack.RTMEvent{
+			Type: "unmarshalling_error",
+			Data: &slack.UnmarshallingErrorEvent{ErrorObj: err},
+		}
+		return
+	}
+
+	// The header and rich text blocks of messages are decoded by us
+	if msg, ok := data.(*slack.MessageEvent); ok {
+		var rawMsg struct {
+			rawMessage
+			Message *rawMessage `json:"message"`
+		}
+		if json.Unmarshal(raw, &rawMsg) == nil {
+			restoreMessage(&msg.Msg, rawMsg.rawMessage)
+			if msg.SubMessage != nil && rawMsg.Message != nil {
+				restoreMessage(msg.SubMessage, *rawMsg.Message)
+			}
+		}
+	}
+
+	t.events <- slack.RTMEvent{Type: event.Type, Data: data}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/erroneousboat/slack-term/components"
+	"github.com/erroneousboat/slack-term/config"
+	"github.com/erroneousboat/slack-term/service/fakeslack"
+)
+
+// newTestSocketMode starts a fake slack server and a Socket Mode transport
+// that manages its connection to it. It returns a function that disconnects
+// the transport and stops the server.
+func newTestSocketMode(t *testing.T) (*socketModeTransport, *fakeslack.Server, func()) {
+	server := fakeslack.NewServer(testSelf)
+
+	transport := newSocketModeTransport("xapp-test", server.APIURL())
+	go transport.ManageConnection()
+
+	done := func() {
+		transport.Disconnect()
+		server.Close()
+	}
+
+	return transport, server, done
+}
+
+// waitForRTMEvent returns the first event of transport with type typ, the
+// other events are skipped
+func waitForRTMEvent(t *testing.T, transport Transport, typ string) slack.RTMEvent {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-transport.IncomingEvents():
+			if ev.Type == typ {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for a %s event", typ)
+			return slack.RTMEvent{}
+		}
+	}
+}
+
+func TestSocketModeHello(t *testing.T) {
+	transport, _, done := newTestSocketMode(t)
+	defer done()
+
+	ev := waitForRTMEvent(t, transport, "connected")
+	if conn := ev.Data.(*slack.ConnectedEvent); conn.ConnectionCount != 1 {
+		t.Errorf("got connection count %d, want 1", conn.ConnectionCount)
+	}
+
+	ev = waitForRTMEvent(t, transport, "hello")
+	if _, ok := ev.Data.(*slack.HelloEvent); !ok {
+		t.Errorf("got %T, want a hello event", ev.Data)
+	}
+}
+
+func TestSocketModeAppToken(t *testing.T) {
+	server := fakeslack.NewServer(testSelf)
+	defer server.Close()
+
+	// A bot token can't open a Socket Mode connection
+	transport := newSocketModeTransport("xoxb-test", server.APIURL())
+	if _, err := transport.connect(); err == nil {
+		t.Error("connected with a bot token")
+	}
+}
+
+func TestSocketModeMessage(t *testing.T) {
+	transport, server, done := newTestSocketMode(t)
+	defer done()
+
+	waitForRTMEvent(t, transport, "hello")
+
+	ts := server.SendMessage("C00000001", "", testBob.ID, "hello *there*")
+
+	ev := waitForRTMEvent(t, transport, "message")
+	msg, ok := ev.Data.(*slack.MessageEvent)
+	if !ok {
+		t.Fatalf("got %T, want a message event", ev.Data)
+	}
+	if msg.Channel != "C00000001" || msg.User != testBob.ID || msg.Text != "hello *there*" || msg.Timestamp != ts {
+		t.Errorf("got message %+v, want the message of bob in C00000001", msg.Msg)
+	}
+}
+
+func TestSocketModeAck(t *testing.T) {
+	transport, server, done := newTestSocketMode(t)
+	defer done()
+
+	waitForRTMEvent(t, transport, "hello")
+
+	server.SendMessage("C00000001", "", testBob.ID, "one")
+	server.SendMessage("C00000001", "", testBob.ID, "two")
+	waitForRTMEvent(t, transport, "message")
+	waitForRTMEvent(t, transport, "message")
+
+	// The ack is written before the event is emitted, but the server
+	// reads it on its own goroutine
+	var acks []string
+	for i := 0; i < 50; i++ {
+		if acks = server.GetAcks(); len(acks) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := fmt.Sprint(acks); got != "[envelope-1 envelope-2]" {
+		t.Errorf("got acks %s, want [envelope-1 envelope-2]", got)
+	}
+}
+
+func TestSocketModeReconnect(t *testing.T) {
+	transport, server, done := newTestSocketMode(t)
+	defer done()
+
+	waitForRTMEvent(t, transport, "hello")
+
+	// Slack asks us to reconnect before it refreshes the connection
+	server.SendDisconnect("refresh_requested")
+
+	ev := waitForRTMEvent(t, transport, "disconnected")
+	if disc := ev.Data.(*slack.DisconnectedEvent); disc.Intentional {
+		t.Error("got an intentional disconnect, want a reconnect")
+	}
+
+	ev = waitForRTMEvent(t, transport, "connected")
+	if conn := ev.Data.(*slack.ConnectedEvent); conn.ConnectionCount != 2 {
+		t.Errorf("got connection count %d, want 2", conn.ConnectionCount)
+	}
+	waitForRTMEvent(t, transport, "hello")
+
+	// Events keep arriving on the new connection
+	server.SendMessage("C00000001", "", testBob.ID, "still there?")
+	waitForRTMEvent(t, transport, "message")
+
+	// After Disconnect the transport doesn't reconnect
+	transport.Disconnect()
+
+	ev = waitForRTMEvent(t, transport, "disconnected")
+	if disc := ev.Data.(*slack.DisconnectedEvent); !disc.Intentional {
+		t.Error("got an unintentional disconnect after Disconnect")
+	}
+}
+
+func TestSlackServiceSocketModePresence(t *testing.T) {
+	svc, _, done := newTestService(t)
+	defer done()
+
+	// Socket Mode doesn't deliver presence events, so the im channels
+	// don't get a presence
+	cfg := *svc.Config
+	cfg.Transport = config.TransportSocketMode
+	cfg.AppToken = "xapp-test"
+
+	next, err := NewSlackService(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+
+	chans, err := next.GetChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ims := 0
+	for _, chn := range chans {
+		if chn.Type == components.ChannelTypeIM {
+			ims++
+			if chn.Presence != "" {
+				t.Errorf("got presence %q for %s, want none", chn.Presence, chn.Name)
+			}
+		}
+	}
+	if ims != 1 {
+		t.Errorf("got %d im channels, want the one with bob", ims)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/slack-go/slack"
+
+	"github.com/erroneousboat/slack-term/config"
+)
+
+// Transport is the definition of the connection over which the events of a
+// workspace are received. Regardless of the implementation, events are
+// emitted as slack.RTMEvent, with Data containing the same event structs as
+// the RTM connection uses (e.g. *slack.MessageEvent).
+type Transport interface {
+	// ManageConnection will connect, and keep reconnecting when the
+	// connection drops until Disconnect is called. It blocks, so it should
+	// be run in a goroutine.
+	ManageConnection()
+
+	// IncomingEvents returns the channel on which the received events are
+	// emitted
+	IncomingEvents() <-chan slack.RTMEvent
+
+	// Disconnect will close the connection
+	Disconnect() error
+}
+
+// NewTransport will create the Transport that has been chosen in the config
+func NewTransport(cfg *config.Config, client *slack.Client) (Transport, error) {
+	switch cfg.Transport {
+	case config.TransportRTM, "":
+		return &rtmTransport{rtm: client.NewRTM()}, nil
+	case config.TransportSocketMode:
+		if cfg.AppToken == "" {
+			return nil, fmt.Errorf(
+				"the '%s' transport needs an app-level token, please set 'app_token'",
+				config.TransportSocketMode,
+			)
+		}
+
+		apiURL := slack.APIURL
+		if cfg.APIURL != "" {
+			apiURL = cfg.APIURL
+		}
+
+		return newSocketModeTransport(cfg.AppToken, apiURL), nil
+	default:
+		return nil, fmt.Errorf("unsupported transport: %s", cfg.Transport)
+	}
+}
+
+// rtmTransport is the Transport that uses the RTM api of slack, see:
+// https://api.slack.com/rtm
+type rtmTransport struct {
+	rtm *slack.RTM
+}
+
+func (t *rtmTransport) ManageConnection() {
+	t.rtm.ManageConnection()
+}
+
+func (t *rtmTransport) IncomingEvents() <-chan slack.RTMEvent {
+	return t.rtm.IncomingEvents
+}
+
+func (t *rtmTransport) Disconnect() error {
+	return t.rtm.Disconnect()
+}
@@ -16,11 +16,14 @@ type View struct {
 	Threads  *components.Threads
 	Mode     *components.Mode
 	Debug    *components.Debug
+	Picker   *components.Picker
+	Viewer   *components.Viewer
 }
 
-func CreateView(config *config.Config, svc *service.SlackService) (*View, error) {
+func CreateView(config *config.Config, svc service.Service) (*View, error) {
 	// Create Input component
 	input := components.CreateInputComponent()
+	input.History = svc.GetInputHistory()
 
 	// Channels: create the component
 	sideBarHeight := termui.TermHeight() - input.Par.Height
@@ -35,11 +38,19 @@ func CreateView(config *config.Config, svc *service.SlackService) (*View, error)
 	// Channels: set channels in component
 	channels.SetChannels(slackChans)
 
+	// Input: restore the draft of the first channel, and mark the
+	// channels that have one
+	input.Drafts = svc.GetDrafts()
+	input.RestoreDraft(channels.ChannelItems[channels.SelectedChannel].ID)
+	channels.MarkDrafts(input.HasDraft)
+
 	// Threads: create component
 	threads := components.CreateThreadsComponent(sideBarHeight)
 
 	// Chat: create the component
 	chat := components.CreateChatComponent(input.Par.Height)
+	chat.Emoji = config.Emoji
+	chat.Mrkdwn = components.NewMrkdwnStyle(config.Theme.Message)
 
 	// Chat: fill the component
 	msgs, thr, err := svc.GetMessages(
@@ -75,6 +86,14 @@ func CreateView(config *config.Config, svc *service.SlackService) (*View, error)
 	// Mode: create the component
 	mode := components.CreateModeComponent()
 
+	// Picker: create the component, it is only shown when something
+	// needs to be picked
+	picker := components.CreatePickerComponent()
+
+	// Viewer: create the component, it is shown in place of the Chat
+	// when a file is viewed
+	viewer := components.CreateViewerComponent()
+
 	view := &View{
 		Config:   config,
 		Input:    input,
@@ -83,6 +102,8 @@ func CreateView(config *config.Config, svc *service.SlackService) (*View, error)
 		Chat:     chat,
 		Mode:     mode,
 		Debug:    debug,
+		Picker:   picker,
+		Viewer:   viewer,
 	}
 
 	return view, nil